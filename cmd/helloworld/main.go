@@ -1,10 +1,32 @@
 package main
 
 import (
+    "errors"
+    "fmt"
+    "os"
+
     "github.com/berndonline/go-helloworld/go-rest-api/internal/app"
 )
 
 func main() {
+    // "helloworld migrate [up|status]" applies or lists the sql schema migrations and exits
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := app.Migrate(os.Args[2:], os.Stdout); err != nil {
+            fmt.Fprintln(os.Stderr, "migrate:", err)
+            os.Exit(1)
+        }
+        return
+    }
+    // "helloworld dynamo [plan|apply]" reports or resolves drift of the DynamoDB content table and exits
+    if len(os.Args) > 1 && os.Args[1] == "dynamo" {
+        if err := app.Dynamo(os.Args[2:], os.Stdout); err != nil {
+            if errors.Is(err, app.ErrDynamoSchemaDrift) {
+                os.Exit(2)
+            }
+            fmt.Fprintln(os.Stderr, "dynamo:", err)
+            os.Exit(1)
+        }
+        return
+    }
     app.Run()
 }
-
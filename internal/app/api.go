@@ -4,9 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
-	opentracing "github.com/opentracing/opentracing-go"
 	"io/ioutil"
-	"log"
 	"net/http"
 )
 
@@ -17,63 +15,59 @@ type api struct {
 
 type allContent []api
 
+// maxBatchBodySize bounds the body of a batch request, leaving ample room for
+// maxContentBatchOperations operations.
+const maxBatchBodySize = 1 << 20
+
 func getIndexContent(w http.ResponseWriter, r *http.Request) {
-	tracer := opentracing.GlobalTracer()
-	span := StartSpanFromRequest("getIndexContent", tracer, r)
-	childSpan := opentracing.GlobalTracer().StartSpan("http-response", opentracing.ChildOf(span.Context()))
+	r, span := startRequestSpan(r, "getIndexContent")
+	defer span.End()
 	repo := getContentRepository()
-	items, err := repo.ListContent(r.Context())
+	var items allContent
+	var err error
+	if prefix := r.URL.Query().Get("name_prefix"); prefix != "" {
+		items, err = repo.ListContentByNamePrefix(r.Context(), prefix)
+	} else {
+		items, err = repo.ListContent(r.Context())
+	}
 	if err != nil {
-		log.Printf("helloworld: failed to list content from repository: %v", err)
+		requestLogger(r).Error("failed to list content from repository", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to list content")
-		defer childSpan.Finish()
-		defer span.Finish()
 		return
 	}
-	log.Print("helloworld: getIndexContent received a request - " + getIPAddress(r))
+	requestLogger(r).Info("getIndexContent received a request")
 	respondWithJson(w, http.StatusOK, items)
-	defer childSpan.Finish()
-	defer span.Finish()
 }
 
 func getSingleContent(w http.ResponseWriter, r *http.Request) {
-	tracer := opentracing.GlobalTracer()
-	span := StartSpanFromRequest("getSingleContent", tracer, r)
-	childSpan := opentracing.GlobalTracer().StartSpan("http-response", opentracing.ChildOf(span.Context()))
+	r, span := startRequestSpan(r, "getSingleContent")
+	defer span.End()
 	contentID := mux.Vars(r)["id"]
 	repo := getContentRepository()
 	content, err := repo.GetContent(r.Context(), contentID)
 	if err != nil {
-		defer childSpan.Finish()
 		if errors.Is(err, ErrContentNotFound) {
-			log.Print("helloworld: invalid getSingleContent")
+			requestLogger(r).Info("invalid getSingleContent", "id", contentID)
 			respondWithError(w, http.StatusNotFound, "Invalid ID")
-			defer span.Finish()
 			return
 		}
-		log.Printf("helloworld: failed getSingleContent: %v", err)
+		requestLogger(r).Error("failed getSingleContent", "id", contentID, "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to fetch content")
-		defer span.Finish()
 		return
 	}
-	log.Print("helloworld: getSingleContent received a request - " + getIPAddress(r))
+	requestLogger(r).Info("getSingleContent received a request", "id", contentID)
 	respondWithJson(w, http.StatusOK, content)
-	defer childSpan.Finish()
-	defer span.Finish()
 }
 
 func createContent(w http.ResponseWriter, r *http.Request) {
-	tracer := opentracing.GlobalTracer()
-	span := StartSpanFromRequest("createContent", tracer, r)
-	childSpan := opentracing.GlobalTracer().StartSpan("content-Insert", opentracing.ChildOf(span.Context()))
+	r, span := startRequestSpan(r, "createContent")
+	defer span.End()
 	defer r.Body.Close()
 	var newContent api
 	reqBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
-		log.Print("helloworld: failed createContent")
-		defer childSpan.Finish()
-		defer span.Finish()
+		requestLogger(r).Error("failed createContent", "error", err)
 		return
 	}
 	json.Unmarshal(reqBody, &newContent)
@@ -81,36 +75,32 @@ func createContent(w http.ResponseWriter, r *http.Request) {
 	created, err := repo.CreateContent(r.Context(), newContent)
 	if err != nil {
 		if errors.Is(err, ErrContentAlreadyExists) {
-			log.Print("helloworld: duplicate createContent")
+			requestLogger(r).Info("duplicate createContent", "id", newContent.ID)
 			respondWithError(w, http.StatusConflict, "Content already exists")
-			defer childSpan.Finish()
-			defer span.Finish()
 			return
 		}
 		respondWithError(w, http.StatusInternalServerError, err.Error())
-		log.Print("helloworld: failed createContent")
-		defer childSpan.Finish()
-		defer span.Finish()
+		requestLogger(r).Error("failed createContent", "id", newContent.ID, "error", err)
 		return
 	}
-	log.Print("helloworld: createContent received a request - " + getIPAddress(r))
+	requestLogger(r).Info("createContent received a request", "id", newContent.ID)
 	if created != nil {
 		if err := getContentPublisher().Publish(r.Context(), *created); err != nil {
-			log.Printf("helloworld: failed to publish content event: %v", err)
+			requestLogger(r).Error("failed to publish content event", "id", created.ID, "error", err)
 		}
 	}
 	respondWithJson(w, http.StatusCreated, created)
-	defer childSpan.Finish()
-	defer span.Finish()
 }
 
 func updateContent(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "updateContent")
+	defer span.End()
 	defer r.Body.Close()
 	contentID := mux.Vars(r)["id"]
 	var updatedContent api
 	reqBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Print("helloworld: failed updateContent")
+		requestLogger(r).Error("failed updateContent", "id", contentID, "error", err)
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -122,15 +112,17 @@ func updateContent(w http.ResponseWriter, r *http.Request) {
 			respondWithError(w, http.StatusNotFound, "Invalid ID")
 			return
 		}
-		log.Print("helloworld: failed updateContent")
+		requestLogger(r).Error("failed updateContent", "id", contentID, "error", err)
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	respondWithJson(w, http.StatusOK, updated)
-	log.Print("helloworld: updateContent received a request - " + getIPAddress(r))
+	requestLogger(r).Info("updateContent received a request", "id", contentID)
 }
 
 func deleteContent(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "deleteContent")
+	defer span.End()
 	contentID := mux.Vars(r)["id"]
 	repo := getContentRepository()
 	if err := repo.DeleteContent(r.Context(), contentID); err != nil {
@@ -138,16 +130,119 @@ func deleteContent(w http.ResponseWriter, r *http.Request) {
 			respondWithError(w, http.StatusNotFound, "Invalid ID")
 			return
 		}
-		log.Printf("helloworld: failed deleteContent: %v", err)
+		requestLogger(r).Error("failed deleteContent", "id", contentID, "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete content")
 		return
 	}
-	log.Print("helloworld: deleteContent received a request - " + getIPAddress(r))
+	requestLogger(r).Info("deleteContent received a request", "id", contentID)
 	respondWithJson(w, http.StatusOK, "The content with has been deleted successfully")
 }
 
+// batchRequest is the body of POST /content:batch.
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchOperation struct {
+	Op   contentOperationKind `json:"op"`
+	ID   string               `json:"id"`
+	Name string               `json:"name,omitempty"`
+}
+
+// batchResult reports one operation with the status the equivalent single
+// request would have returned.
+type batchResult struct {
+	ID     string               `json:"id"`
+	Op     contentOperationKind `json:"op"`
+	Status int                  `json:"status"`
+	Item   *api                 `json:"item,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+func batchContent(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "batchContent")
+	defer span.End()
+	defer r.Body.Close()
+	var batch batchRequest
+	reqBody, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodySize))
+	if err != nil {
+		requestLogger(r).Info("invalid batchContent", "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Batch request too large")
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Invalid batch request")
+		return
+	}
+	if err := json.Unmarshal(reqBody, &batch); err != nil {
+		requestLogger(r).Info("invalid batchContent", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid batch request")
+		return
+	}
+	ops := make([]contentOperation, len(batch.Operations))
+	for i, op := range batch.Operations {
+		ops[i] = contentOperation{Kind: op.Op, Item: api{ID: op.ID, Name: op.Name}}
+	}
+	repo := getContentRepository()
+	results, err := repo.BatchContent(r.Context(), ops)
+	if err != nil {
+		if errors.Is(err, ErrInvalidContentBatch) {
+			requestLogger(r).Info("invalid batchContent", "error", err)
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		requestLogger(r).Error("failed batchContent", "operations", len(ops), "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to apply batch")
+		return
+	}
+
+	response := make([]batchResult, len(ops))
+	// like the single requests, only created records are published; an
+	// upsert cannot tell whether it created the item
+	var created []api
+	for i, op := range ops {
+		result := batchResult{ID: op.Item.ID, Op: op.Kind, Status: http.StatusOK, Item: results[i].Item}
+		switch err := results[i].Err; {
+		case err == nil:
+			if op.Kind == contentOperationCreate {
+				result.Status = http.StatusCreated
+				created = append(created, *result.Item)
+			}
+		case errors.Is(err, ErrContentAlreadyExists):
+			result.Status, result.Error = http.StatusConflict, "Content already exists"
+		case errors.Is(err, ErrContentNotFound):
+			result.Status, result.Error = http.StatusNotFound, "Invalid ID"
+		default:
+			requestLogger(r).Error("failed batchContent operation", "id", op.Item.ID, "op", op.Kind, "error", err)
+			result.Status, result.Error = http.StatusInternalServerError, "Failed to apply operation"
+		}
+		response[i] = result
+	}
+	requestLogger(r).Info("batchContent received a request", "operations", len(ops))
+	if len(created) > 0 {
+		if err := getContentPublisher().PublishBatch(r.Context(), created); err != nil {
+			requestLogger(r).Error("failed to publish content events", "count", len(created), "error", err)
+		}
+	}
+	respondWithJson(w, http.StatusOK, map[string][]batchResult{"results": response})
+}
+
+// respondWithError writes a JSON error body including the request ID that
+// RequestIDHandler already placed on the response headers.
 func respondWithError(w http.ResponseWriter, code int, msg string) {
-	respondWithJson(w, code, map[string]string{"error": msg})
+	body := map[string]string{"error": msg}
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		body["request_id"] = id
+	}
+	respondWithJson(w, code, body)
+}
+
+// respondWithText writes a plain text body with an explicit content type.
+func respondWithText(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(msg))
 }
 
 func respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
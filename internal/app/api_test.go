@@ -3,8 +3,10 @@ package app
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 
@@ -23,8 +25,9 @@ func resetRepository() ContentRepository {
 }
 
 type mockPublisher struct {
-	mu     sync.Mutex
-	events []api
+	mu      sync.Mutex
+	events  []api
+	batches int
 }
 
 func (m *mockPublisher) Publish(_ context.Context, item api) error {
@@ -34,6 +37,14 @@ func (m *mockPublisher) Publish(_ context.Context, item api) error {
 	return nil
 }
 
+func (m *mockPublisher) PublishBatch(_ context.Context, items []api) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, items...)
+	m.batches++
+	return nil
+}
+
 func (m *mockPublisher) Close() error {
 	return nil
 }
@@ -78,6 +89,35 @@ func Test_getContentIndex(t *testing.T) {
 	}
 }
 
+func Test_getContentIndexByNamePrefix(t *testing.T) {
+	repo := resetRepository()
+	ctx := context.Background()
+	for _, item := range []api{{ID: "1", Name: "Content 1"}, {ID: "2", Name: "Other"}, {ID: "3", Name: "Content 3"}} {
+		if _, err := repo.CreateContent(ctx, item); err != nil {
+			t.Fatalf("failed to seed content %s: %v", item.ID, err)
+		}
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/content", basicAuth(getIndexContent)).Methods("GET")
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"?name_prefix=Content", `[{"id":"1","name":"Content 1"},{"id":"3","name":"Content 3"}]`},
+		{"?name_prefix=content", `[]`},
+		{"?name_prefix=", `[{"id":"1","name":"Content 1"},{"id":"2","name":"Other"},{"id":"3","name":"Content 3"}]`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/content"+tt.query, nil)
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK || rr.Body.String() != tt.expected {
+			t.Errorf("%s: got %d %v want %v", tt.query, rr.Code, rr.Body.String(), tt.expected)
+		}
+	}
+}
+
 func Test_getSingleContent(t *testing.T) {
 	repo := resetRepository()
 	ctx := context.Background()
@@ -289,6 +329,68 @@ func Test_CreateContentPublishesEvent(t *testing.T) {
 	}
 }
 
+func Test_batchContent(t *testing.T) {
+	repo := resetRepository()
+	ctx := context.Background()
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "One"}); err != nil {
+		t.Fatal(err)
+	}
+	pub := &mockPublisher{}
+	setContentPublisher(pub)
+	defer resetContentPublisher()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/content:batch", basicAuth(batchContent)).Methods("POST")
+	serve := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/api/v1/content:batch", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(`{"operations":[{"op":"create","id":"2","name":"Two"},{"op":"create","id":"1","name":"Uno"},{"op":"upsert","id":"1","name":"Uno"},{"op":"delete","id":"3"}]}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected duplicate ids to be rejected, got %d", rr.Code)
+	}
+
+	rr = serve(`{"operations":[{"op":"create","id":"2","name":"Two"},{"op":"create","id":"1","name":"Uno"},{"op":"upsert","id":"4","name":"Four"},{"op":"delete","id":"3"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusOK)
+	}
+	expected := `{"results":[{"id":"2","op":"create","status":201,"item":{"id":"2","name":"Two"}},` +
+		`{"id":"1","op":"create","status":409,"error":"Content already exists"},` +
+		`{"id":"4","op":"upsert","status":200,"item":{"id":"4","name":"Four"}},` +
+		`{"id":"3","op":"delete","status":404,"error":"Invalid ID"}]}`
+	if rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+	if pub.batches != 1 {
+		t.Fatalf("expected one published batch, got %d", pub.batches)
+	}
+	if events := pub.published(); len(events) != 1 || events[0].ID != "2" {
+		t.Fatalf("expected only the created item to be published, got %+v", events)
+	}
+
+	// a batch that creates nothing publishes nothing
+	rr = serve(`{"operations":[{"op":"upsert","id":"5","name":"Five"},{"op":"delete","id":"2"}]}`)
+	if rr.Code != http.StatusOK || pub.batches != 1 {
+		t.Fatalf("unexpected status %d or batches %d", rr.Code, pub.batches)
+	}
+
+	rr = serve(`{"operations":[{"op":"create","id":"6","name":"` + strings.Repeat("x", maxBatchBodySize) + `"}]}`)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected an oversized body to be rejected, got %d", rr.Code)
+	}
+	if _, err := repo.GetContent(ctx, "6"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("oversized batch was applied: %v", err)
+	}
+}
+
 func Test_jwtChecks(t *testing.T) {
 	resetRepository()
 	r := mux.NewRouter()
@@ -1,14 +1,14 @@
 package app
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
-	opentracing "github.com/opentracing/opentracing-go"
-	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -26,33 +26,86 @@ var users = map[string]string{
 
 type Claims struct {
 	Username string `json:"username"`
+	CSRF     string `json:"csrf,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type principalContextKey struct{}
+
+// withPrincipal stores the authenticated principal in the request context.
+func withPrincipal(r *http.Request, principal string) *http.Request {
+	if info := requestInfoFromContext(r.Context()); info != nil {
+		info.user = principal
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+}
+
+// principalFromContext returns the authenticated principal, or an empty string
+// for anonymous requests.
+func principalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalContextKey{}).(string)
+	return principal
+}
+
+// serveCertPrincipal serves a request authenticated by a verified client
+// certificate mapped to a principal and reports whether it handled it. Browsers
+// send client certificates on cross-site requests like cookies, so unsafe
+// methods must come from a trusted origin.
+func serveCertPrincipal(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) bool {
+	principal, ok := clientCertPrincipal(r)
+	if !ok {
+		return false
+	}
+	if !isSafeMethod(r.Method) && !sameOrigin(r) {
+		requestLogger(r).Warn("origin verification failed", "principal", principal)
+		respondWithError(w, http.StatusForbidden, "CSRF verification failed")
+		return true
+	}
+	handler(w, withPrincipal(r, principal))
+	return true
+}
+
 func basicAuth(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// get root span from context
-		tracer := opentracing.GlobalTracer()
-		span := StartSpanFromRequest("basicAuth", tracer, r)
+		// child span of the server span started by tracingHandler
+		r, span := startRequestSpan(r, "basicAuth")
+		defer span.End()
+		// verified client certificates mapped to a principal skip the password check
+		if serveCertPrincipal(w, r, handler) {
+			return
+		}
 		// basicAuth function
 		realm := "Please enter your username and password"
 		user, pass, ok := r.BasicAuth()
-		expectedPassword := users[user]
-		if !ok || subtle.ConstantTimeCompare([]byte(pass),
-			[]byte(expectedPassword)) != 1 {
+		lockout := getLoginGuard()
+		if ok {
+			if wait := lockout.retryAfter(r.Context(), user, getIPAddress(r)); wait > 0 {
+				if !limitAuthenticated(w, r, "") {
+					return
+				}
+				requestLogger(r).Warn("login locked out", "method", "basic", "username", user, "retry_after", wait)
+				rejectLockedOut(w, "basic", wait)
+				return
+			}
+		}
+		if !ok || !validCredentials(user, pass) {
+			if !limitAuthenticated(w, r, "") {
+				return
+			}
+			if ok {
+				lockout.failure(r.Context(), "basic", user, getIPAddress(r))
+			}
 			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
-			w.WriteHeader(401)
-			w.Write([]byte("You are Unauthorized to access the application.\n"))
-			log.Print("helloworld: authentication failed - " + getIPAddress(r))
-			defer span.Finish()
+			respondWithText(w, http.StatusUnauthorized, "You are Unauthorized to access the application.\n")
+			requestLogger(r).Warn("authentication failed", "method", "basic", "username", user)
+			return
+		}
+		lockout.success(r.Context(), user)
+		if !limitAuthenticated(w, r, user) {
 			return
 		}
-		log.Print("helloworld: " + user + " login successfully - " + getIPAddress(r))
-		// stop tracer and inject http infos
-		defer span.Finish()
-		// inject tracer into context
-		Inject(span, r)
-		handler(w, r)
+		requestLogger(r).Info("login successful", "method", "basic", "username", user)
+		handler(w, withPrincipal(r, user))
 	}
 }
 
@@ -64,15 +117,40 @@ func jwtLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expectedPassword, ok := users[creds.Username]
-	if !ok || expectedPassword != creds.Password {
+	lockout := getLoginGuard()
+	if wait := lockout.retryAfter(r.Context(), creds.Username, getIPAddress(r)); wait > 0 {
+		requestLogger(r).Warn("login locked out", "method", "jwt", "username", creds.Username, "retry_after", wait)
+		rejectLockedOut(w, "jwt", wait)
+		return
+	}
+
+	if !validCredentials(creds.Username, creds.Password) {
+		lockout.failure(r.Context(), "jwt", creds.Username, getIPAddress(r))
+		requestLogger(r).Warn("authentication failed", "method", "jwt", "username", creds.Username)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	lockout.success(r.Context(), creds.Username)
 
+	if err := issueSession(w, r, creds.Username); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	requestLogger(r).Info("login successful", "method", "jwt", "username", creds.Username)
+	respondWithText(w, http.StatusOK, "Token issued.\n")
+}
+
+// issueSession signs a session token for username and sets the token cookie
+// together with the CSRF token the client has to echo on unsafe requests.
+func issueSession(w http.ResponseWriter, r *http.Request, username string) error {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
 	expirationTime := time.Now().Add(5 * time.Minute)
 	claims := &Claims{
-		Username: creds.Username,
+		Username: username,
+		CSRF:     csrfToken,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
@@ -81,85 +159,110 @@ func jwtLogin(w http.ResponseWriter, r *http.Request) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(jwtKey)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	http.SetCookie(w, buildSessionCookie(r, tokenString, expirationTime))
-	log.Print("helloworld: " + creds.Username + " login successfully - " + getIPAddress(r))
-	w.Write([]byte("Token issued.\n"))
+	http.SetCookie(w, buildCSRFCookie(csrfToken, expirationTime))
+	w.Header().Set(csrfHeaderName, csrfToken)
+	return nil
+}
+
+// validCredentials checks a username and password against the configured users.
+func validCredentials(username, password string) bool {
+	expectedPassword, ok := users[username]
+	return ok && subtle.ConstantTimeCompare([]byte(password), []byte(expectedPassword)) == 1
+}
+
+// parseSessionToken verifies the signature of a session token and returns its claims.
+func parseSessionToken(tknStr string) (*Claims, *jwt.Token, error) {
+	claims := &Claims{}
+	tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtKey, nil
+	})
+	return claims, tkn, err
+}
+
+// sessionToken returns the JWT from the Authorization bearer header or the token
+// cookie and reports whether it was taken from the cookie.
+func sessionToken(r *http.Request) (string, bool, error) {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:]), false, nil
+	}
+	c, err := r.Cookie("token")
+	if err != nil {
+		return "", true, err
+	}
+	return c.Value, true, nil
 }
 
 func jwtAuth(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// get root span from context
-		tracer := opentracing.GlobalTracer()
-		span := StartSpanFromRequest("jwtAuth", tracer, r)
-		// json web token function
-		c, err := r.Cookie("token")
+		// child span of the server span started by tracingHandler
+		r, span := startRequestSpan(r, "jwtAuth")
+		defer span.End()
+		// verified client certificates mapped to a principal skip the token check
+		if serveCertPrincipal(w, r, handler) {
+			return
+		}
+		// json web token function, failures count against the client ip bucket
+		reject := func(status int) {
+			if limitAuthenticated(w, r, "") {
+				w.WriteHeader(status)
+			}
+		}
+		tknStr, fromCookie, err := sessionToken(r)
 		if err != nil {
 			if err == http.ErrNoCookie {
-				w.WriteHeader(http.StatusUnauthorized)
-				defer span.Finish()
+				reject(http.StatusUnauthorized)
 				return
 			}
-			w.WriteHeader(http.StatusBadRequest)
-			defer span.Finish()
+			reject(http.StatusBadRequest)
 			return
 		}
 
-		tknStr := c.Value
-		claims := &Claims{}
-		tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtKey, nil
-		})
+		claims, tkn, err := parseSessionToken(tknStr)
 
 		if err != nil {
 			if errors.Is(err, jwt.ErrSignatureInvalid) {
-				w.WriteHeader(http.StatusUnauthorized)
-				defer span.Finish()
+				reject(http.StatusUnauthorized)
 				return
 			}
-			w.WriteHeader(http.StatusBadRequest)
-			defer span.Finish()
+			reject(http.StatusBadRequest)
 			return
 		}
 		if !tkn.Valid {
-			w.WriteHeader(http.StatusUnauthorized)
-			defer span.Finish()
+			reject(http.StatusUnauthorized)
+			return
+		}
+		if !limitAuthenticated(w, r, claims.Username) {
 			return
 		}
-		// stop tracer and inject http infos
-		defer span.Finish()
-		// inject tracer into context
-		Inject(span, r)
-		handler(w, r)
+		// cookie sessions must prove same-origin intent for unsafe methods, bearer tokens are exempt
+		if fromCookie && !verifyCSRF(r, claims.CSRF) {
+			requestLogger(r).Warn("csrf verification failed", "username", claims.Username)
+			respondWithError(w, http.StatusForbidden, "CSRF verification failed")
+			return
+		}
+		handler(w, withPrincipal(r, claims.Username))
 	}
 }
 
 func jwtRefresh(w http.ResponseWriter, r *http.Request) {
-	claims := &Claims{}
-	expirationTime := time.Now().Add(5 * time.Minute)
-	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
-
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("New token failed.\n"))
+	if err := issueSession(w, r, principalFromContext(r.Context())); err != nil {
+		respondWithText(w, http.StatusInternalServerError, "New token failed.\n")
 		return
 	}
-
-	http.SetCookie(w, buildSessionCookie(r, tokenString, expirationTime))
-	w.Write([]byte("Token renewed.\n"))
+	respondWithText(w, http.StatusOK, "Token renewed.\n")
 }
 
 func jwtLogout(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, buildExpiredSessionCookie(r))
-	w.Write([]byte("Logged out!\n"))
+	http.SetCookie(w, buildExpiredCSRFCookie())
+	respondWithText(w, http.StatusOK, "Logged out!\n")
 }
 
 func buildSessionCookie(r *http.Request, value string, expires time.Time) *http.Cookie {
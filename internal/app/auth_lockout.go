@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginAttempts captures the failed login history tracked for a single key.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// LoginAttemptStore persists failed login attempts keyed by username or client IP.
+type LoginAttemptStore interface {
+	Get(ctx context.Context, key string) (LoginAttempts, error)
+	// RecordFailure increments the failure counter, starting over when the previous
+	// failure is older than window, and returns the updated attempts.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (LoginAttempts, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// loginGuard applies exponential lockouts once a username or client IP exceeds
+// the allowed number of failed logins.
+type loginGuard struct {
+	store     LoginAttemptStore
+	threshold int
+	base      time.Duration
+	max       time.Duration
+	window    time.Duration
+	now       func() time.Time
+}
+
+var (
+	loginGuardMu  sync.RWMutex
+	loginAttempts = newLoginGuardFromEnv(newInMemoryLoginAttemptStore())
+)
+
+func getLoginGuard() *loginGuard {
+	loginGuardMu.RLock()
+	defer loginGuardMu.RUnlock()
+	return loginAttempts
+}
+
+func setLoginGuard(g *loginGuard) {
+	loginGuardMu.Lock()
+	loginAttempts = g
+	loginGuardMu.Unlock()
+}
+
+func newLoginGuardFromEnv(store LoginAttemptStore) *loginGuard {
+	return &loginGuard{
+		store:     store,
+		threshold: envInt("AUTH_LOCKOUT_THRESHOLD", 5),
+		base:      envDuration("AUTH_LOCKOUT_BASE", 30*time.Second),
+		max:       envDuration("AUTH_LOCKOUT_MAX", 15*time.Minute),
+		window:    envDuration("AUTH_LOCKOUT_WINDOW", 15*time.Minute),
+		now:       time.Now,
+	}
+}
+
+// configureLoginGuard switches the attempt store to DynamoDB when AUTH_LOCKOUT_TABLE is set.
+func configureLoginGuard() {
+	table := strings.TrimSpace(os.Getenv("AUTH_LOCKOUT_TABLE"))
+	if table == "" {
+		slog.Info("login lockout tracking uses the in-memory store")
+		return
+	}
+	client, err := newDynamoClientFromEnv()
+	if err != nil {
+		slog.Warn("DynamoDB login attempt store not initialised, keeping in-memory store", "error", err)
+		return
+	}
+	setLoginGuard(newLoginGuardFromEnv(newDynamoLoginAttemptStore(client, table)))
+	slog.Info("login lockout tracking uses DynamoDB", "table", table)
+}
+
+func (g *loginGuard) enabled() bool {
+	return g != nil && g.threshold > 0
+}
+
+func lockoutKeys(username, ip string) map[string]string {
+	keys := map[string]string{"user": "user:" + username}
+	if ip != "" {
+		keys["ip"] = "ip:" + ip
+	}
+	return keys
+}
+
+// retryAfter returns how long the username or client IP remains locked out.
+func (g *loginGuard) retryAfter(ctx context.Context, username, ip string) time.Duration {
+	if !g.enabled() {
+		return 0
+	}
+	now := g.now()
+	var wait time.Duration
+	for _, key := range lockoutKeys(username, ip) {
+		attempts, err := g.store.Get(ctx, key)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to read login attempts", "key", key, "error", err)
+			continue
+		}
+		if remaining := attempts.LockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// failure records a failed login and locks the keys that crossed the threshold.
+func (g *loginGuard) failure(ctx context.Context, method, username, ip string) {
+	authFailuresTotal.WithLabelValues(method, "invalid_credentials").Inc()
+	if !g.enabled() {
+		return
+	}
+	now := g.now()
+	for scope, key := range lockoutKeys(username, ip) {
+		attempts, err := g.store.RecordFailure(ctx, key, now, g.window)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to record login attempt", "key", key, "error", err)
+			continue
+		}
+		if attempts.Failures < g.threshold {
+			continue
+		}
+		if err := g.store.Lock(ctx, key, now.Add(g.lockDuration(attempts.Failures))); err != nil {
+			slog.ErrorContext(ctx, "failed to lock out", "scope", scope, "error", err)
+			continue
+		}
+		authLockoutsTotal.WithLabelValues(method, scope).Inc()
+	}
+}
+
+// success clears the failure history of the username; the client IP keeps its
+// history so a single valid account cannot be used to reset it.
+func (g *loginGuard) success(ctx context.Context, username string) {
+	if !g.enabled() {
+		return
+	}
+	if err := g.store.Reset(ctx, "user:"+username); err != nil {
+		slog.ErrorContext(ctx, "failed to reset login attempts", "error", err)
+	}
+}
+
+// lockDuration doubles the base lockout for every failure past the threshold.
+func (g *loginGuard) lockDuration(failures int) time.Duration {
+	exp := failures - g.threshold
+	if exp > 30 {
+		return g.max
+	}
+	d := time.Duration(float64(g.base) * math.Pow(2, float64(exp)))
+	if d > g.max || d <= 0 {
+		return g.max
+	}
+	return d
+}
+
+// rejectLockedOut answers with 429 and a Retry-After header in whole seconds.
+func rejectLockedOut(w http.ResponseWriter, method string, wait time.Duration) {
+	authFailuresTotal.WithLabelValues(method, "locked_out").Inc()
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithText(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later.\n")
+}
+
+type inMemoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]LoginAttempts
+	lastPrune time.Time
+}
+
+func newInMemoryLoginAttemptStore() *inMemoryLoginAttemptStore {
+	return &inMemoryLoginAttemptStore{attempts: make(map[string]LoginAttempts)}
+}
+
+func (s *inMemoryLoginAttemptStore) Get(_ context.Context, key string) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *inMemoryLoginAttemptStore) RecordFailure(_ context.Context, key string, now time.Time, window time.Duration) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now, window)
+	attempts := s.attempts[key]
+	if now.Sub(attempts.LastFailure) > window && now.After(attempts.LockedUntil) {
+		attempts = LoginAttempts{}
+	}
+	attempts.Failures++
+	attempts.LastFailure = now
+	s.attempts[key] = attempts
+	return attempts, nil
+}
+
+// prune drops expired entries at most once per window so the map does not grow
+// with every client IP that ever failed a login.
+func (s *inMemoryLoginAttemptStore) prune(now time.Time, window time.Duration) {
+	if now.Sub(s.lastPrune) < window {
+		return
+	}
+	s.lastPrune = now
+	for key, attempts := range s.attempts {
+		if now.Sub(attempts.LastFailure) > window && now.After(attempts.LockedUntil) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+func (s *inMemoryLoginAttemptStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts := s.attempts[key]
+	attempts.LockedUntil = until
+	s.attempts[key] = attempts
+	return nil
+}
+
+func (s *inMemoryLoginAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoLoginAttemptStore shares failed login attempts across replicas. The table
+// uses "key" as partition key and "expires_at" as TTL attribute.
+type dynamoLoginAttemptStore struct {
+	client dynamoItemAPI
+	table  string
+}
+
+func newDynamoLoginAttemptStore(client dynamoItemAPI, table string) *dynamoLoginAttemptStore {
+	return &dynamoLoginAttemptStore{client: client, table: table}
+}
+
+func (s *dynamoLoginAttemptStore) Get(ctx context.Context, key string) (LoginAttempts, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return LoginAttempts{}, fmt.Errorf("get login attempts from DynamoDB: %w", err)
+	}
+	return dynamoItemToLoginAttempts(out.Item)
+}
+
+func (s *dynamoLoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (LoginAttempts, error) {
+	expires := numberAttr(now.Add(window).Unix())
+	out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		UpdateExpression: aws.String("SET failures = if_not_exists(failures, :zero) + :one, last_failure = :now, expires_at = :expires"),
+		// only keep counting while the previous failure is inside the window or a lock is active
+		ConditionExpression: aws.String("attribute_not_exists(#k) OR last_failure >= :windowStart OR locked_until > :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#k": "key",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero":        numberAttr(0),
+			":one":         numberAttr(1),
+			":now":         numberAttr(now.UnixMilli()),
+			":windowStart": numberAttr(now.Add(-window).UnixMilli()),
+			":expires":     expires,
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err == nil {
+		return dynamoItemToLoginAttempts(out.Attributes)
+	}
+	var conditionalErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionalErr) {
+		return LoginAttempts{}, fmt.Errorf("record login failure in DynamoDB: %w", err)
+	}
+	// the previous failures are outside the window, start counting again
+	if _, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"key":          &types.AttributeValueMemberS{Value: key},
+			"failures":     numberAttr(1),
+			"last_failure": numberAttr(now.UnixMilli()),
+			"expires_at":   expires,
+		},
+	}); err != nil {
+		return LoginAttempts{}, fmt.Errorf("reset login failures in DynamoDB: %w", err)
+	}
+	return LoginAttempts{Failures: 1, LastFailure: now}, nil
+}
+
+func (s *dynamoLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+		UpdateExpression: aws.String("SET locked_until = :until, expires_at = :expires"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":until":   numberAttr(until.UnixMilli()),
+			":expires": numberAttr(until.Add(time.Hour).Unix()),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("lock login key in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *dynamoLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key:       map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+	})
+	if err != nil {
+		return fmt.Errorf("reset login attempts in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func numberAttr(v int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+}
+
+func dynamoItemToLoginAttempts(item map[string]types.AttributeValue) (LoginAttempts, error) {
+	var attempts LoginAttempts
+	if item == nil {
+		return attempts, nil
+	}
+	number := func(name string) (int64, error) {
+		attr, ok := item[name].(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, nil
+		}
+		v, err := strconv.ParseInt(attr.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("dynamodb login attempt %s attribute is not a number", name)
+		}
+		return v, nil
+	}
+	failures, err := number("failures")
+	if err != nil {
+		return attempts, err
+	}
+	lastFailure, err := number("last_failure")
+	if err != nil {
+		return attempts, err
+	}
+	lockedUntil, err := number("locked_until")
+	if err != nil {
+		return attempts, err
+	}
+	attempts.Failures = int(failures)
+	if lastFailure > 0 {
+		attempts.LastFailure = time.UnixMilli(lastFailure)
+	}
+	if lockedUntil > 0 {
+		attempts.LockedUntil = time.UnixMilli(lockedUntil)
+	}
+	return attempts, nil
+}
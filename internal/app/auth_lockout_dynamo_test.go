@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_dynamoLoginAttemptStore(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	fake.key = "key"
+	store := newDynamoLoginAttemptStore(fake, "login_attempts")
+	// the store keeps millisecond precision
+	now := time.UnixMilli(time.Now().UnixMilli())
+	window := 5 * time.Minute
+
+	if attempts, err := store.Get(ctx, "user:alice"); err != nil || attempts != (LoginAttempts{}) {
+		t.Fatalf("unexpected attempts for an unknown key: %+v, %v", attempts, err)
+	}
+
+	t.Run("Failures are counted within the window", func(t *testing.T) {
+		for want := 1; want <= 3; want++ {
+			attempts, err := store.RecordFailure(ctx, "user:alice", now.Add(time.Duration(want)*time.Second), window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attempts.Failures != want || !attempts.LastFailure.Equal(now.Add(time.Duration(want)*time.Second)) {
+				t.Fatalf("unexpected attempts after %d failures: %+v", want, attempts)
+			}
+		}
+		if fake.callCount("PutItem") != 0 {
+			t.Fatal("failures inside the window restarted the count")
+		}
+	})
+
+	t.Run("Lock is stored and keeps the count", func(t *testing.T) {
+		until := now.Add(time.Hour)
+		if err := store.Lock(ctx, "user:alice", until); err != nil {
+			t.Fatal(err)
+		}
+		attempts, err := store.Get(ctx, "user:alice")
+		if err != nil || attempts.Failures != 3 || !attempts.LockedUntil.Equal(until) {
+			t.Fatalf("unexpected attempts after lock: %+v, %v", attempts, err)
+		}
+		// the lock outlasts the window, so a later failure keeps counting
+		attempts, err = store.RecordFailure(ctx, "user:alice", now.Add(30*time.Minute), window)
+		if err != nil || attempts.Failures != 4 {
+			t.Fatalf("unexpected attempts during the lock: %+v, %v", attempts, err)
+		}
+	})
+
+	t.Run("Failures after the window and lock start over", func(t *testing.T) {
+		later := now.Add(2 * time.Hour)
+		attempts, err := store.RecordFailure(ctx, "user:alice", later, window)
+		if err != nil || attempts.Failures != 1 || !attempts.LastFailure.Equal(later) {
+			t.Fatalf("unexpected attempts after the window: %+v, %v", attempts, err)
+		}
+		if attempts, err = store.Get(ctx, "user:alice"); err != nil || attempts.Failures != 1 || !attempts.LockedUntil.IsZero() {
+			t.Fatalf("expired lock was kept: %+v, %v", attempts, err)
+		}
+	})
+
+	t.Run("Reset removes the attempts", func(t *testing.T) {
+		if err := store.Reset(ctx, "user:alice"); err != nil {
+			t.Fatal(err)
+		}
+		if attempts, err := store.Get(ctx, "user:alice"); err != nil || attempts != (LoginAttempts{}) {
+			t.Fatalf("attempts left after reset: %+v, %v", attempts, err)
+		}
+	})
+}
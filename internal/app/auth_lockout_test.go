@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestLoginGuard(now *time.Time) *loginGuard {
+	return &loginGuard{
+		store:     newInMemoryLoginAttemptStore(),
+		threshold: 3,
+		base:      10 * time.Second,
+		max:       time.Minute,
+		window:    5 * time.Minute,
+		now:       func() time.Time { return *now },
+	}
+}
+
+func Test_loginGuardLockDuration(t *testing.T) {
+	now := time.Now()
+	g := newTestLoginGuard(&now)
+	cases := map[int]time.Duration{
+		3:  10 * time.Second,
+		4:  20 * time.Second,
+		5:  40 * time.Second,
+		6:  time.Minute,
+		90: time.Minute,
+	}
+	for failures, want := range cases {
+		if got := g.lockDuration(failures); got != want {
+			t.Errorf("lockDuration(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func Test_basicAuthLockout(t *testing.T) {
+	resetRepository()
+	now := time.Now()
+	setLoginGuard(newTestLoginGuard(&now))
+	defer setLoginGuard(newLoginGuardFromEnv(newInMemoryLoginAttemptStore()))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/content", basicAuth(getIndexContent)).Methods("GET")
+	do := func(pass string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/v1/content", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(username, pass)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 3; i++ {
+		if rr := do("wrong"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: unexpected status code: got %d want %d", i, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	t.Run("Locked out with valid password", func(t *testing.T) {
+		rr := do(password)
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusTooManyRequests)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "10" {
+			t.Fatalf("unexpected Retry-After header: got %q want %q", got, "10")
+		}
+	})
+
+	t.Run("Unlocked after lockout expires", func(t *testing.T) {
+		now = now.Add(11 * time.Second)
+		if rr := do(password); rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusOK)
+		}
+	})
+}
+
+func Test_jwtLoginLockout(t *testing.T) {
+	now := time.Now()
+	setLoginGuard(newTestLoginGuard(&now))
+	defer setLoginGuard(newLoginGuardFromEnv(newInMemoryLoginAttemptStore()))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/login", jwtLogin).Methods("POST")
+	do := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/api/v2/login", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 3; i++ {
+		do(`{"username":"user2","password":"wrong"}`)
+	}
+	rr := do(`{"username":"user2","password":"password2"}`)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "10" {
+		t.Fatalf("unexpected Retry-After header: got %q want %q", got, "10")
+	}
+}
@@ -0,0 +1,319 @@
+package app
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// contentCacheSettings configures the in-process read-through cache.
+type contentCacheSettings struct {
+	// Size is the maximum number of cached items, 0 disables the cache.
+	Size int
+	TTL  time.Duration
+	// NegativeTTL is how long a missing item is remembered, 0 disables negative caching.
+	NegativeTTL time.Duration
+	// InvalidationTopic is the Kafka topic replicas use to drop each other's stale entries.
+	InvalidationTopic string
+}
+
+func loadContentCacheSettings() contentCacheSettings {
+	return contentCacheSettings{
+		Size:              envInt("CONTENT_CACHE_SIZE", 0),
+		TTL:               envDuration("CONTENT_CACHE_TTL", 30*time.Second),
+		NegativeTTL:       envDuration("CONTENT_CACHE_NEGATIVE_TTL", 5*time.Second),
+		InvalidationTopic: strings.TrimSpace(os.Getenv("CONTENT_CACHE_INVALIDATION_TOPIC")),
+	}
+}
+
+// cacheInvalidationPublisher tells other replicas that an item changed. It is
+// called on the request path and must not wait for delivery.
+type cacheInvalidationPublisher interface {
+	PublishInvalidations(ctx context.Context, ids ...string) error
+}
+
+type contentCacheEntry struct {
+	id string
+	// item is nil for a cached ErrContentNotFound.
+	item    *api
+	expires time.Time
+}
+
+// cachingContentRepository caches GetContent results in a size-bounded LRU
+// with a TTL. Concurrent misses for the same id share one backend read, and
+// every write drops the local entry and broadcasts an invalidation.
+type cachingContentRepository struct {
+	next          ContentRepository
+	settings      contentCacheSettings
+	invalidations cacheInvalidationPublisher
+	now           func() time.Time
+	loads         singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// loading tracks the ids with a load in flight. Invalidating an id bumps
+	// its generation, and loads that started before are not stored, as they
+	// may have read the old value.
+	loading map[string]*contentCacheLoad
+}
+
+// contentCacheLoad is the generation of an id with loads in flight.
+type contentCacheLoad struct {
+	generation uint64
+	inflight   int
+}
+
+func newCachingContentRepository(next ContentRepository, settings contentCacheSettings) *cachingContentRepository {
+	return &cachingContentRepository{
+		next:     next,
+		settings: settings,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		loading:  make(map[string]*contentCacheLoad),
+	}
+}
+
+func (c *cachingContentRepository) unwrap() ContentRepository {
+	return c.next
+}
+
+func (c *cachingContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	return c.next.ListContent(ctx)
+}
+
+func (c *cachingContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	return c.next.ListContentByNamePrefix(ctx, prefix)
+}
+
+func (c *cachingContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if item, found, err := c.lookup(id); found {
+		return item, err
+	}
+	// the shared load must not fail for every waiter when the first caller goes away
+	loadCtx := context.WithoutCancel(ctx)
+	result := c.loads.DoChan(id, func() (any, error) {
+		generation := c.beginLoad(id)
+		item, err := c.next.GetContent(loadCtx, id)
+		c.endLoad(id, generation, item, err == nil || errors.Is(err, ErrContentNotFound))
+		return item, err
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		item := *res.Val.(*api)
+		return &item, nil
+	}
+}
+
+func (c *cachingContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	created, err := c.next.CreateContent(ctx, item)
+	c.afterWrite(ctx, item.ID, err)
+	return created, err
+}
+
+func (c *cachingContentRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	updated, err := c.next.UpdateContent(ctx, id, name)
+	c.afterWrite(ctx, id, err)
+	return updated, err
+}
+
+func (c *cachingContentRepository) DeleteContent(ctx context.Context, id string) error {
+	err := c.next.DeleteContent(ctx, id)
+	c.afterWrite(ctx, id, err)
+	return err
+}
+
+func (c *cachingContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	results, err := c.next.BatchContent(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	written := make([]string, 0, len(ops))
+	for i, op := range ops {
+		c.invalidate(op.Item.ID)
+		if results[i].Err == nil {
+			written = append(written, op.Item.ID)
+		}
+	}
+	c.publish(ctx, written...)
+	return results, nil
+}
+
+// afterWrite drops the local entry even for failed writes, since a conflict
+// or not-found answer shows the cached entry disagrees with the backend.
+// Only successful writes are broadcast to the other replicas.
+func (c *cachingContentRepository) afterWrite(ctx context.Context, id string, err error) {
+	c.invalidate(id)
+	if err == nil {
+		c.publish(ctx, id)
+	}
+}
+
+// publish broadcasts the changed ids to the other replicas in one message batch.
+func (c *cachingContentRepository) publish(ctx context.Context, ids ...string) {
+	if len(ids) == 0 || c.invalidations == nil {
+		return
+	}
+	if err := c.invalidations.PublishInvalidations(ctx, ids...); err != nil {
+		slog.Warn("failed to publish cache invalidations", "ids", ids, "request_id", requestIDFromContext(ctx), "error", err)
+	}
+}
+
+// lookup returns whether a result for id is cached and, if so, the result.
+func (c *cachingContentRepository) lookup(id string) (*api, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		contentCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false, nil
+	}
+	entry := el.Value.(*contentCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.removeLocked(el, "expired")
+		contentCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(el)
+	if entry.item == nil {
+		contentCacheRequests.WithLabelValues("negative_hit").Inc()
+		return nil, true, ErrContentNotFound
+	}
+	contentCacheRequests.WithLabelValues("hit").Inc()
+	item := *entry.item
+	return &item, true, nil
+}
+
+// beginLoad registers a load of id and returns the generation it started at.
+func (c *cachingContentRepository) beginLoad(id string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	load, ok := c.loading[id]
+	if !ok {
+		load = &contentCacheLoad{}
+		c.loading[id] = load
+	}
+	load.inflight++
+	return load.generation
+}
+
+// endLoad stores the loaded item unless id was invalidated while it was read.
+func (c *cachingContentRepository) endLoad(id string, generation uint64, item *api, cacheable bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	load := c.loading[id]
+	load.inflight--
+	if load.inflight == 0 {
+		delete(c.loading, id)
+	}
+	if cacheable && load.generation == generation {
+		c.storeLocked(id, item)
+	}
+}
+
+func (c *cachingContentRepository) storeLocked(id string, item *api) {
+	ttl := c.settings.TTL
+	if item == nil {
+		ttl = c.settings.NegativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	entry := &contentCacheEntry{id: id, expires: c.now().Add(ttl)}
+	if item != nil {
+		copy := *item
+		entry.item = &copy
+	}
+	if el, ok := c.entries[id]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[id] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.settings.Size {
+		c.removeLocked(c.lru.Back(), "capacity")
+	}
+	contentCacheEntries.Set(float64(c.lru.Len()))
+}
+
+// invalidate drops the entry for id and discards loads of id still in flight.
+func (c *cachingContentRepository) invalidate(id string) {
+	c.mu.Lock()
+	if load, ok := c.loading[id]; ok {
+		load.generation++
+	}
+	if el, ok := c.entries[id]; ok {
+		c.removeLocked(el, "invalidated")
+	}
+	c.mu.Unlock()
+	// later readers start a fresh load instead of joining one that may be stale
+	c.loads.Forget(id)
+}
+
+func (c *cachingContentRepository) removeLocked(el *list.Element, reason string) {
+	delete(c.entries, el.Value.(*contentCacheEntry).id)
+	c.lru.Remove(el)
+	contentCacheEvictions.WithLabelValues(reason).Inc()
+	contentCacheEntries.Set(float64(c.lru.Len()))
+}
+
+// configureContentCache wraps the configured repository in the read-through
+// cache when CONTENT_CACHE_SIZE is set and subscribes to invalidations from
+// other replicas. It returns a cleanup function stopping the subscription.
+func configureContentCache() func() {
+	cleanup := func() {}
+	settings := loadContentCacheSettings()
+	if settings.Size <= 0 {
+		return cleanup
+	}
+	cache := newCachingContentRepository(getContentRepository(), settings)
+	setContentRepository(cache)
+	slog.Info("content cache enabled", "size", settings.Size, "ttl", settings.TTL, "negative_ttl", settings.NegativeTTL)
+
+	brokers := parseKafkaBrokers(os.Getenv("KAFKA_BROKERS"))
+	if settings.InvalidationTopic == "" || len(brokers) == 0 {
+		slog.Warn("content cache invalidation disabled (missing KAFKA_BROKERS or CONTENT_CACHE_INVALIDATION_TOPIC), other replicas may serve stale items until the TTL expires")
+		return cleanup
+	}
+	clientID := strings.TrimSpace(os.Getenv("KAFKA_CLIENT_ID"))
+	if clientID == "" {
+		clientID = serviceName
+	}
+	invalidator, err := newKafkaCacheInvalidator(brokers, settings.InvalidationTopic, clientID, cacheInstanceID())
+	if err != nil {
+		slog.Error("unable to initialize cache invalidation", "error", err)
+		return cleanup
+	}
+	cache.invalidations = invalidator
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		invalidator.Consume(ctx, cache.invalidate)
+	}()
+	slog.Info("content cache invalidation enabled", "topic", settings.InvalidationTopic)
+
+	return func() {
+		cancel()
+		<-done
+		if err := invalidator.Close(); err != nil {
+			slog.Error("error closing cache invalidation", "error", err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func newTestCache(backend ContentRepository, settings contentCacheSettings) (*cachingContentRepository, *time.Time) {
+	cache := newCachingContentRepository(backend, settings)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func Test_cachingContentRepository(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingContentRepository{ContentRepository: newInMemoryRepository(allContent{{ID: "1", Name: "One"}, {ID: "2", Name: "Two"}, {ID: "3", Name: "Three"}})}
+	cache, now := newTestCache(backend, contentCacheSettings{Size: 2, TTL: time.Minute, NegativeTTL: 10 * time.Second})
+
+	get := func(id string) (*api, error) {
+		t.Helper()
+		return cache.GetContent(ctx, id)
+	}
+	expectReads := func(want int32) {
+		t.Helper()
+		if got := backend.gets.Load(); got != want {
+			t.Fatalf("expected %d backend reads, got %d", want, got)
+		}
+	}
+
+	t.Run("Hit within TTL", func(t *testing.T) {
+		get("1")
+		item, err := get("1")
+		if err != nil || item.Name != "One" {
+			t.Fatalf("unexpected item %v, %v", item, err)
+		}
+		// callers get copies and cannot modify the cached item
+		item.Name = "Changed"
+		if again, _ := get("1"); again.Name != "One" {
+			t.Fatalf("cached item was modified through a returned pointer: %v", again)
+		}
+		expectReads(1)
+	})
+
+	t.Run("Expired after TTL", func(t *testing.T) {
+		*now = now.Add(time.Minute)
+		get("1")
+		expectReads(2)
+	})
+
+	t.Run("Least recently used is evicted", func(t *testing.T) {
+		get("2") // cache holds 2, 1
+		get("1") // 1 becomes most recent
+		get("3") // evicts 2
+		expectReads(4)
+		get("1")
+		get("3")
+		expectReads(4)
+		get("2")
+		expectReads(5)
+	})
+
+	t.Run("Negative caching", func(t *testing.T) {
+		if _, err := get("missing"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("expected ErrContentNotFound, got %v", err)
+		}
+		// created behind the cache's back, e.g. by another replica without invalidation
+		backend.CreateContent(ctx, api{ID: "missing", Name: "Late"})
+		if _, err := get("missing"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("expected cached ErrContentNotFound, got %v", err)
+		}
+		expectReads(6)
+		*now = now.Add(10 * time.Second)
+		if item, err := get("missing"); err != nil || item.Name != "Late" {
+			t.Fatalf("negative entry did not expire: %v, %v", item, err)
+		}
+		expectReads(7)
+	})
+
+	t.Run("Local writes invalidate", func(t *testing.T) {
+		get("1")
+		if _, err := cache.UpdateContent(ctx, "1", "Updated"); err != nil {
+			t.Fatal(err)
+		}
+		if item, _ := get("1"); item.Name != "Updated" {
+			t.Fatalf("stale item after update: %v", item)
+		}
+		if err := cache.DeleteContent(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := get("1"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("expected ErrContentNotFound after delete, got %v", err)
+		}
+		if _, err := cache.CreateContent(ctx, api{ID: "1", Name: "Recreated"}); err != nil {
+			t.Fatal(err)
+		}
+		if item, err := get("1"); err != nil || item.Name != "Recreated" {
+			t.Fatalf("negative entry survived create: %v, %v", item, err)
+		}
+	})
+}
+
+// gatedContentRepository reads the item and then blocks until released,
+// like a slow backend round-trip.
+type gatedContentRepository struct {
+	ContentRepository
+	mu      sync.Mutex
+	calls   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	item, err := g.ContentRepository.GetContent(ctx, id)
+	g.mu.Lock()
+	g.calls++
+	g.mu.Unlock()
+	g.started <- struct{}{}
+	<-g.release
+	return item, err
+}
+
+func Test_cachingContentRepositorySingleFlight(t *testing.T) {
+	backend := &gatedContentRepository{
+		ContentRepository: newInMemoryRepository(allContent{{ID: "1", Name: "One"}}),
+		started:           make(chan struct{}, 10),
+		release:           make(chan struct{}),
+	}
+	cache := newCachingContentRepository(backend, contentCacheSettings{Size: 10, TTL: time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if item, err := cache.GetContent(context.Background(), "1"); err != nil || item.Name != "One" {
+				t.Errorf("unexpected item %v, %v", item, err)
+			}
+		}()
+	}
+	<-backend.started
+	// callers arriving after the load finished are served from the cache
+	time.Sleep(20 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+	if backend.calls != 1 {
+		t.Fatalf("expected concurrent misses to share one backend read, got %d", backend.calls)
+	}
+
+	t.Run("Cancelled caller does not fail the shared load", func(t *testing.T) {
+		backend := &gatedContentRepository{
+			ContentRepository: newInMemoryRepository(allContent{{ID: "2", Name: "Two"}}),
+			started:           make(chan struct{}, 10),
+			release:           make(chan struct{}),
+		}
+		cache := newCachingContentRepository(backend, contentCacheSettings{Size: 10, TTL: time.Minute})
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			_, err := cache.GetContent(ctx, "2")
+			errs <- err
+		}()
+		<-backend.started
+		cancel()
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		close(backend.release)
+		if item, err := cache.GetContent(context.Background(), "2"); err != nil || item.Name != "Two" {
+			t.Fatalf("unexpected item %v, %v", item, err)
+		}
+	})
+}
+
+func Test_cachingContentRepositoryStaleLoad(t *testing.T) {
+	inner := newInMemoryRepository(allContent{{ID: "1", Name: "Old"}})
+	backend := &gatedContentRepository{ContentRepository: inner, started: make(chan struct{}, 10), release: make(chan struct{})}
+	cache := newCachingContentRepository(backend, contentCacheSettings{Size: 10, TTL: time.Minute})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.GetContent(context.Background(), "1")
+	}()
+	<-backend.started
+	// the write lands while the read of the old value is still in flight
+	if _, err := cache.UpdateContent(context.Background(), "1", "New"); err != nil {
+		t.Fatal(err)
+	}
+	close(backend.release)
+	<-done
+	if item, err := cache.GetContent(context.Background(), "1"); err != nil || item.Name != "New" {
+		t.Fatalf("stale load was cached: %v, %v", item, err)
+	}
+}
+
+func Test_cachingContentRepositoryUnrelatedWrite(t *testing.T) {
+	inner := newInMemoryRepository(allContent{{ID: "1", Name: "One"}, {ID: "2", Name: "Two"}})
+	backend := &gatedContentRepository{ContentRepository: inner, started: make(chan struct{}, 10), release: make(chan struct{})}
+	cache := newCachingContentRepository(backend, contentCacheSettings{Size: 10, TTL: time.Minute})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.GetContent(context.Background(), "2")
+	}()
+	<-backend.started
+	// a write to another item lands while the read is still in flight
+	if _, err := cache.UpdateContent(context.Background(), "1", "New"); err != nil {
+		t.Fatal(err)
+	}
+	close(backend.release)
+	<-done
+	if _, err := cache.GetContent(context.Background(), "2"); err != nil {
+		t.Fatal(err)
+	}
+	if backend.calls != 1 {
+		t.Fatalf("load of an unrelated item was discarded, got %d backend reads", backend.calls)
+	}
+	if len(cache.loading) != 0 {
+		t.Fatalf("finished loads are still tracked: %v", cache.loading)
+	}
+}
+
+// loopbackInvalidations delivers invalidations to other caches like the Kafka topic would.
+type loopbackInvalidations struct {
+	peers []*cachingContentRepository
+	calls int
+}
+
+func (l *loopbackInvalidations) PublishInvalidations(_ context.Context, ids ...string) error {
+	l.calls++
+	for _, peer := range l.peers {
+		for _, id := range ids {
+			peer.invalidate(id)
+		}
+	}
+	return nil
+}
+
+func Test_cachingContentRepositoryCrossReplicaInvalidation(t *testing.T) {
+	ctx := context.Background()
+	shared := newInMemoryRepository(allContent{{ID: "1", Name: "One"}})
+	settings := contentCacheSettings{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}
+	replicaA := newCachingContentRepository(shared, settings)
+	replicaB := newCachingContentRepository(shared, settings)
+	replicaA.invalidations = &loopbackInvalidations{peers: []*cachingContentRepository{replicaB}}
+
+	replicaB.GetContent(ctx, "1")
+	replicaB.GetContent(ctx, "2")
+	if _, err := replicaA.UpdateContent(ctx, "1", "Updated"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replicaA.CreateContent(ctx, api{ID: "2", Name: "Two"}); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := replicaB.GetContent(ctx, "1"); err != nil || item.Name != "Updated" {
+		t.Fatalf("replica served a stale item: %v, %v", item, err)
+	}
+	if item, err := replicaB.GetContent(ctx, "2"); err != nil || item.Name != "Two" {
+		t.Fatalf("replica served a stale negative entry: %v, %v", item, err)
+	}
+}
+
+func Test_cachingContentRepositoryBatchInvalidation(t *testing.T) {
+	ctx := context.Background()
+	shared := newInMemoryRepository(allContent{{ID: "1", Name: "One"}, {ID: "2", Name: "Two"}})
+	settings := contentCacheSettings{Size: 10, TTL: time.Hour, NegativeTTL: time.Hour}
+	replicaA := newCachingContentRepository(shared, settings)
+	replicaB := newCachingContentRepository(shared, settings)
+	loopback := &loopbackInvalidations{peers: []*cachingContentRepository{replicaB}}
+	replicaA.invalidations = loopback
+
+	for _, id := range []string{"1", "2", "3"} {
+		replicaB.GetContent(ctx, id)
+	}
+	results, err := replicaA.BatchContent(ctx, []contentOperation{
+		{Kind: contentOperationUpsert, Item: api{ID: "1", Name: "Updated"}},
+		{Kind: contentOperationDelete, Item: api{ID: "2"}},
+		{Kind: contentOperationDelete, Item: api{ID: "9"}},
+		{Kind: contentOperationCreate, Item: api{ID: "3", Name: "Three"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(results[2].Err, ErrContentNotFound) {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if loopback.calls != 1 {
+		t.Fatalf("expected a single publish for the batch, got %d", loopback.calls)
+	}
+	if item, err := replicaB.GetContent(ctx, "1"); err != nil || item.Name != "Updated" {
+		t.Fatalf("replica served a stale item: %v, %v", item, err)
+	}
+	if _, err := replicaB.GetContent(ctx, "2"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("replica served a deleted item: %v", err)
+	}
+	if item, err := replicaB.GetContent(ctx, "3"); err != nil || item.Name != "Three" {
+		t.Fatalf("replica served a stale negative entry: %v, %v", item, err)
+	}
+}
+
+func Test_kafkaCacheInvalidatorHandle(t *testing.T) {
+	k := &kafkaCacheInvalidator{origin: "replica-a"}
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Other replica", `{"id":"1","origin":"replica-b"}`, "1"},
+		{"Own message", `{"id":"1","origin":"replica-a"}`, ""},
+		{"Malformed", `not json`, ""},
+		{"Missing id", `{"origin":"replica-b"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			k.handle(kafka.Message{Value: []byte(tt.value)}, func(id string) { got = id })
+			if got != tt.want {
+				t.Fatalf("invalidated %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// cacheInvalidation is the message replicas exchange when an item changed.
+type cacheInvalidation struct {
+	ID string `json:"id"`
+	// Origin identifies the sending replica, which already dropped its own entry.
+	Origin string `json:"origin"`
+}
+
+// kafkaCacheInvalidator broadcasts invalidations on a topic. Every replica
+// reads all partitions without a consumer group, so each one sees every
+// message and restarts leave no abandoned groups or offsets on the brokers.
+type kafkaCacheInvalidator struct {
+	writer  *kafka.Writer
+	readers []*kafka.Reader
+	origin  string
+}
+
+// cacheInstanceID identifies this process among the replicas.
+func cacheInstanceID() string {
+	return fmt.Sprintf("%s-%d", hostname(), os.Getpid())
+}
+
+func newKafkaCacheInvalidator(brokers []string, topic, clientID, origin string) (*kafkaCacheInvalidator, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka brokers are required")
+	}
+	if topic == "" {
+		return nil, errors.New("kafka topic is required")
+	}
+	transport := &kafka.Transport{
+		ClientID:    clientID,
+		DialTimeout: 10 * time.Second,
+		IdleTimeout: 30 * time.Second,
+	}
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		AllowAutoTopicCreation: false,
+		Transport:              transport,
+		// invalidations are only useful while they are fresh
+		BatchTimeout: 10 * time.Millisecond,
+		// writes do not wait for the brokers; the TTL bounds staleness when
+		// an invalidation is lost
+		Async: true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				slog.Warn("failed to publish cache invalidations", "count", len(messages), "error", err)
+			}
+		},
+	}
+	partitions, err := lookupPartitions(brokers, topic, clientID)
+	if err != nil {
+		return nil, err
+	}
+	invalidator := &kafkaCacheInvalidator{writer: writer, origin: origin}
+	for _, partition := range partitions {
+		invalidator.readers = append(invalidator.readers, kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   brokers,
+			Topic:     topic,
+			Partition: partition.ID,
+			Dialer:    &kafka.Dialer{ClientID: clientID, Timeout: 10 * time.Second},
+			// a new replica starts with an empty cache and needs no history
+			StartOffset: kafka.LastOffset,
+			MaxWait:     time.Second,
+		}))
+	}
+	return invalidator, nil
+}
+
+// lookupPartitions returns the partitions of topic from the first broker that
+// answers. Partitions added later are only read after a restart.
+func lookupPartitions(brokers []string, topic, clientID string) ([]kafka.Partition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dialer := &kafka.Dialer{ClientID: clientID, Timeout: 10 * time.Second}
+	var errs []error
+	for _, broker := range brokers {
+		partitions, err := dialer.LookupPartitions(ctx, "tcp", broker, topic)
+		if err == nil && len(partitions) > 0 {
+			return partitions, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("topic %s has no partitions", topic)
+		}
+		errs = append(errs, fmt.Errorf("look up partitions on %s: %w", broker, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// PublishInvalidations queues one message per id with a single write and
+// returns without waiting for the brokers; delivery errors are logged by the
+// writer.
+func (k *kafkaCacheInvalidator) PublishInvalidations(ctx context.Context, ids ...string) error {
+	now := time.Now()
+	messages := make([]kafka.Message, 0, len(ids))
+	for _, id := range ids {
+		payload, err := json.Marshal(cacheInvalidation{ID: id, Origin: k.origin})
+		if err != nil {
+			return fmt.Errorf("marshal cache invalidation: %w", err)
+		}
+		messages = append(messages, kafka.Message{Key: []byte(id), Value: payload, Time: now})
+	}
+	return k.writer.WriteMessages(ctx, messages...)
+}
+
+// Consume reads invalidations from every partition until ctx is cancelled.
+func (k *kafkaCacheInvalidator) Consume(ctx context.Context, invalidate func(id string)) {
+	var wg sync.WaitGroup
+	for _, reader := range k.readers {
+		wg.Go(func() {
+			k.consumePartition(ctx, reader, invalidate)
+		})
+	}
+	wg.Wait()
+}
+
+// consumePartition reads one partition, retrying after errors.
+func (k *kafkaCacheInvalidator) consumePartition(ctx context.Context, reader *kafka.Reader, invalidate func(id string)) {
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("error reading cache invalidations", "partition", reader.Config().Partition, "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		k.handle(msg, invalidate)
+	}
+}
+
+func (k *kafkaCacheInvalidator) handle(msg kafka.Message, invalidate func(id string)) {
+	var inv cacheInvalidation
+	if err := json.Unmarshal(msg.Value, &inv); err != nil || inv.ID == "" {
+		slog.Warn("ignoring malformed cache invalidation", "offset", msg.Offset, "error", err)
+		return
+	}
+	if inv.Origin == k.origin {
+		return
+	}
+	invalidate(inv.ID)
+}
+
+func (k *kafkaCacheInvalidator) Close() error {
+	errs := []error{k.writer.Close()}
+	for _, reader := range k.readers {
+		errs = append(errs, reader.Close())
+	}
+	return errors.Join(errs...)
+}
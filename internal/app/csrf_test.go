@@ -0,0 +1,91 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_jwtCSRF(t *testing.T) {
+	resetRepository()
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/login", jwtLogin).Methods("POST")
+	r.HandleFunc("/api/v2/content", jwtAuth(getIndexContent)).Methods("GET")
+	r.HandleFunc("/api/v2/content", jwtAuth(createContent)).Methods("POST")
+
+	req, err := http.NewRequest("POST", "/api/v2/login", bytes.NewBufferString(`{"username":"user1","password":"password1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login failed: got %d want %d", rr.Code, http.StatusOK)
+	}
+	var session, csrf *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		switch c.Name {
+		case "token":
+			session = c
+		case csrfCookieName:
+			csrf = c
+		}
+	}
+	if session == nil || csrf == nil {
+		t.Fatal("login did not set the token and csrf cookies")
+	}
+	if rr.Header().Get(csrfHeaderName) != csrf.Value {
+		t.Fatal("login did not return the csrf token header")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		want   int
+		mutate func(*http.Request)
+	}{
+		{"Safe method without csrf header", "GET", http.StatusOK, func(req *http.Request) {
+			req.AddCookie(session)
+		}},
+		{"Cookie without csrf header", "POST", http.StatusForbidden, func(req *http.Request) {
+			req.AddCookie(session)
+		}},
+		{"Cookie with wrong csrf header", "POST", http.StatusForbidden, func(req *http.Request) {
+			req.AddCookie(session)
+			req.Header.Set(csrfHeaderName, "forged")
+		}},
+		{"Cookie with csrf header from foreign origin", "POST", http.StatusForbidden, func(req *http.Request) {
+			req.AddCookie(session)
+			req.Header.Set(csrfHeaderName, csrf.Value)
+			req.Header.Set("Origin", "https://attacker.example")
+		}},
+		{"Cookie with csrf header", "POST", http.StatusCreated, func(req *http.Request) {
+			req.AddCookie(session)
+			req.Header.Set(csrfHeaderName, csrf.Value)
+			req.Header.Set("Origin", "http://example.com")
+		}},
+		{"Bearer token", "POST", http.StatusCreated, func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+session.Value)
+			req.Header.Set("Origin", "https://attacker.example")
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"id":"csrf-%d","name":"CSRF"}`, i)
+			req, err := http.NewRequest(tt.method, "http://example.com/api/v2/content", bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.mutate(req)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status code: got %d want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// maxProfileDuration bounds on-demand CPU profiles so a request cannot keep the profiler busy.
+const maxProfileDuration = 60 * time.Second
+
+// diagnosticsSettings configures the opt-in diagnostics of the internal listener.
+type diagnosticsSettings struct {
+	RuntimeMetrics bool
+	Pprof          bool
+	Token          string
+	ProfileDir     string
+}
+
+func loadDiagnosticsSettings() diagnosticsSettings {
+	dir := strings.TrimSpace(os.Getenv("PROFILE_DIR"))
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return diagnosticsSettings{
+		RuntimeMetrics: envBool("METRICS_RUNTIME"),
+		Pprof:          envBool("DEBUG_PPROF"),
+		Token:          strings.TrimSpace(os.Getenv("DEBUG_TOKEN")),
+		ProfileDir:     dir,
+	}
+}
+
+// registerRuntimeMetrics adds the Go runtime and process collectors when enabled.
+func registerRuntimeMetrics(registry prometheus.Registerer, settings diagnosticsSettings) {
+	if !settings.RuntimeMetrics {
+		return
+	}
+	registry.MustRegister(collectors.NewGoCollector())
+	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// registerDiagnostics mounts pprof, the runtime trace and the profile capture
+// endpoint below /debug on the internal router. They are never exposed on the
+// public port.
+func registerDiagnostics(router *mux.Router, settings diagnosticsSettings) {
+	if !settings.Pprof {
+		return
+	}
+	debug := router.PathPrefix("/debug").Subrouter()
+	debug.Use(func(next http.Handler) http.Handler {
+		return debugAuth(settings.Token, next)
+	})
+	debug.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/pprof/profile", pprof.Profile)
+	debug.HandleFunc("/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/pprof/trace", pprof.Trace)
+	debug.PathPrefix("/pprof/").HandlerFunc(pprof.Index)
+	debug.Handle("/profiles", captureProfileHandler(settings.ProfileDir)).Methods("POST")
+	if settings.Token == "" {
+		slog.Warn("pprof endpoints enabled without DEBUG_TOKEN", "port", metricsPort)
+	} else {
+		slog.Info("pprof endpoints enabled", "port", metricsPort)
+	}
+}
+
+// debugAuth requires "Authorization: Bearer <token>" when a token is configured.
+func debugAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+				respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// captureProfileHandler writes a heap, allocs, goroutine or CPU profile
+// (?type=cpu&seconds=10) into dir and responds with the file path.
+func captureProfileHandler(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		kind := r.URL.Query().Get("type")
+		if kind == "" {
+			kind = "heap"
+		}
+		if kind != "cpu" && runtimepprof.Lookup(kind) == nil {
+			respondWithError(w, http.StatusBadRequest, "Unknown profile type")
+			return
+		}
+		duration := 10 * time.Second
+		if raw := r.URL.Query().Get("seconds"); raw != "" {
+			seconds, err := strconv.Atoi(raw)
+			if err != nil || seconds < 1 {
+				respondWithError(w, http.StatusBadRequest, "Invalid seconds")
+				return
+			}
+			duration = min(time.Duration(seconds)*time.Second, maxProfileDuration)
+		}
+
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			requestLogger(r).Error("failed to create profile directory", "dir", dir, "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create profile directory")
+			return
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.pprof", kind, time.Now().UTC().Format("20060102T150405.000Z")))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+		if err != nil {
+			requestLogger(r).Error("failed to create profile file", "path", path, "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create profile file")
+			return
+		}
+		defer f.Close()
+
+		if kind == "cpu" {
+			if err := runtimepprof.StartCPUProfile(f); err != nil {
+				os.Remove(path)
+				respondWithError(w, http.StatusConflict, "CPU profile already in progress")
+				return
+			}
+			select {
+			case <-time.After(duration):
+			case <-r.Context().Done():
+			}
+			runtimepprof.StopCPUProfile()
+		} else {
+			if kind == "heap" {
+				runtime.GC()
+			}
+			if err := runtimepprof.Lookup(kind).WriteTo(f, 0); err != nil {
+				requestLogger(r).Error("failed to write profile", "path", path, "error", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to write profile")
+				return
+			}
+		}
+		requestLogger(r).Info("profile captured", "type", kind, "path", path)
+		respondWithJson(w, http.StatusCreated, map[string]string{"type": kind, "file": path})
+	}
+}
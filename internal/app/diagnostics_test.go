@@ -0,0 +1,72 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_registerDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	router := mux.NewRouter()
+	registerDiagnostics(router, diagnosticsSettings{Pprof: true, Token: "secret", ProfileDir: dir})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"pprof index without token", "GET", "/debug/pprof/", "", http.StatusUnauthorized},
+		{"pprof index with wrong token", "GET", "/debug/pprof/", "wrong", http.StatusUnauthorized},
+		{"pprof index", "GET", "/debug/pprof/", "secret", http.StatusOK},
+		{"Goroutine profile", "GET", "/debug/pprof/goroutine?debug=1", "secret", http.StatusOK},
+		{"Unknown profile type", "POST", "/debug/profiles?type=bogus", "secret", http.StatusBadRequest},
+		{"Heap capture", "POST", "/debug/profiles?type=heap", "secret", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status code: got %d want %d", rr.Code, tt.want)
+			}
+			if rr.Code == http.StatusCreated {
+				var body map[string]string
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if filepath.Dir(body["file"]) != dir {
+					t.Fatalf("profile written outside the profile directory: %s", body["file"])
+				}
+				if info, err := os.Stat(body["file"]); err != nil || info.Size() == 0 {
+					t.Fatalf("profile file missing or empty: %v", err)
+				}
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		router := mux.NewRouter()
+		registerDiagnostics(router, diagnosticsSettings{})
+		req, _ := http.NewRequest("GET", "/debug/pprof/", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/berndonline/go-helloworld/go-rest-api/web"
+	"github.com/gorilla/mux"
+)
+
+// docsEnabled reports whether the API explorer is served; set DOCS_ENABLED=false to disable it.
+func docsEnabled() bool {
+	return strings.TrimSpace(os.Getenv("DOCS_ENABLED")) == "" || envBool("DOCS_ENABLED")
+}
+
+// registerDocs serves the embedded API explorer under /docs/.
+func registerDocs(router *mux.Router) {
+	if !docsEnabled() {
+		slog.Info("api explorer disabled (DOCS_ENABLED=false)")
+		return
+	}
+	assets, err := fs.Sub(web.Docs, "docs")
+	if err != nil {
+		slog.Error("api explorer assets not embedded", "error", err)
+		return
+	}
+	router.Handle("/docs", http.RedirectHandler("/docs/", http.StatusMovedPermanently))
+	router.PathPrefix("/docs/").Handler(http.StripPrefix("/docs/", docsHeaders(newStaticFileServer(assets, false))))
+}
+
+// docsHeaders keeps the explorer from being framed or loading foreign scripts.
+func docsHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_registerDocs(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  string
+		path     string
+		want     int
+		contains string
+	}{
+		{"Explorer page", "", "/docs/", http.StatusOK, "explorer.js"},
+		{"Explorer script", "", "/docs/explorer.js", http.StatusOK, "/api/openapi.json"},
+		{"Redirect to trailing slash", "", "/docs", http.StatusMovedPermanently, ""},
+		{"Disabled", "false", "/docs/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DOCS_ENABLED", tt.enabled)
+			r := mux.NewRouter()
+			registerDocs(r)
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status code: got %d want %d", rr.Code, tt.want)
+			}
+			if !strings.Contains(rr.Body.String(), tt.contains) {
+				t.Errorf("body does not contain %q", tt.contains)
+			}
+		})
+	}
+}
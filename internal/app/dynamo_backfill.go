@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoNameBackfillTag marks a table whose items all carry name_initial.
+// Items written before the name index existed lack it, so the repository only
+// queries the index once "dynamo apply" has backfilled them and tagged the table.
+var dynamoNameBackfillTag = types.Tag{Key: aws.String("name_initial:backfilled"), Value: aws.String("true")}
+
+// nameIndexed reports whether one of the indexes is keyed by name_initial.
+func (s dynamoTableSpec) nameIndexed() bool {
+	for _, index := range s.Indexes {
+		if index.PartitionKey.Name == dynamoNameInitialAttribute {
+			return true
+		}
+	}
+	return false
+}
+
+// planNameBackfill reports the backfill of an existing table whose name index
+// may be missing items. Bootstrap leaves it to "dynamo apply", as it reads the
+// whole table.
+func (m *dynamoTableManager) planNameBackfill(ctx context.Context, table *types.TableDescription) ([]dynamoSchemaChange, error) {
+	if !m.spec.nameIndexed() {
+		return nil, nil
+	}
+	arn := aws.ToString(table.TableArn)
+	done, err := hasNameBackfillTag(ctx, m.client, arn)
+	if err != nil || done {
+		return nil, err
+	}
+	return []dynamoSchemaChange{{
+		Action:  "~",
+		Summary: "backfill " + dynamoNameInitialAttribute + " on items written before the name index",
+		apply: func(ctx context.Context) error {
+			return m.backfillNameInitials(ctx, arn)
+		},
+	}}, nil
+}
+
+// backfillNameInitials sets name_initial on the items lacking it and then tags
+// the table. Each update is conditional on the name it was derived from, so a
+// concurrent rename or delete wins.
+func (m *dynamoTableManager) backfillNameInitials(ctx context.Context, arn string) error {
+	paginator := dynamodb.NewScanPaginator(m.client, &dynamodb.ScanInput{
+		TableName:            aws.String(m.spec.Table),
+		FilterExpression:     aws.String("attribute_not_exists(#i)"),
+		ProjectionExpression: aws.String("#id, #n"),
+		ExpressionAttributeNames: map[string]string{
+			"#i":  dynamoNameInitialAttribute,
+			"#id": "id",
+			"#n":  "name",
+		},
+	})
+	updated := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", m.spec.Table, err)
+		}
+		for _, item := range page.Items {
+			content, err := dynamoItemToContent(item)
+			if err != nil {
+				return err
+			}
+			// unnamed items stay out of the index
+			initial := nameInitial(content.Name)
+			if initial == "" {
+				continue
+			}
+			_, err = m.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(m.spec.Table),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: content.ID},
+				},
+				UpdateExpression:    aws.String("SET #i = :initial"),
+				ConditionExpression: aws.String("#n = :name"),
+				ExpressionAttributeNames: map[string]string{
+					"#i": dynamoNameInitialAttribute,
+					"#n": "name",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":initial": &types.AttributeValueMemberS{Value: initial},
+					":name":    &types.AttributeValueMemberS{Value: content.Name},
+				},
+			})
+			var conditionalErr *types.ConditionalCheckFailedException
+			if errors.As(err, &conditionalErr) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("backfill item %s: %w", content.ID, err)
+			}
+			updated++
+		}
+	}
+	slog.Info("dynamodb name index backfilled", "table", m.spec.Table, "items", updated)
+
+	_, err := m.client.TagResource(ctx, &dynamodb.TagResourceInput{
+		ResourceArn: aws.String(arn),
+		Tags:        []types.Tag{dynamoNameBackfillTag},
+	})
+	return err
+}
+
+// nameIndexBackfilled reports whether "dynamo apply" has backfilled the table
+// or created it with the name index.
+func nameIndexBackfilled(ctx context.Context, client dynamoSchemaAPI, table string) (bool, error) {
+	out, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return false, fmt.Errorf("describe table %s: %w", table, err)
+	}
+	return hasNameBackfillTag(ctx, client, aws.ToString(out.Table.TableArn))
+}
+
+func hasNameBackfillTag(ctx context.Context, client dynamoSchemaAPI, arn string) (bool, error) {
+	input := &dynamodb.ListTagsOfResourceInput{ResourceArn: aws.String(arn)}
+	for {
+		out, err := client.ListTagsOfResource(ctx, input)
+		if err != nil {
+			return false, fmt.Errorf("list tags of %s: %w", arn, err)
+		}
+		for _, tag := range out.Tags {
+			if aws.ToString(tag.Key) == aws.ToString(dynamoNameBackfillTag.Key) && aws.ToString(tag.Value) == aws.ToString(dynamoNameBackfillTag.Value) {
+				return true, nil
+			}
+		}
+		if out.NextToken == nil {
+			return false, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func Test_dynamoNameIndexBackfill(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	setup := newTestTableManager(fake, dynamoTableSpec{Table: "content"})
+	if err := setup.Apply(ctx, setup.planCreate()); err != nil {
+		t.Fatal(err)
+	}
+	// items written before the index existed carry no name_initial
+	for _, item := range []api{{ID: "1", Name: "Item 1"}, {ID: "2", Name: "Item 2"}, {ID: "3", Name: ""}} {
+		fake.items[item.ID] = map[string]types.AttributeValue{
+			"id":   &types.AttributeValueMemberS{Value: item.ID},
+			"name": &types.AttributeValueMemberS{Value: item.Name},
+		}
+	}
+	repo := newDynamoContentRepository(fake, "content")
+	mustCreate(t, repo, "4", "Item 4")
+
+	manager := newTestTableManager(fake, dynamoTableSpec{Table: "content", Indexes: []dynamoIndexSpec{dynamoNameIndex("name_index")}})
+	if err := manager.bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fake.callCount("UpdateItem") != 0 {
+		t.Fatal("bootstrap backfilled an existing table")
+	}
+	if index := repo.usableNameIndex(fake, "name_index"); index != "" {
+		t.Fatalf("repository queries index %q before the backfill", index)
+	}
+
+	var out bytes.Buffer
+	if err := runDynamoCommand(ctx, manager, "apply", &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "~ backfill name_initial on items written before the name index\ntable content is up to date\n" {
+		t.Fatalf("unexpected apply output %q", got)
+	}
+	if calls := fake.callCount("UpdateItem"); calls != 2 {
+		t.Fatalf("expected the two named items to be backfilled, got %d updates", calls)
+	}
+	if _, ok := fake.items["3"][dynamoNameInitialAttribute]; ok {
+		t.Fatal("unnamed item was added to the index")
+	}
+	expectNoDrift(t, manager)
+
+	repo.nameIndex = repo.usableNameIndex(fake, "name_index")
+	if repo.nameIndex != "name_index" {
+		t.Fatal("repository does not query the backfilled index")
+	}
+	items, err := repo.ListContentByNamePrefix(ctx, "Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(items); got != "[{1 Item 1} {2 Item 2} {4 Item 4}]" {
+		t.Fatalf("unexpected items %s", got)
+	}
+	if fake.callCount("Query") == 0 {
+		t.Fatal("name prefix query did not use the index")
+	}
+}
+
+func Test_dynamoNameIndexBackfillNewTable(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	manager := newTestTableManager(fake, dynamoTableSpec{Table: "content", Indexes: []dynamoIndexSpec{dynamoNameIndex("name_index")}})
+	if err := manager.bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectNoDrift(t, manager)
+	repo := newDynamoContentRepository(fake, "content")
+	if index := repo.usableNameIndex(fake, "name_index"); index != "name_index" {
+		t.Fatal("a table created with the index needs no backfill")
+	}
+	if fake.callCount("Scan") != 0 || fake.callCount("TagResource") != 0 {
+		t.Fatal("a new table was backfilled")
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// dynamoClientSettings configures the DynamoDB client shared by the content
+// repository, the rate limiter and the login attempt store.
+type dynamoClientSettings struct {
+	// Region falls back to the shared AWS config when empty.
+	Region string
+	// Endpoint overrides the service endpoint, e.g. for DynamoDB Local.
+	Endpoint string
+	// RoleARN is assumed via STS when set, otherwise the default credential chain is used.
+	RoleARN              string
+	RoleSessionName      string
+	WebIdentityTokenFile string
+	// RetryMode is "standard" or "adaptive"; adaptive additionally rate limits
+	// the client while DynamoDB is throttling.
+	RetryMode   aws.RetryMode
+	MaxAttempts int
+	MaxBackoff  time.Duration
+	// RequestTimeout bounds every API call including its retries, 0 disables it.
+	RequestTimeout time.Duration
+}
+
+func loadDynamoClientSettings() dynamoClientSettings {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	mode, err := aws.ParseRetryMode(strings.TrimSpace(os.Getenv("DYNAMODB_RETRY_MODE")))
+	if err != nil {
+		if raw := os.Getenv("DYNAMODB_RETRY_MODE"); raw != "" {
+			slog.Warn("invalid retry mode, using default", "name", "DYNAMODB_RETRY_MODE", "value", raw, "default", aws.RetryModeStandard)
+		}
+		mode = aws.RetryModeStandard
+	}
+	return dynamoClientSettings{
+		Region:               region,
+		Endpoint:             strings.TrimSpace(os.Getenv("DYNAMODB_ENDPOINT")),
+		RoleARN:              os.Getenv("AWS_ROLE_ARN"),
+		RoleSessionName:      os.Getenv("AWS_ROLE_SESSION_NAME"),
+		WebIdentityTokenFile: os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		RetryMode:            mode,
+		MaxAttempts:          envInt("DYNAMODB_MAX_ATTEMPTS", retry.DefaultMaxAttempts),
+		MaxBackoff:           envDuration("DYNAMODB_MAX_BACKOFF", retry.DefaultMaxBackoff),
+		RequestTimeout:       envDuration("DYNAMODB_REQUEST_TIMEOUT", 5*time.Second),
+	}
+}
+
+// newDynamoClientFromEnv builds a DynamoDB client from the environment.
+func newDynamoClientFromEnv() (*dynamodb.Client, error) {
+	return newDynamoClient(context.Background(), loadDynamoClientSettings())
+}
+
+// newDynamoClient builds a DynamoDB client. With a role ARN the credentials
+// are short-lived STS credentials (AssumeRole, or AssumeRoleWithWebIdentity
+// when a token file is given); otherwise the default chain of environment,
+// shared config, container and instance profile credentials applies.
+func newDynamoClient(ctx context.Context, settings dynamoClientSettings) (*dynamodb.Client, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return newDynamoRetryer(settings)
+		}),
+	}
+	if settings.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(settings.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("AWS_REGION or AWS_DEFAULT_REGION environment variable not set")
+	}
+
+	if settings.RoleARN != "" {
+		sessionName := settings.RoleSessionName
+		if sessionName == "" {
+			sessionName = fmt.Sprintf("go-helloworld-%d", time.Now().Unix())
+		}
+		stsClient := sts.NewFromConfig(cfg)
+		var provider aws.CredentialsProvider
+		if settings.WebIdentityTokenFile != "" {
+			provider = stscreds.NewWebIdentityRoleProvider(stsClient, settings.RoleARN, stscreds.IdentityTokenFile(settings.WebIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = sessionName
+			})
+		} else {
+			provider = stscreds.NewAssumeRoleProvider(stsClient, settings.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = sessionName
+			})
+		}
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	// fail at startup rather than on the first request when no credentials resolve
+	if cfg.Credentials == nil {
+		return nil, fmt.Errorf("no AWS credentials configured")
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("failed to obtain AWS credentials: %w", err)
+	}
+
+	return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if settings.Endpoint != "" {
+			o.BaseEndpoint = aws.String(settings.Endpoint)
+		}
+	}), nil
+}
+
+// newDynamoRetryer returns the SDK retryer for the settings. Throttling errors
+// such as ProvisionedThroughputExceededException are retried with jittered
+// exponential backoff up to MaxBackoff.
+func newDynamoRetryer(settings dynamoClientSettings) aws.Retryer {
+	standard := func(o *retry.StandardOptions) {
+		if settings.MaxAttempts > 0 {
+			o.MaxAttempts = settings.MaxAttempts
+		}
+		if settings.MaxBackoff > 0 {
+			o.MaxBackoff = settings.MaxBackoff
+		}
+	}
+	if settings.RetryMode == aws.RetryModeAdaptive {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, standard)
+		})
+	}
+	return retry.NewStandard(standard)
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// fakeDynamoEndpoint answers GetItem requests, throttling the first n of them.
+func fakeDynamoEndpoint(t *testing.T, throttled int32, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if target := r.Header.Get("X-Amz-Target"); target != "DynamoDB_20120810.GetItem" {
+			t.Errorf("unexpected operation %q", target)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKIDTEST/") {
+			t.Errorf("request not signed with the static credentials: %q", auth)
+		}
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if n <= throttled {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException","message":"Rate exceeded"}`))
+			return
+		}
+		w.Write([]byte(`{"Item":{"id":{"S":"1"},"name":{"S":"One"}}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// isolateAWSConfig keeps the default credential chain away from the host's
+// shared config files and instance metadata.
+func isolateAWSConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+}
+
+func newTestDynamoRepository(t *testing.T, endpoint string, settings dynamoClientSettings) *dynamoContentRepository {
+	t.Helper()
+	isolateAWSConfig(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	settings.Region = "eu-west-1"
+	settings.Endpoint = endpoint
+	client, err := newDynamoClient(context.Background(), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newDynamoContentRepository(client, "content")
+	repo.timeout = settings.RequestTimeout
+	return repo
+}
+
+func Test_newDynamoClientRetries(t *testing.T) {
+	t.Run("Throttled requests are retried", func(t *testing.T) {
+		server, requests := fakeDynamoEndpoint(t, 2, 0)
+		repo := newTestDynamoRepository(t, server.URL, dynamoClientSettings{MaxAttempts: 3, MaxBackoff: time.Millisecond})
+		item, err := repo.GetContent(context.Background(), "1")
+		if err != nil || item.Name != "One" {
+			t.Fatalf("unexpected item %v, %v", item, err)
+		}
+		if got := requests.Load(); got != 3 {
+			t.Fatalf("expected 3 attempts, got %d", got)
+		}
+	})
+
+	t.Run("Attempts are bounded", func(t *testing.T) {
+		server, requests := fakeDynamoEndpoint(t, 10, 0)
+		repo := newTestDynamoRepository(t, server.URL, dynamoClientSettings{MaxAttempts: 2, MaxBackoff: time.Millisecond})
+		_, err := repo.GetContent(context.Background(), "1")
+		if errorClass(err) != "throttled" {
+			t.Fatalf("expected a throttling error, got %v", err)
+		}
+		if got := requests.Load(); got != 2 {
+			t.Fatalf("expected 2 attempts, got %d", got)
+		}
+	})
+
+	t.Run("Request timeout", func(t *testing.T) {
+		server, _ := fakeDynamoEndpoint(t, 0, 200*time.Millisecond)
+		repo := newTestDynamoRepository(t, server.URL, dynamoClientSettings{MaxAttempts: 1, RequestTimeout: 20 * time.Millisecond})
+		if _, err := repo.GetContent(context.Background(), "1"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func Test_newDynamoClientCredentials(t *testing.T) {
+	isolateAWSConfig(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err := newDynamoClient(context.Background(), dynamoClientSettings{Region: "eu-west-1"}); err == nil {
+		t.Fatal("expected an error without any credentials")
+	}
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if _, err := newDynamoClient(context.Background(), dynamoClientSettings{}); err == nil || !strings.Contains(err.Error(), "AWS_REGION") {
+		t.Fatalf("expected a missing region error, got %v", err)
+	}
+}
+
+func Test_loadDynamoClientSettings(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "us-east-1")
+	t.Setenv("DYNAMODB_ENDPOINT", "http://localhost:8000")
+	t.Setenv("DYNAMODB_MAX_ATTEMPTS", "7")
+	t.Setenv("DYNAMODB_REQUEST_TIMEOUT", "2s")
+
+	tests := []struct {
+		mode string
+		want aws.RetryMode
+	}{
+		{"", aws.RetryModeStandard},
+		{"adaptive", aws.RetryModeAdaptive},
+		{"bogus", aws.RetryModeStandard},
+	}
+	for _, tt := range tests {
+		t.Setenv("DYNAMODB_RETRY_MODE", tt.mode)
+		settings := loadDynamoClientSettings()
+		if settings.RetryMode != tt.want {
+			t.Fatalf("mode %q: got %q want %q", tt.mode, settings.RetryMode, tt.want)
+		}
+		if _, adaptive := newDynamoRetryer(settings).(*retry.AdaptiveMode); adaptive != (tt.want == aws.RetryModeAdaptive) {
+			t.Fatalf("mode %q: unexpected retryer %T", tt.mode, newDynamoRetryer(settings))
+		}
+		if settings.Region != "us-east-1" || settings.Endpoint != "http://localhost:8000" || settings.MaxAttempts != 7 || settings.RequestTimeout != 2*time.Second {
+			t.Fatalf("unexpected settings %+v", settings)
+		}
+	}
+}
@@ -0,0 +1,819 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeDynamoDB is an in-process stand-in for a single DynamoDB table keyed by
+// a string attribute, "id" unless key is changed. It understands the condition
+// and update expressions the repository and the stores issue and returns
+// errors shaped like the SDK's.
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	key   string
+	items map[string]map[string]types.AttributeValue
+	calls map[string]int
+
+	// table is nil until CreateTable; the item operations do not check it.
+	table *types.TableDescription
+	// pending is the number of DescribeTable calls before the table and its
+	// indexes turn ACTIVE.
+	pending int
+	ttl     types.TimeToLiveDescription
+	pitr    bool
+	tags    []types.Tag
+
+	// throttled is the number of BatchWriteItem calls that leave the second
+	// half of their requests unprocessed.
+	throttled int
+	// conflicts is the number of TransactWriteItems calls cancelled with a
+	// transaction conflict on their first item.
+	conflicts int
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{
+		key:   "id",
+		items: make(map[string]map[string]types.AttributeValue),
+		calls: make(map[string]int),
+	}
+}
+
+// begin records the call and fails like the SDK when ctx is already done.
+func (f *fakeDynamoDB) begin(ctx context.Context, operation string) error {
+	f.calls[operation]++
+	if err := ctx.Err(); err != nil {
+		return &smithy.OperationError{ServiceID: "DynamoDB", OperationName: operation, Err: &aws.RequestCanceledError{Err: err}}
+	}
+	return nil
+}
+
+func (f *fakeDynamoDB) callCount(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[operation]
+}
+
+func conditionFailed(operation string) error {
+	return &smithy.OperationError{
+		ServiceID:     "DynamoDB",
+		OperationName: operation,
+		Err:           &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")},
+	}
+}
+
+func (f *fakeDynamoDB) keyOf(key map[string]types.AttributeValue) (string, error) {
+	id, ok := key[f.key].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", &smithy.GenericAPIError{Code: "ValidationException", Message: "The provided key element does not match the schema"}
+	}
+	return id.Value, nil
+}
+
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	return out
+}
+
+func fakeHash(id string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return h.Sum32()
+}
+
+// scanOrder mimics DynamoDB returning items in partition hash order rather
+// than by key; a parallel scan segment covers a slice of the hash space.
+func (f *fakeDynamoDB) scanOrder(segment, segments int32) []string {
+	ids := make([]string, 0, len(f.items))
+	for id := range f.items {
+		if segments <= 1 || int32(fakeHash(id)%uint32(segments)) == segment {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return fakeHash(ids[i]) < fakeHash(ids[j])
+	})
+	return ids
+}
+
+// project keeps the attributes named in a "#a, #b" projection expression.
+func project(item map[string]types.AttributeValue, expression *string, names map[string]string) map[string]types.AttributeValue {
+	if expression == nil {
+		return copyItem(item)
+	}
+	out := make(map[string]types.AttributeValue)
+	for _, name := range strings.Split(*expression, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "#") {
+			name = names[name]
+		}
+		if value, ok := item[name]; ok {
+			out[name] = value
+		}
+	}
+	return out
+}
+
+var (
+	fakeAttributeCheck = regexp.MustCompile(`^(attribute_exists|attribute_not_exists)\((#?\w+)\)$`)
+	fakeBeginsWith     = regexp.MustCompile(`^begins_with\((#?\w+), (:\w+)\)$`)
+	fakeComparison     = regexp.MustCompile(`^(#?\w+) (=|<>|<|<=|>|>=) (:\w+)$`)
+)
+
+// matchesCondition evaluates the condition and filter expressions issued by
+// the repository and the stores: attribute_exists, attribute_not_exists,
+// begins_with and comparisons with a placeholder, joined by OR. A missing
+// item is passed as nil.
+func matchesCondition(item map[string]types.AttributeValue, expression *string, names map[string]string, values map[string]types.AttributeValue) (bool, error) {
+	if aws.ToString(expression) == "" {
+		return true, nil
+	}
+	resolve := func(name string) string {
+		if strings.HasPrefix(name, "#") {
+			return names[name]
+		}
+		return name
+	}
+	for _, clause := range strings.Split(*expression, " OR ") {
+		clause = strings.TrimSpace(clause)
+		var ok bool
+		if m := fakeAttributeCheck.FindStringSubmatch(clause); m != nil {
+			_, exists := item[resolve(m[2])]
+			ok = exists == (m[1] == "attribute_exists")
+		} else if m := fakeBeginsWith.FindStringSubmatch(clause); m != nil {
+			attr, _ := item[resolve(m[1])].(*types.AttributeValueMemberS)
+			prefix, _ := values[m[2]].(*types.AttributeValueMemberS)
+			ok = attr != nil && prefix != nil && strings.HasPrefix(attr.Value, prefix.Value)
+		} else if m := fakeComparison.FindStringSubmatch(clause); m != nil {
+			value, found := values[m[3]]
+			if !found {
+				return false, fmt.Errorf("fake dynamodb: unresolved placeholder in %q", clause)
+			}
+			attr, exists := item[resolve(m[1])]
+			if exists {
+				order, err := compareAttributes(attr, value)
+				if err != nil {
+					return false, err
+				}
+				ok = map[string]bool{"=": order == 0, "<>": order != 0, "<": order < 0, "<=": order <= 0, ">": order > 0, ">=": order >= 0}[m[2]]
+			}
+		} else {
+			return false, fmt.Errorf("fake dynamodb: unsupported condition %q", clause)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compareAttributes orders two strings or two numbers.
+func compareAttributes(a, b types.AttributeValue) (int, error) {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		if b, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(a.Value, b.Value), nil
+		}
+	case *types.AttributeValueMemberN:
+		if b, ok := b.(*types.AttributeValueMemberN); ok {
+			x, errX := strconv.ParseFloat(a.Value, 64)
+			y, errY := strconv.ParseFloat(b.Value, 64)
+			if errX != nil || errY != nil {
+				return 0, fmt.Errorf("fake dynamodb: invalid number %q or %q", a.Value, b.Value)
+			}
+			return cmp.Compare(x, y), nil
+		}
+	}
+	return 0, fmt.Errorf("fake dynamodb: cannot compare %T with %T", a, b)
+}
+
+func (f *fakeDynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "Scan"); err != nil {
+		return nil, err
+	}
+	if (params.Segment == nil) != (params.TotalSegments == nil) {
+		return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "Segment and TotalSegments must be specified together"}
+	}
+	ids := f.scanOrder(aws.ToInt32(params.Segment), aws.ToInt32(params.TotalSegments))
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		after, err := f.keyOf(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		for start < len(ids) && ids[start] != after {
+			start++
+		}
+		start++
+	}
+	out := &dynamodb.ScanOutput{}
+	// like DynamoDB, Limit bounds the evaluated items before the filter applies
+	for i := start; i < len(ids); i++ {
+		if params.Limit != nil && int(out.ScannedCount) == int(*params.Limit) {
+			out.LastEvaluatedKey = map[string]types.AttributeValue{f.key: &types.AttributeValueMemberS{Value: ids[i-1]}}
+			break
+		}
+		out.ScannedCount++
+		item := f.items[ids[i]]
+		ok, err := matchesCondition(item, params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out.Items = append(out.Items, project(item, params.ProjectionExpression, params.ExpressionAttributeNames))
+		}
+	}
+	out.Count = int32(len(out.Items))
+	return out, nil
+}
+
+func (f *fakeDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "GetItem"); err != nil {
+		return nil, err
+	}
+	id, err := f.keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	out := &dynamodb.GetItemOutput{}
+	if item, ok := f.items[id]; ok {
+		out.Item = copyItem(item)
+	}
+	return out, nil
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "PutItem"); err != nil {
+		return nil, err
+	}
+	id, err := f.keyOf(params.Item)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := matchesCondition(f.items[id], params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, conditionFailed("PutItem")
+	}
+	f.items[id] = copyItem(params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+var fakeKeyCondition = regexp.MustCompile(`^(#?\w+) = (:\w+) AND begins_with\((#?\w+), (:\w+)\)$`)
+
+// Query supports the keys-only name index: an equality on the partition key
+// and begins_with on the sort key, returned in sort key order.
+func (f *fakeDynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "Query"); err != nil {
+		return nil, err
+	}
+	m := fakeKeyCondition.FindStringSubmatch(aws.ToString(params.KeyConditionExpression))
+	if params.IndexName == nil || m == nil {
+		return nil, fmt.Errorf("fake dynamodb: unsupported query %q", aws.ToString(params.KeyConditionExpression))
+	}
+	resolve := func(name string) string {
+		if strings.HasPrefix(name, "#") {
+			return params.ExpressionAttributeNames[name]
+		}
+		return name
+	}
+	partitionKey, sortKey := resolve(m[1]), resolve(m[3])
+	partition, _ := params.ExpressionAttributeValues[m[2]].(*types.AttributeValueMemberS)
+	prefix, _ := params.ExpressionAttributeValues[m[4]].(*types.AttributeValueMemberS)
+	if partition == nil || prefix == nil {
+		return nil, fmt.Errorf("fake dynamodb: unresolved placeholder in %q", aws.ToString(params.KeyConditionExpression))
+	}
+
+	type entry struct{ id, sort string }
+	var matches []entry
+	for id, item := range f.items {
+		p, _ := item[partitionKey].(*types.AttributeValueMemberS)
+		s, _ := item[sortKey].(*types.AttributeValueMemberS)
+		if p != nil && s != nil && p.Value == partition.Value && strings.HasPrefix(s.Value, prefix.Value) {
+			matches = append(matches, entry{id, s.Value})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].sort != matches[j].sort {
+			return matches[i].sort < matches[j].sort
+		}
+		return matches[i].id < matches[j].id
+	})
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		after, err := f.keyOf(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		for start < len(matches) && matches[start].id != after {
+			start++
+		}
+		start++
+	}
+	out := &dynamodb.QueryOutput{}
+	for i := start; i < len(matches); i++ {
+		if params.Limit != nil && len(out.Items) == int(*params.Limit) {
+			out.LastEvaluatedKey = project(f.items[matches[i-1].id], aws.String("id, "+partitionKey+", "+sortKey), nil)
+			break
+		}
+		out.Items = append(out.Items, project(f.items[matches[i].id], aws.String("id, "+partitionKey+", "+sortKey), nil))
+	}
+	out.Count = int32(len(out.Items))
+	out.ScannedCount = out.Count
+	return out, nil
+}
+
+var (
+	fakeSetClause     = regexp.MustCompile(`^\s*(#?\w+)\s*=\s*(:\w+)\s*$`)
+	fakeCounterClause = regexp.MustCompile(`^\s*(#?\w+)\s*=\s*if_not_exists\((#?\w+), (:\w+)\) \+ (:\w+)\s*$`)
+)
+
+// splitClauses splits a SET expression on the commas between its clauses.
+func splitClauses(expression string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	for i, c := range expression {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, expression[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, expression[start:])
+}
+
+// setValue resolves the value of a "name = :value" or
+// "name = if_not_exists(name, :start) + :increment" clause.
+func setValue(item map[string]types.AttributeValue, clause string, names map[string]string, values map[string]types.AttributeValue) (string, types.AttributeValue, error) {
+	resolve := func(name string) string {
+		if strings.HasPrefix(name, "#") {
+			return names[name]
+		}
+		return name
+	}
+	if m := fakeSetClause.FindStringSubmatch(clause); m != nil {
+		value, ok := values[m[2]]
+		if resolve(m[1]) == "" || !ok {
+			return "", nil, fmt.Errorf("fake dynamodb: unresolved placeholder in %q", clause)
+		}
+		return resolve(m[1]), value, nil
+	}
+	m := fakeCounterClause.FindStringSubmatch(clause)
+	if m == nil {
+		return "", nil, fmt.Errorf("fake dynamodb: unsupported update clause %q", clause)
+	}
+	current, ok := item[resolve(m[2])].(*types.AttributeValueMemberN)
+	if !ok {
+		current, ok = values[m[3]].(*types.AttributeValueMemberN)
+	}
+	increment, incOK := values[m[4]].(*types.AttributeValueMemberN)
+	if !ok || !incOK {
+		return "", nil, fmt.Errorf("fake dynamodb: unresolved number in %q", clause)
+	}
+	x, errX := strconv.ParseInt(current.Value, 10, 64)
+	y, errY := strconv.ParseInt(increment.Value, 10, 64)
+	if errX != nil || errY != nil {
+		return "", nil, fmt.Errorf("fake dynamodb: invalid number in %q", clause)
+	}
+	return resolve(m[1]), &types.AttributeValueMemberN{Value: strconv.FormatInt(x+y, 10)}, nil
+}
+
+func (f *fakeDynamoDB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "UpdateItem"); err != nil {
+		return nil, err
+	}
+	id, err := f.keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	current := f.items[id]
+	ok, err := matchesCondition(current, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, conditionFailed("UpdateItem")
+	}
+
+	expression := aws.ToString(params.UpdateExpression)
+	if !strings.HasPrefix(expression, "SET ") {
+		return nil, fmt.Errorf("fake dynamodb: unsupported update expression %q", expression)
+	}
+	// a missing item is created with its key
+	updated := copyItem(current)
+	for name, value := range params.Key {
+		updated[name] = value
+	}
+	set, remove, _ := strings.Cut(strings.TrimPrefix(expression, "SET "), " REMOVE ")
+	for _, name := range strings.Split(remove, ",") {
+		if name = strings.TrimSpace(name); strings.HasPrefix(name, "#") {
+			name = params.ExpressionAttributeNames[name]
+		}
+		delete(updated, name)
+	}
+	for _, clause := range splitClauses(set) {
+		name, value, err := setValue(current, clause, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		updated[name] = value
+	}
+	f.items[id] = updated
+
+	out := &dynamodb.UpdateItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllNew {
+		out.Attributes = copyItem(updated)
+	}
+	return out, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "DeleteItem"); err != nil {
+		return nil, err
+	}
+	id, err := f.keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := matchesCondition(f.items[id], params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, conditionFailed("DeleteItem")
+	}
+	delete(f.items, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// BatchWriteItem supports unconditional puts and deletes on the item table.
+func (f *fakeDynamoDB) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "BatchWriteItem"); err != nil {
+		return nil, err
+	}
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for table, requests := range params.RequestItems {
+		if len(requests) > 25 {
+			return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "Too many items requested for the BatchWriteItem call"}
+		}
+		if f.throttled > 0 {
+			f.throttled--
+			out.UnprocessedItems[table] = requests[len(requests)/2:]
+			requests = requests[:len(requests)/2]
+		}
+		for _, req := range requests {
+			switch {
+			case req.PutRequest != nil:
+				id, err := f.keyOf(req.PutRequest.Item)
+				if err != nil {
+					return nil, err
+				}
+				f.items[id] = copyItem(req.PutRequest.Item)
+			case req.DeleteRequest != nil:
+				id, err := f.keyOf(req.DeleteRequest.Key)
+				if err != nil {
+					return nil, err
+				}
+				delete(f.items, id)
+			}
+		}
+	}
+	return out, nil
+}
+
+// TransactWriteItems supports conditional puts and deletes. Like DynamoDB it
+// applies nothing when any condition fails and reports a reason per item.
+func (f *fakeDynamoDB) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "TransactWriteItems"); err != nil {
+		return nil, err
+	}
+	if len(params.TransactItems) > 100 {
+		return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "Member must have length less than or equal to 100"}
+	}
+	ids := make([]string, len(params.TransactItems))
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	cancelled := false
+	for i, item := range params.TransactItems {
+		var key, values map[string]types.AttributeValue
+		var condition *string
+		var names map[string]string
+		switch {
+		case item.Put != nil:
+			key, condition, names, values = item.Put.Item, item.Put.ConditionExpression, item.Put.ExpressionAttributeNames, item.Put.ExpressionAttributeValues
+		case item.Delete != nil:
+			key, condition, names, values = item.Delete.Key, item.Delete.ConditionExpression, item.Delete.ExpressionAttributeNames, item.Delete.ExpressionAttributeValues
+		default:
+			return nil, fmt.Errorf("fake dynamodb: unsupported transact item %+v", item)
+		}
+		id, err := f.keyOf(key)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+		ok, err := matchesCondition(f.items[id], condition, names, values)
+		if err != nil {
+			return nil, err
+		}
+		reasons[i].Code = aws.String("None")
+		if i == 0 && f.conflicts > 0 {
+			f.conflicts--
+			reasons[i].Code = aws.String("TransactionConflict")
+			cancelled = true
+		} else if !ok {
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			cancelled = true
+		}
+	}
+	if cancelled {
+		return nil, &smithy.OperationError{
+			ServiceID:     "DynamoDB",
+			OperationName: "TransactWriteItems",
+			Err:           &types.TransactionCanceledException{Message: aws.String("Transaction cancelled"), CancellationReasons: reasons},
+		}
+	}
+	for i, item := range params.TransactItems {
+		if item.Put != nil {
+			f.items[ids[i]] = copyItem(item.Put.Item)
+		} else {
+			delete(f.items, ids[i])
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func notFound(operation, table string) error {
+	return &smithy.OperationError{
+		ServiceID:     "DynamoDB",
+		OperationName: operation,
+		Err:           &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: Table: " + table + " not found")},
+	}
+}
+
+func resourceInUse(operation string) error {
+	return &smithy.OperationError{
+		ServiceID:     "DynamoDB",
+		OperationName: operation,
+		Err:           &types.ResourceInUseException{Message: aws.String("Table is being created or updated")},
+	}
+}
+
+func (f *fakeDynamoDB) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "DescribeTable"); err != nil {
+		return nil, err
+	}
+	if f.table == nil || aws.ToString(f.table.TableName) != aws.ToString(params.TableName) {
+		return nil, notFound("DescribeTable", aws.ToString(params.TableName))
+	}
+	if f.pending > 0 {
+		f.pending--
+	} else {
+		f.table.TableStatus = types.TableStatusActive
+		for i := range f.table.GlobalSecondaryIndexes {
+			f.table.GlobalSecondaryIndexes[i].IndexStatus = types.IndexStatusActive
+		}
+	}
+	table := *f.table
+	table.GlobalSecondaryIndexes = append([]types.GlobalSecondaryIndexDescription(nil), f.table.GlobalSecondaryIndexes...)
+	return &dynamodb.DescribeTableOutput{Table: &table}, nil
+}
+
+func (f *fakeDynamoDB) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "CreateTable"); err != nil {
+		return nil, err
+	}
+	if f.table != nil {
+		return nil, resourceInUse("CreateTable")
+	}
+	table := &types.TableDescription{
+		TableName:             params.TableName,
+		TableArn:              aws.String("arn:aws:dynamodb:us-east-1:000000000000:table/" + aws.ToString(params.TableName)),
+		TableStatus:           types.TableStatusCreating,
+		KeySchema:             params.KeySchema,
+		AttributeDefinitions:  params.AttributeDefinitions,
+		BillingModeSummary:    &types.BillingModeSummary{BillingMode: params.BillingMode},
+		ProvisionedThroughput: &types.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(0), WriteCapacityUnits: aws.Int64(0)},
+	}
+	if params.ProvisionedThroughput != nil {
+		table.ProvisionedThroughput = &types.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  params.ProvisionedThroughput.ReadCapacityUnits,
+			WriteCapacityUnits: params.ProvisionedThroughput.WriteCapacityUnits,
+		}
+	}
+	for _, index := range params.GlobalSecondaryIndexes {
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:   index.IndexName,
+			KeySchema:   index.KeySchema,
+			Projection:  index.Projection,
+			IndexStatus: types.IndexStatusCreating,
+		})
+	}
+	f.table = table
+	f.pending = 1
+	f.tags = params.Tags
+	return &dynamodb.CreateTableOutput{TableDescription: table}, nil
+}
+
+func (f *fakeDynamoDB) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "UpdateTable"); err != nil {
+		return nil, err
+	}
+	if f.table == nil {
+		return nil, notFound("UpdateTable", aws.ToString(params.TableName))
+	}
+	if f.table.TableStatus != types.TableStatusActive {
+		return nil, resourceInUse("UpdateTable")
+	}
+	if params.BillingMode != "" {
+		f.table.BillingModeSummary = &types.BillingModeSummary{BillingMode: params.BillingMode}
+	}
+	if params.ProvisionedThroughput != nil {
+		f.table.ProvisionedThroughput = &types.ProvisionedThroughputDescription{
+			ReadCapacityUnits:  params.ProvisionedThroughput.ReadCapacityUnits,
+			WriteCapacityUnits: params.ProvisionedThroughput.WriteCapacityUnits,
+		}
+	}
+	creates := 0
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		if update.Create == nil {
+			continue
+		}
+		if creates++; creates > 1 {
+			return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table"}
+		}
+		if provisioned := f.table.BillingModeSummary.BillingMode == types.BillingModeProvisioned; provisioned != (update.Create.ProvisionedThroughput != nil) {
+			return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "ProvisionedThroughput must be specified for indexes of PROVISIONED tables only"}
+		}
+		f.table.GlobalSecondaryIndexes = append(f.table.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:   update.Create.IndexName,
+			KeySchema:   update.Create.KeySchema,
+			Projection:  update.Create.Projection,
+			IndexStatus: types.IndexStatusCreating,
+		})
+	}
+	for _, def := range params.AttributeDefinitions {
+		if !containsAttribute(f.table.AttributeDefinitions, aws.ToString(def.AttributeName)) {
+			f.table.AttributeDefinitions = append(f.table.AttributeDefinitions, def)
+		}
+	}
+	f.table.TableStatus = types.TableStatusUpdating
+	f.pending = 1
+	return &dynamodb.UpdateTableOutput{TableDescription: f.table}, nil
+}
+
+func containsAttribute(definitions []types.AttributeDefinition, name string) bool {
+	for _, def := range definitions {
+		if aws.ToString(def.AttributeName) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeDynamoDB) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "DescribeTimeToLive"); err != nil {
+		return nil, err
+	}
+	if f.table == nil {
+		return nil, notFound("DescribeTimeToLive", aws.ToString(params.TableName))
+	}
+	ttl := f.ttl
+	if ttl.TimeToLiveStatus == "" {
+		ttl.TimeToLiveStatus = types.TimeToLiveStatusDisabled
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: &ttl}, nil
+}
+
+func (f *fakeDynamoDB) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "UpdateTimeToLive"); err != nil {
+		return nil, err
+	}
+	if f.table == nil {
+		return nil, notFound("UpdateTimeToLive", aws.ToString(params.TableName))
+	}
+	spec := params.TimeToLiveSpecification
+	if aws.ToBool(spec.Enabled) && f.ttl.TimeToLiveStatus == types.TimeToLiveStatusEnabled {
+		return nil, &smithy.GenericAPIError{Code: "ValidationException", Message: "TimeToLive is already enabled"}
+	}
+	f.ttl = types.TimeToLiveDescription{AttributeName: spec.AttributeName, TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if aws.ToBool(spec.Enabled) {
+		f.ttl.TimeToLiveStatus = types.TimeToLiveStatusEnabled
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: spec}, nil
+}
+
+func (f *fakeDynamoDB) DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeContinuousBackupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "DescribeContinuousBackups"); err != nil {
+		return nil, err
+	}
+	if f.table == nil {
+		return nil, notFound("DescribeContinuousBackups", aws.ToString(params.TableName))
+	}
+	return &dynamodb.DescribeContinuousBackupsOutput{ContinuousBackupsDescription: f.continuousBackups()}, nil
+}
+
+func (f *fakeDynamoDB) UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "UpdateContinuousBackups"); err != nil {
+		return nil, err
+	}
+	if f.table == nil {
+		return nil, notFound("UpdateContinuousBackups", aws.ToString(params.TableName))
+	}
+	f.pitr = aws.ToBool(params.PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled)
+	return &dynamodb.UpdateContinuousBackupsOutput{ContinuousBackupsDescription: f.continuousBackups()}, nil
+}
+
+func (f *fakeDynamoDB) continuousBackups() *types.ContinuousBackupsDescription {
+	status := types.PointInTimeRecoveryStatusDisabled
+	if f.pitr {
+		status = types.PointInTimeRecoveryStatusEnabled
+	}
+	return &types.ContinuousBackupsDescription{
+		ContinuousBackupsStatus:        types.ContinuousBackupsStatusEnabled,
+		PointInTimeRecoveryDescription: &types.PointInTimeRecoveryDescription{PointInTimeRecoveryStatus: status},
+	}
+}
+
+func (f *fakeDynamoDB) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "ListTagsOfResource"); err != nil {
+		return nil, err
+	}
+	if f.table == nil || aws.ToString(f.table.TableArn) != aws.ToString(params.ResourceArn) {
+		return nil, notFound("ListTagsOfResource", aws.ToString(params.ResourceArn))
+	}
+	return &dynamodb.ListTagsOfResourceOutput{Tags: append([]types.Tag(nil), f.tags...)}, nil
+}
+
+func (f *fakeDynamoDB) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, _ ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "TagResource"); err != nil {
+		return nil, err
+	}
+	if f.table == nil || aws.ToString(f.table.TableArn) != aws.ToString(params.ResourceArn) {
+		return nil, notFound("TagResource", aws.ToString(params.ResourceArn))
+	}
+	for _, tag := range params.Tags {
+		f.tags = slices.DeleteFunc(f.tags, func(existing types.Tag) bool {
+			return aws.ToString(existing.Key) == aws.ToString(tag.Key)
+		})
+		f.tags = append(f.tags, tag)
+	}
+	return &dynamodb.TagResourceOutput{}, nil
+}
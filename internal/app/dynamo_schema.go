@@ -0,0 +1,632 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrDynamoSchemaDrift is returned by "dynamo plan" when the table differs from the expected definition.
+var ErrDynamoSchemaDrift = errors.New("dynamodb table differs from the expected definition")
+
+// errDynamoBootstrap marks a failed DYNAMODB_BOOTSTRAP, which stops the service
+// instead of falling back to the in-memory store.
+var errDynamoBootstrap = errors.New("bootstrap DynamoDB table")
+
+// dynamoBootstrapAttempts bounds how often bootstrap waits for a table that
+// another replica is creating or updating before planning again.
+const dynamoBootstrapAttempts = 5
+
+// dynamoSchemaAPI is the subset of the DynamoDB client used to inspect and
+// bootstrap the content table and to backfill the name index.
+type dynamoSchemaAPI interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeContinuousBackupsOutput, error)
+	UpdateContinuousBackups(ctx context.Context, params *dynamodb.UpdateContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateContinuousBackupsOutput, error)
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+	TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// dynamoKeyAttribute is a key attribute of the table or of an index.
+type dynamoKeyAttribute struct {
+	Name string
+	Type types.ScalarAttributeType
+}
+
+func (a dynamoKeyAttribute) String() string {
+	return fmt.Sprintf("%s (%s)", a.Name, a.Type)
+}
+
+// dynamoIndexSpec describes a global secondary index.
+type dynamoIndexSpec struct {
+	Name         string
+	PartitionKey dynamoKeyAttribute
+	// SortKey is optional, an empty name means a partition key only index.
+	SortKey    dynamoKeyAttribute
+	Projection types.ProjectionType
+}
+
+// dynamoContentKey is the partition key of the content table.
+var dynamoContentKey = dynamoKeyAttribute{Name: "id", Type: types.ScalarAttributeTypeS}
+
+// dynamoContentIndexes lists the global secondary indexes the repository
+// queries; bootstrap creates the missing ones and plan reports them.
+func dynamoContentIndexes(settings dynamoListSettings) []dynamoIndexSpec {
+	if settings.NameIndex == "" {
+		return nil
+	}
+	return []dynamoIndexSpec{dynamoNameIndex(settings.NameIndex)}
+}
+
+// dynamoTableSpec is the expected definition of the content table.
+type dynamoTableSpec struct {
+	Table string
+	// BillingMode is empty when the billing mode of an existing table is left
+	// unmanaged; new tables are then created on demand.
+	BillingMode   types.BillingMode
+	ReadCapacity  int64
+	WriteCapacity int64
+	// TTLAttribute enables expiry on the attribute; empty leaves TTL unmanaged.
+	TTLAttribute string
+	// PointInTimeRecovery is nil when continuous backups are left unmanaged.
+	PointInTimeRecovery *bool
+	Indexes             []dynamoIndexSpec
+}
+
+func loadDynamoTableSpec(table string) dynamoTableSpec {
+	spec := dynamoTableSpec{
+		Table:         table,
+		ReadCapacity:  int64(envInt("DYNAMODB_READ_CAPACITY", 5)),
+		WriteCapacity: int64(envInt("DYNAMODB_WRITE_CAPACITY", 5)),
+		TTLAttribute:  strings.TrimSpace(os.Getenv("DYNAMODB_TTL_ATTRIBUTE")),
+		Indexes:       dynamoContentIndexes(loadDynamoListSettings()),
+	}
+	switch raw := strings.TrimSpace(os.Getenv("DYNAMODB_BILLING_MODE")); strings.ToUpper(raw) {
+	case "":
+	case "PAY_PER_REQUEST", "ON_DEMAND", "ON-DEMAND":
+		spec.BillingMode = types.BillingModePayPerRequest
+	case "PROVISIONED":
+		spec.BillingMode = types.BillingModeProvisioned
+	default:
+		slog.Warn("invalid billing mode, leaving it unmanaged", "name", "DYNAMODB_BILLING_MODE", "value", raw)
+	}
+	if raw := strings.TrimSpace(os.Getenv("DYNAMODB_POINT_IN_TIME_RECOVERY")); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err != nil {
+			slog.Warn("invalid boolean setting, leaving point-in-time recovery unmanaged", "name", "DYNAMODB_POINT_IN_TIME_RECOVERY", "value", raw)
+		} else {
+			spec.PointInTimeRecovery = &enabled
+		}
+	}
+	return spec
+}
+
+// createBillingMode is the billing mode of a new table.
+func (s dynamoTableSpec) createBillingMode() types.BillingMode {
+	if s.BillingMode == "" {
+		return types.BillingModePayPerRequest
+	}
+	return s.BillingMode
+}
+
+func (s dynamoTableSpec) throughput() *types.ProvisionedThroughput {
+	return s.throughputFor(s.BillingMode)
+}
+
+// throughputFor returns the configured capacity for a table or index billed in mode.
+func (s dynamoTableSpec) throughputFor(mode types.BillingMode) *types.ProvisionedThroughput {
+	if mode != types.BillingModeProvisioned {
+		return nil
+	}
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(s.ReadCapacity),
+		WriteCapacityUnits: aws.Int64(s.WriteCapacity),
+	}
+}
+
+// dynamoSchemaChange is one difference between the expected and the actual table.
+type dynamoSchemaChange struct {
+	// Action is "+" for additions, "~" for in-place updates and "!" for drift
+	// that has to be resolved by hand.
+	Action  string
+	Summary string
+	// apply brings the table in line, nil for manual changes.
+	apply func(ctx context.Context) error
+	// newTable is set on the changes that create and configure a missing table.
+	newTable bool
+}
+
+// dynamoTableManager compares the content table with its expected definition
+// and applies the difference.
+type dynamoTableManager struct {
+	client       dynamoSchemaAPI
+	spec         dynamoTableSpec
+	pollInterval time.Duration
+}
+
+func newDynamoTableManager(client dynamoSchemaAPI, spec dynamoTableSpec) *dynamoTableManager {
+	return &dynamoTableManager{client: client, spec: spec, pollInterval: 2 * time.Second}
+}
+
+// Plan returns the changes needed to bring the table in line with the spec
+// without modifying anything.
+func (m *dynamoTableManager) Plan(ctx context.Context) ([]dynamoSchemaChange, error) {
+	out, err := m.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(m.spec.Table)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return m.planCreate(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("describe table %s: %w", m.spec.Table, err)
+	}
+
+	table := out.Table
+	var changes []dynamoSchemaChange
+	if !keySchemaMatches(table.KeySchema, table.AttributeDefinitions, dynamoContentKey, dynamoKeyAttribute{}) {
+		changes = append(changes, dynamoSchemaChange{Action: "!", Summary: fmt.Sprintf("key schema differs from partition key %s, the table has to be recreated", dynamoContentKey)})
+	}
+	changes = append(changes, m.planBilling(table)...)
+	changes = append(changes, m.planIndexes(table)...)
+	backfill, err := m.planNameBackfill(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, backfill...)
+
+	ttl, err := m.planTTL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, ttl...)
+	pitr, err := m.planPointInTimeRecovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, pitr...), nil
+}
+
+func (m *dynamoTableManager) planCreate() []dynamoSchemaChange {
+	summary := fmt.Sprintf("create table %s (%s, partition key %s", m.spec.Table, m.spec.createBillingMode(), dynamoContentKey)
+	for _, index := range m.spec.Indexes {
+		summary += ", index " + index.Name
+	}
+	changes := []dynamoSchemaChange{{Action: "+", Summary: summary + ")", apply: m.createTable}}
+	if m.spec.TTLAttribute != "" {
+		changes = append(changes, m.ttlChange())
+	}
+	if m.spec.PointInTimeRecovery != nil && *m.spec.PointInTimeRecovery {
+		changes = append(changes, m.pointInTimeRecoveryChange(true))
+	}
+	for i := range changes {
+		changes[i].newTable = true
+	}
+	return changes
+}
+
+// tableBillingMode returns the billing mode of an existing table.
+func tableBillingMode(table *types.TableDescription) types.BillingMode {
+	// tables created before on-demand existed carry no billing mode summary
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != "" {
+		return table.BillingModeSummary.BillingMode
+	}
+	return types.BillingModeProvisioned
+}
+
+func (m *dynamoTableManager) planBilling(table *types.TableDescription) []dynamoSchemaChange {
+	if m.spec.BillingMode == "" {
+		return nil
+	}
+	actual := tableBillingMode(table)
+	if actual != m.spec.BillingMode {
+		return []dynamoSchemaChange{{
+			Action:  "~",
+			Summary: fmt.Sprintf("billing mode %s -> %s", actual, m.spec.BillingMode),
+			apply: func(ctx context.Context) error {
+				return m.updateBilling(ctx, table.GlobalSecondaryIndexes)
+			},
+		}}
+	}
+	if actual != types.BillingModeProvisioned || table.ProvisionedThroughput == nil {
+		return nil
+	}
+	read := aws.ToInt64(table.ProvisionedThroughput.ReadCapacityUnits)
+	write := aws.ToInt64(table.ProvisionedThroughput.WriteCapacityUnits)
+	if read == m.spec.ReadCapacity && write == m.spec.WriteCapacity {
+		return nil
+	}
+	return []dynamoSchemaChange{{
+		Action:  "~",
+		Summary: fmt.Sprintf("provisioned throughput read %d -> %d, write %d -> %d", read, m.spec.ReadCapacity, write, m.spec.WriteCapacity),
+		apply: func(ctx context.Context) error {
+			return m.updateBilling(ctx, nil)
+		},
+	}}
+}
+
+func (m *dynamoTableManager) planIndexes(table *types.TableDescription) []dynamoSchemaChange {
+	existing := make(map[string]types.GlobalSecondaryIndexDescription, len(table.GlobalSecondaryIndexes))
+	for _, index := range table.GlobalSecondaryIndexes {
+		existing[aws.ToString(index.IndexName)] = index
+	}
+	// new indexes are billed like the table once the billing changes are applied
+	mode := m.spec.BillingMode
+	if mode == "" {
+		mode = tableBillingMode(table)
+	}
+	var changes []dynamoSchemaChange
+	for _, index := range m.spec.Indexes {
+		actual, ok := existing[index.Name]
+		if !ok {
+			changes = append(changes, dynamoSchemaChange{
+				Action:  "+",
+				Summary: fmt.Sprintf("create index %s (partition key %s)", index.Name, index.PartitionKey),
+				apply: func(ctx context.Context) error {
+					return m.createIndex(ctx, index, m.spec.throughputFor(mode))
+				},
+			})
+			continue
+		}
+		if !keySchemaMatches(actual.KeySchema, table.AttributeDefinitions, index.PartitionKey, index.SortKey) {
+			changes = append(changes, dynamoSchemaChange{Action: "!", Summary: fmt.Sprintf("key schema of index %s differs, the index has to be dropped and recreated", index.Name)})
+		}
+	}
+	return changes
+}
+
+func (m *dynamoTableManager) planTTL(ctx context.Context) ([]dynamoSchemaChange, error) {
+	if m.spec.TTLAttribute == "" {
+		return nil, nil
+	}
+	out, err := m.client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(m.spec.Table)})
+	if err != nil {
+		return nil, fmt.Errorf("describe time to live of %s: %w", m.spec.Table, err)
+	}
+	var attribute string
+	var status types.TimeToLiveStatus
+	if out.TimeToLiveDescription != nil {
+		attribute = aws.ToString(out.TimeToLiveDescription.AttributeName)
+		status = out.TimeToLiveDescription.TimeToLiveStatus
+	}
+	switch {
+	case status != types.TimeToLiveStatusEnabled && status != types.TimeToLiveStatusEnabling:
+		return []dynamoSchemaChange{m.ttlChange()}, nil
+	case attribute != m.spec.TTLAttribute:
+		// DynamoDB allows one TTL change per hour, so switching attributes is left to an operator
+		return []dynamoSchemaChange{{Action: "!", Summary: fmt.Sprintf("TTL is enabled on %s instead of %s, disable it before switching", attribute, m.spec.TTLAttribute)}}, nil
+	}
+	return nil, nil
+}
+
+func (m *dynamoTableManager) planPointInTimeRecovery(ctx context.Context) ([]dynamoSchemaChange, error) {
+	if m.spec.PointInTimeRecovery == nil {
+		return nil, nil
+	}
+	out, err := m.client.DescribeContinuousBackups(ctx, &dynamodb.DescribeContinuousBackupsInput{TableName: aws.String(m.spec.Table)})
+	if err != nil {
+		return nil, fmt.Errorf("describe continuous backups of %s: %w", m.spec.Table, err)
+	}
+	enabled := false
+	if d := out.ContinuousBackupsDescription; d != nil && d.PointInTimeRecoveryDescription != nil {
+		enabled = d.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus == types.PointInTimeRecoveryStatusEnabled
+	}
+	if enabled == *m.spec.PointInTimeRecovery {
+		return nil, nil
+	}
+	return []dynamoSchemaChange{m.pointInTimeRecoveryChange(*m.spec.PointInTimeRecovery)}, nil
+}
+
+// Apply performs the changes in order and waits for the table and its indexes
+// to become ACTIVE after each of them. Nothing is changed when a manual change is pending.
+func (m *dynamoTableManager) Apply(ctx context.Context, changes []dynamoSchemaChange) error {
+	for _, change := range changes {
+		if change.apply == nil {
+			return fmt.Errorf("table %s: %s", m.spec.Table, change.Summary)
+		}
+	}
+	for _, change := range changes {
+		if err := change.apply(ctx); err != nil {
+			return fmt.Errorf("%s: %w", change.Summary, err)
+		}
+		if err := m.waitActive(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitActive polls the table until it and all of its indexes are ACTIVE.
+func (m *dynamoTableManager) waitActive(ctx context.Context) error {
+	for {
+		out, err := m.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(m.spec.Table)})
+		if err != nil {
+			return fmt.Errorf("describe table %s: %w", m.spec.Table, err)
+		}
+		active := out.Table.TableStatus == types.TableStatusActive
+		for _, index := range out.Table.GlobalSecondaryIndexes {
+			active = active && index.IndexStatus == types.IndexStatusActive
+		}
+		if active {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for table %s to become active: %w", m.spec.Table, ctx.Err())
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+func (m *dynamoTableManager) createTable(ctx context.Context) error {
+	input := &dynamodb.CreateTableInput{
+		TableName:             aws.String(m.spec.Table),
+		BillingMode:           m.spec.createBillingMode(),
+		ProvisionedThroughput: m.spec.throughput(),
+		KeySchema:             keySchema(dynamoContentKey, dynamoKeyAttribute{}),
+		AttributeDefinitions:  attributeDefinitions(append([]dynamoKeyAttribute{dynamoContentKey}, indexAttributes(m.spec.Indexes)...)),
+	}
+	// a new table has no items to backfill
+	if m.spec.nameIndexed() {
+		input.Tags = []types.Tag{dynamoNameBackfillTag}
+	}
+	for _, index := range m.spec.Indexes {
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+			IndexName:             aws.String(index.Name),
+			KeySchema:             keySchema(index.PartitionKey, index.SortKey),
+			Projection:            projection(index),
+			ProvisionedThroughput: m.spec.throughput(),
+		})
+	}
+	_, err := m.client.CreateTable(ctx, input)
+	return err
+}
+
+func (m *dynamoTableManager) createIndex(ctx context.Context, index dynamoIndexSpec, throughput *types.ProvisionedThroughput) error {
+	_, err := m.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:            aws.String(m.spec.Table),
+		AttributeDefinitions: attributeDefinitions(indexAttributes([]dynamoIndexSpec{index})),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+			Create: &types.CreateGlobalSecondaryIndexAction{
+				IndexName:             aws.String(index.Name),
+				KeySchema:             keySchema(index.PartitionKey, index.SortKey),
+				Projection:            projection(index),
+				ProvisionedThroughput: throughput,
+			},
+		}},
+	})
+	return err
+}
+
+// updateBilling switches the billing mode or capacity. Switching to
+// provisioned also has to set the capacity of the existing indexes.
+func (m *dynamoTableManager) updateBilling(ctx context.Context, indexes []types.GlobalSecondaryIndexDescription) error {
+	input := &dynamodb.UpdateTableInput{
+		TableName:             aws.String(m.spec.Table),
+		BillingMode:           m.spec.BillingMode,
+		ProvisionedThroughput: m.spec.throughput(),
+	}
+	if throughput := m.spec.throughput(); throughput != nil {
+		for _, index := range indexes {
+			input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, types.GlobalSecondaryIndexUpdate{
+				Update: &types.UpdateGlobalSecondaryIndexAction{IndexName: index.IndexName, ProvisionedThroughput: throughput},
+			})
+		}
+	}
+	_, err := m.client.UpdateTable(ctx, input)
+	return err
+}
+
+func (m *dynamoTableManager) ttlChange() dynamoSchemaChange {
+	attribute := m.spec.TTLAttribute
+	return dynamoSchemaChange{
+		Action:  "~",
+		Summary: "enable TTL on " + attribute,
+		apply: func(ctx context.Context) error {
+			_, err := m.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+				TableName: aws.String(m.spec.Table),
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
+					AttributeName: aws.String(attribute),
+					Enabled:       aws.Bool(true),
+				},
+			})
+			return err
+		},
+	}
+}
+
+func (m *dynamoTableManager) pointInTimeRecoveryChange(enabled bool) dynamoSchemaChange {
+	summary := "disable point-in-time recovery"
+	if enabled {
+		summary = "enable point-in-time recovery"
+	}
+	return dynamoSchemaChange{
+		Action:  "~",
+		Summary: summary,
+		apply: func(ctx context.Context) error {
+			for {
+				_, err := m.client.UpdateContinuousBackups(ctx, &dynamodb.UpdateContinuousBackupsInput{
+					TableName: aws.String(m.spec.Table),
+					PointInTimeRecoverySpecification: &types.PointInTimeRecoverySpecification{
+						PointInTimeRecoveryEnabled: aws.Bool(enabled),
+					},
+				})
+				// continuous backups become available shortly after the table is created
+				var unavailable *types.ContinuousBackupsUnavailableException
+				if !errors.As(err, &unavailable) {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(m.pollInterval):
+				}
+			}
+		},
+	}
+}
+
+func keySchema(partition, sort dynamoKeyAttribute) []types.KeySchemaElement {
+	schema := []types.KeySchemaElement{{AttributeName: aws.String(partition.Name), KeyType: types.KeyTypeHash}}
+	if sort.Name != "" {
+		schema = append(schema, types.KeySchemaElement{AttributeName: aws.String(sort.Name), KeyType: types.KeyTypeRange})
+	}
+	return schema
+}
+
+func keySchemaMatches(schema []types.KeySchemaElement, definitions []types.AttributeDefinition, partition, sort dynamoKeyAttribute) bool {
+	want := keySchema(partition, sort)
+	if len(schema) != len(want) {
+		return false
+	}
+	attributeTypes := make(map[string]types.ScalarAttributeType, len(definitions))
+	for _, def := range definitions {
+		attributeTypes[aws.ToString(def.AttributeName)] = def.AttributeType
+	}
+	for i, key := range []dynamoKeyAttribute{partition, sort}[:len(want)] {
+		if aws.ToString(schema[i].AttributeName) != key.Name || schema[i].KeyType != want[i].KeyType || attributeTypes[key.Name] != key.Type {
+			return false
+		}
+	}
+	return true
+}
+
+func indexAttributes(indexes []dynamoIndexSpec) []dynamoKeyAttribute {
+	var attributes []dynamoKeyAttribute
+	for _, index := range indexes {
+		attributes = append(attributes, index.PartitionKey)
+		if index.SortKey.Name != "" {
+			attributes = append(attributes, index.SortKey)
+		}
+	}
+	return attributes
+}
+
+func attributeDefinitions(attributes []dynamoKeyAttribute) []types.AttributeDefinition {
+	seen := map[string]bool{}
+	var definitions []types.AttributeDefinition
+	for _, attribute := range attributes {
+		if seen[attribute.Name] {
+			continue
+		}
+		seen[attribute.Name] = true
+		definitions = append(definitions, types.AttributeDefinition{AttributeName: aws.String(attribute.Name), AttributeType: attribute.Type})
+	}
+	return definitions
+}
+
+func projection(index dynamoIndexSpec) *types.Projection {
+	projectionType := index.Projection
+	if projectionType == "" {
+		projectionType = types.ProjectionTypeAll
+	}
+	return &types.Projection{ProjectionType: projectionType}
+}
+
+// bootstrapDynamoTable runs the bootstrap when DYNAMODB_BOOTSTRAP is enabled.
+func bootstrapDynamoTable(client dynamoSchemaAPI, table string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("DYNAMODB_BOOTSTRAP_TIMEOUT", 5*time.Minute))
+	defer cancel()
+	if err := newDynamoTableManager(client, loadDynamoTableSpec(table)).bootstrap(ctx); err != nil {
+		return fmt.Errorf("%w %s: %w", errDynamoBootstrap, table, err)
+	}
+	return nil
+}
+
+// bootstrap creates a missing table. On an existing table it only adds what
+// is missing, such as indexes; updates like billing or TTL changes are logged
+// and left to "dynamo apply". Replicas starting together wait for each
+// other's table and index creation instead of failing.
+func (m *dynamoTableManager) bootstrap(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		changes, err := m.Plan(ctx)
+		if err != nil {
+			return err
+		}
+		// manual changes stay in so Apply refuses to run against a mismatched table
+		var additions []dynamoSchemaChange
+		for _, change := range changes {
+			if change.newTable || change.Action != "~" {
+				additions = append(additions, change)
+			} else {
+				slog.Warn("dynamodb table differs, run dynamo apply to update it", "table", m.spec.Table, "change", change.Summary)
+			}
+		}
+		err = m.Apply(ctx, additions)
+		var inUse *types.ResourceInUseException
+		if errors.As(err, &inUse) && attempt < dynamoBootstrapAttempts {
+			// another replica is creating or updating the table
+			slog.Info("dynamodb table in use, waiting for it to become active", "table", m.spec.Table)
+			if err := m.waitActive(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, change := range additions {
+			slog.Info("dynamodb table updated", "table", m.spec.Table, "change", change.Summary)
+		}
+		return nil
+	}
+}
+
+// Dynamo implements the "dynamo" subcommand: "plan" (default) reports the
+// drift between the expected and the actual content table without changing
+// it and returns ErrDynamoSchemaDrift when there is any, "apply" resolves it.
+func Dynamo(args []string, out io.Writer) error {
+	configureLogging(os.Stdout)
+	command := "plan"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if command != "plan" && command != "apply" {
+		return fmt.Errorf("unknown dynamo command %q, expected plan or apply", command)
+	}
+	table := os.Getenv("DYNAMODB_TABLE")
+	if table == "" {
+		return fmt.Errorf("DYNAMODB_TABLE environment variable not set")
+	}
+	ctx := context.Background()
+	client, err := newDynamoClient(ctx, loadDynamoClientSettings())
+	if err != nil {
+		return err
+	}
+	return runDynamoCommand(ctx, newDynamoTableManager(client, loadDynamoTableSpec(table)), command, out)
+}
+
+func runDynamoCommand(ctx context.Context, manager *dynamoTableManager, command string, out io.Writer) error {
+	changes, err := manager.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(out, "table %s is up to date\n", manager.spec.Table)
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Fprintf(out, "%s %s\n", change.Action, change.Summary)
+	}
+	if command == "plan" {
+		return ErrDynamoSchemaDrift
+	}
+	if err := manager.Apply(ctx, changes); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "table %s is up to date\n", manager.spec.Table)
+	return nil
+}
@@ -0,0 +1,301 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var testNameIndex = dynamoIndexSpec{
+	Name:         "by_name",
+	PartitionKey: dynamoKeyAttribute{Name: "name", Type: types.ScalarAttributeTypeS},
+}
+
+func newTestTableManager(client dynamoSchemaAPI, spec dynamoTableSpec) *dynamoTableManager {
+	manager := newDynamoTableManager(client, spec)
+	manager.pollInterval = time.Millisecond
+	return manager
+}
+
+func summaries(changes []dynamoSchemaChange) string {
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.Action+" "+change.Summary)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func expectNoDrift(t *testing.T, manager *dynamoTableManager) {
+	t.Helper()
+	changes, err := manager.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no drift after apply, got:\n%s", summaries(changes))
+	}
+}
+
+func Test_dynamoTableManagerBootstrap(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	pitr := true
+	manager := newTestTableManager(fake, dynamoTableSpec{
+		Table:               "content",
+		BillingMode:         types.BillingModeProvisioned,
+		ReadCapacity:        10,
+		WriteCapacity:       2,
+		TTLAttribute:        "expires_at",
+		PointInTimeRecovery: &pitr,
+		Indexes:             []dynamoIndexSpec{testNameIndex},
+	})
+
+	changes, err := manager.Plan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "+ create table content (PROVISIONED, partition key id (S), index by_name)\n~ enable TTL on expires_at\n~ enable point-in-time recovery"
+	if got := summaries(changes); got != want {
+		t.Fatalf("unexpected plan:\n%s\nwant:\n%s", got, want)
+	}
+	if fake.callCount("CreateTable") != 0 {
+		t.Fatal("plan modified the table")
+	}
+	if err := manager.Apply(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	table := fake.table
+	if table.TableStatus != types.TableStatusActive || table.GlobalSecondaryIndexes[0].IndexStatus != types.IndexStatusActive {
+		t.Fatalf("apply returned before the table was active: %s", table.TableStatus)
+	}
+	if aws.ToInt64(table.ProvisionedThroughput.ReadCapacityUnits) != 10 || aws.ToInt64(table.ProvisionedThroughput.WriteCapacityUnits) != 2 {
+		t.Fatalf("unexpected throughput %+v", table.ProvisionedThroughput)
+	}
+	if aws.ToString(fake.ttl.AttributeName) != "expires_at" || !fake.pitr {
+		t.Fatalf("TTL or point-in-time recovery not enabled: %+v, %v", fake.ttl, fake.pitr)
+	}
+	expectNoDrift(t, manager)
+
+	// the created table works with the repository
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		fake.items = make(map[string]map[string]types.AttributeValue)
+		return newDynamoContentRepository(fake, "content")
+	})
+}
+
+func Test_dynamoTableManagerDrift(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	setup := newTestTableManager(fake, dynamoTableSpec{Table: "content", BillingMode: types.BillingModePayPerRequest})
+	if err := setup.Apply(ctx, setup.planCreate()); err != nil {
+		t.Fatal(err)
+	}
+	fake.pitr = true
+
+	pitr := false
+	manager := newTestTableManager(fake, dynamoTableSpec{
+		Table:               "content",
+		BillingMode:         types.BillingModeProvisioned,
+		ReadCapacity:        5,
+		WriteCapacity:       5,
+		TTLAttribute:        "expires_at",
+		PointInTimeRecovery: &pitr,
+		Indexes:             []dynamoIndexSpec{testNameIndex},
+	})
+	changes, err := manager.Plan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "~ billing mode PAY_PER_REQUEST -> PROVISIONED\n+ create index by_name (partition key name (S))\n~ enable TTL on expires_at\n~ disable point-in-time recovery"
+	if got := summaries(changes); got != want {
+		t.Fatalf("unexpected plan:\n%s\nwant:\n%s", got, want)
+	}
+	if err := manager.Apply(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+	expectNoDrift(t, manager)
+
+	manager.spec.ReadCapacity = 20
+	changes, err = manager.Plan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summaries(changes); got != "~ provisioned throughput read 5 -> 20, write 5 -> 5" {
+		t.Fatalf("unexpected plan %q", got)
+	}
+	if err := manager.Apply(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+	expectNoDrift(t, manager)
+}
+
+func Test_dynamoTableManagerManualDrift(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	fake.table = &types.TableDescription{
+		TableName:            aws.String("content"),
+		TableStatus:          types.TableStatusActive,
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash}},
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS}},
+		BillingModeSummary:   &types.BillingModeSummary{BillingMode: types.BillingModePayPerRequest},
+	}
+	fake.ttl = types.TimeToLiveDescription{AttributeName: aws.String("ttl"), TimeToLiveStatus: types.TimeToLiveStatusEnabled}
+
+	manager := newTestTableManager(fake, dynamoTableSpec{
+		Table:        "content",
+		BillingMode:  types.BillingModePayPerRequest,
+		TTLAttribute: "expires_at",
+		Indexes:      []dynamoIndexSpec{testNameIndex},
+	})
+	changes, err := manager.Plan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "! key schema differs from partition key id (S), the table has to be recreated\n+ create index by_name (partition key name (S))\n! TTL is enabled on ttl instead of expires_at, disable it before switching"
+	if got := summaries(changes); got != want {
+		t.Fatalf("unexpected plan:\n%s\nwant:\n%s", got, want)
+	}
+	if err := manager.Apply(ctx, changes); err == nil || !strings.Contains(err.Error(), "recreated") {
+		t.Fatalf("expected the manual change to fail apply, got %v", err)
+	}
+	if fake.callCount("UpdateTable") != 0 || fake.callCount("UpdateTimeToLive") != 0 {
+		t.Fatal("apply changed the table despite a manual change")
+	}
+}
+
+func Test_runDynamoCommand(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	manager := newTestTableManager(fake, dynamoTableSpec{Table: "content", BillingMode: types.BillingModePayPerRequest})
+
+	var out bytes.Buffer
+	if err := runDynamoCommand(ctx, manager, "plan", &out); !errors.Is(err, ErrDynamoSchemaDrift) {
+		t.Fatalf("expected ErrDynamoSchemaDrift, got %v", err)
+	}
+	if got := out.String(); got != "+ create table content (PAY_PER_REQUEST, partition key id (S))\n" {
+		t.Fatalf("unexpected plan output %q", got)
+	}
+
+	out.Reset()
+	if err := runDynamoCommand(ctx, manager, "apply", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "table content is up to date\n") {
+		t.Fatalf("unexpected apply output %q", out.String())
+	}
+
+	out.Reset()
+	if err := runDynamoCommand(ctx, manager, "plan", &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "table content is up to date\n" {
+		t.Fatalf("unexpected plan output %q", got)
+	}
+}
+
+func Test_loadDynamoTableSpec(t *testing.T) {
+	t.Setenv("DYNAMODB_BILLING_MODE", "provisioned")
+	t.Setenv("DYNAMODB_READ_CAPACITY", "7")
+	t.Setenv("DYNAMODB_WRITE_CAPACITY", "3")
+	t.Setenv("DYNAMODB_TTL_ATTRIBUTE", "expires_at")
+	t.Setenv("DYNAMODB_POINT_IN_TIME_RECOVERY", "true")
+	spec := loadDynamoTableSpec("content")
+	if spec.BillingMode != types.BillingModeProvisioned || spec.ReadCapacity != 7 || spec.WriteCapacity != 3 || spec.TTLAttribute != "expires_at" {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+	if spec.PointInTimeRecovery == nil || !*spec.PointInTimeRecovery {
+		t.Fatal("expected point-in-time recovery to be enabled")
+	}
+
+	t.Setenv("DYNAMODB_BILLING_MODE", "on_demand")
+	if spec = loadDynamoTableSpec("content"); spec.BillingMode != types.BillingModePayPerRequest {
+		t.Fatalf("unexpected billing mode %q", spec.BillingMode)
+	}
+
+	// billing of an existing table is only managed when configured
+	t.Setenv("DYNAMODB_BILLING_MODE", "bogus")
+	t.Setenv("DYNAMODB_POINT_IN_TIME_RECOVERY", "")
+	spec = loadDynamoTableSpec("content")
+	if spec.BillingMode != "" || spec.createBillingMode() != types.BillingModePayPerRequest || spec.PointInTimeRecovery != nil {
+		t.Fatalf("unexpected defaults %+v", spec)
+	}
+}
+
+func Test_dynamoTableManagerBootstrapExistingTable(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	setup := newTestTableManager(fake, dynamoTableSpec{Table: "content", BillingMode: types.BillingModeProvisioned, ReadCapacity: 3, WriteCapacity: 3})
+	if err := setup.Apply(ctx, setup.planCreate()); err != nil {
+		t.Fatal(err)
+	}
+
+	// billing is unmanaged and TTL is an update, so only the index is added
+	manager := newTestTableManager(fake, dynamoTableSpec{
+		Table:         "content",
+		ReadCapacity:  5,
+		WriteCapacity: 5,
+		TTLAttribute:  "expires_at",
+		Indexes:       []dynamoIndexSpec{testNameIndex},
+	})
+	if err := manager.bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if mode := tableBillingMode(fake.table); mode != types.BillingModeProvisioned {
+		t.Fatalf("bootstrap switched the billing mode to %s", mode)
+	}
+	if len(fake.table.GlobalSecondaryIndexes) != 1 || fake.callCount("UpdateTable") != 1 {
+		t.Fatalf("expected the index to be created with a single update, got %d calls", fake.callCount("UpdateTable"))
+	}
+	if fake.callCount("UpdateTimeToLive") != 0 {
+		t.Fatal("bootstrap enabled TTL on an existing table")
+	}
+	changes, err := manager.Plan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summaries(changes); got != "~ enable TTL on expires_at" {
+		t.Fatalf("unexpected remaining drift %q", got)
+	}
+}
+
+// racingSchemaClient creates the table on behalf of another replica right
+// before the first CreateTable call.
+type racingSchemaClient struct {
+	*fakeDynamoDB
+	other *dynamoTableManager
+	raced bool
+}
+
+func (c *racingSchemaClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if !c.raced {
+		c.raced = true
+		if err := c.other.createTable(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return c.fakeDynamoDB.CreateTable(ctx, params, optFns...)
+}
+
+func Test_dynamoTableManagerBootstrapConcurrentReplicas(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	spec := dynamoTableSpec{Table: "content", TTLAttribute: "expires_at", Indexes: []dynamoIndexSpec{testNameIndex}}
+	client := &racingSchemaClient{fakeDynamoDB: fake, other: newTestTableManager(fake, spec)}
+	if err := newTestTableManager(client, spec).bootstrap(ctx); err != nil {
+		t.Fatalf("losing the CreateTable race failed the bootstrap: %v", err)
+	}
+	if fake.callCount("CreateTable") != 2 || fake.table.TableStatus != types.TableStatusActive {
+		t.Fatalf("expected a lost CreateTable race and an active table, got %d calls and %s", fake.callCount("CreateTable"), fake.table.TableStatus)
+	}
+	if len(fake.table.GlobalSecondaryIndexes) != 1 {
+		t.Fatalf("unexpected indexes %+v", fake.table.GlobalSecondaryIndexes)
+	}
+}
@@ -3,14 +3,14 @@ package app
 import (
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 )
 
 // default http response handler
 func handler(w http.ResponseWriter, r *http.Request) {
-	log.Print("helloworld: defaultHandler received a request - " + getIPAddress(r))
+	requestLogger(r).Info("defaultHandler received a request")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, response+"\n"+os.Getenv("HOSTNAME"))
 }
@@ -1,13 +1,221 @@
 package app
 
 import (
+    "context"
+    "log/slog"
+    "net"
     "net/http"
+    "os"
+    "runtime/debug"
+    "strconv"
     "strings"
+    "time"
 )
 
-// function to get IP address from http header - example below for custom CloudFlare X-Forwarder-For header
+// default proxies trusted to report the client address (loopback only, e.g. a sidecar)
+const defaultTrustedProxies = "127.0.0.0/8,::1/128"
+
+// default forwarding header read from trusted proxies
+const defaultClientIPHeader = "X-Forwarded-For"
+
+type clientIPContextKey struct{}
+
+// trusted proxy networks whose forwarding header is honoured
+var trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+
+// the single forwarding header the trusted proxies set
+var clientIPHeader = parseClientIPHeader(os.Getenv("CLIENT_IP_HEADER"))
+
+// function to parse the comma-separated TRUSTED_PROXIES cidr list, "none" disables header trust
+func parseTrustedProxies(raw string) []*net.IPNet {
+    raw = strings.TrimSpace(raw)
+    if raw == "" {
+        raw = defaultTrustedProxies
+    }
+    if strings.EqualFold(raw, "none") {
+        return nil
+    }
+    var networks []*net.IPNet
+    for _, part := range strings.Split(raw, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        if !strings.Contains(part, "/") {
+            if ip := net.ParseIP(part); ip != nil && ip.To4() != nil {
+                part += "/32"
+            } else {
+                part += "/128"
+            }
+        }
+        _, network, err := net.ParseCIDR(part)
+        if err != nil {
+            slog.Warn("ignoring invalid trusted proxy", "proxy", part, "error", err)
+            continue
+        }
+        networks = append(networks, network)
+    }
+    return networks
+}
+
+// function to parse the CLIENT_IP_HEADER setting, only headers with a known format are accepted
+func parseClientIPHeader(raw string) string {
+    raw = strings.TrimSpace(raw)
+    if raw == "" {
+        return defaultClientIPHeader
+    }
+    header := http.CanonicalHeaderKey(raw)
+    switch header {
+    case "Forwarded", "X-Forwarded-For", "X-Real-Ip", "Cf-Connecting-Ip":
+        return header
+    }
+    slog.Warn("unsupported client IP header, using default", "header", raw, "default", defaultClientIPHeader)
+    return defaultClientIPHeader
+}
+
+// function to check if the ip belongs to a trusted proxy
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+    for _, network := range trusted {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// function to parse a single address from a forwarding header, stripping quotes, brackets and ports
+func parseForwardedIP(value string) net.IP {
+    value = strings.Trim(strings.TrimSpace(value), `"`)
+    if host, _, err := net.SplitHostPort(value); err == nil {
+        value = host
+    }
+    value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+    return net.ParseIP(value)
+}
+
+// function to collect the "for" addresses of the RFC 7239 Forwarded header in hop order
+func forwardedChain(r *http.Request) []string {
+    var chain []string
+    for _, header := range r.Header.Values("Forwarded") {
+        for _, element := range strings.Split(header, ",") {
+            for _, pair := range strings.Split(element, ";") {
+                key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+                if ok && strings.EqualFold(key, "for") {
+                    chain = append(chain, value)
+                }
+            }
+        }
+    }
+    return chain
+}
+
+// function to collect the addresses of a comma-separated header such as X-Forwarded-For in hop order
+func headerChain(r *http.Request, header string) []string {
+    if header == "Forwarded" {
+        return forwardedChain(r)
+    }
+    var chain []string
+    for _, value := range r.Header.Values(header) {
+        chain = append(chain, strings.Split(value, ",")...)
+    }
+    return chain
+}
+
+// function to resolve the client address: the configured header is only honoured when the
+// direct peer is a trusted proxy, and its chain is walked right to left skipping trusted hops
+// because hops left of the last trusted proxy may have been supplied by the client
+func resolveClientIP(r *http.Request, trusted []*net.IPNet, header string) string {
+    remote := parseForwardedIP(r.RemoteAddr)
+    if remote == nil {
+        return ""
+    }
+    if !isTrustedProxy(remote, trusted) {
+        return remote.String()
+    }
+    chain := headerChain(r, header)
+    client := remote
+    for i := len(chain) - 1; i >= 0; i-- {
+        ip := parseForwardedIP(chain[i])
+        if ip == nil {
+            break
+        }
+        client = ip
+        if !isTrustedProxy(ip, trusted) {
+            break
+        }
+    }
+    return client.String()
+}
+
+// ClientIPHandler resolves the client address once per request and stores it in the request context
+func ClientIPHandler(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ip := resolveClientIP(r, trustedProxies, clientIPHeader)
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip)))
+    })
+}
+
+// function to get the client IP address resolved by ClientIPHandler, resolving it on demand otherwise
 func getIPAddress(r *http.Request) string {
-    ip := strings.TrimSpace(r.Header.Get("CF-Connecting-IP"))
-    return ip
+    if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+        return ip
+    }
+    return resolveClientIP(r, trustedProxies, clientIPHeader)
+}
+
+// function to read boolean feature flags from the environment
+func envBool(name string) bool {
+    switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+    case "1", "true", "yes", "on":
+        return true
+    }
+    return false
 }
 
+// function to read integer settings from the environment with a default value
+func envInt(name string, def int) int {
+    raw := strings.TrimSpace(os.Getenv(name))
+    if raw == "" {
+        return def
+    }
+    value, err := strconv.Atoi(raw)
+    if err != nil {
+        slog.Warn("invalid integer setting, using default", "name", name, "value", raw, "default", def)
+        return def
+    }
+    return value
+}
+
+// function to read duration settings from the environment with a default value
+func envDuration(name string, def time.Duration) time.Duration {
+    raw := strings.TrimSpace(os.Getenv(name))
+    if raw == "" {
+        return def
+    }
+    value, err := time.ParseDuration(raw)
+    if err != nil {
+        slog.Warn("invalid duration setting, using default", "name", name, "value", raw, "default", def)
+        return def
+    }
+    return value
+}
+
+// function to get the application version, preferring the ldflags provided build version
+func serviceVersion() string {
+    if buildVersion != "" {
+        return buildVersion
+    }
+    if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+        return info.Main.Version
+    }
+    return "dev"
+}
+
+// function to get the pod hostname with a fallback to the kernel hostname
+func hostname() string {
+    if name := os.Getenv("HOSTNAME"); name != "" {
+        return name
+    }
+    name, _ := os.Hostname()
+    return name
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func Test_resolveClientIP(t *testing.T) {
+    trusted := parseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+    tests := []struct {
+        name       string
+        remoteAddr string
+        header     string
+        headers    map[string]string
+        expected   string
+    }{
+        {"Direct client", "203.0.113.7:4711", "X-Forwarded-For", nil, "203.0.113.7"},
+        {"Untrusted peer spoofing headers", "203.0.113.7:4711", "X-Forwarded-For", map[string]string{
+            "X-Forwarded-For": "198.51.100.1",
+        }, "203.0.113.7"},
+        {"X-Forwarded-For through trusted proxies", "10.1.2.3:80", "X-Forwarded-For", map[string]string{
+            "X-Forwarded-For": "198.51.100.9, 203.0.113.50, 192.0.2.1",
+        }, "203.0.113.50"},
+        {"Client supplied Forwarded is ignored", "10.1.2.3:80", "X-Forwarded-For", map[string]string{
+            "Forwarded":       `for="[2001:db8::1]:4711"`,
+            "X-Forwarded-For": "198.51.100.9",
+        }, "198.51.100.9"},
+        {"Other headers are ignored", "10.1.2.3:80", "X-Forwarded-For", map[string]string{
+            "X-Real-IP":        "198.51.100.3",
+            "CF-Connecting-IP": "198.51.100.4",
+        }, "10.1.2.3"},
+        {"Forwarded", "10.1.2.3:80", "Forwarded", map[string]string{
+            "Forwarded":       `for=198.51.100.9, for="[2001:db8::1]:4711";proto=https, for=192.0.2.1`,
+            "X-Forwarded-For": "198.51.100.5",
+        }, "2001:db8::1"},
+        {"X-Real-IP", "10.1.2.3:80", "X-Real-Ip", map[string]string{
+            "X-Real-IP":       "198.51.100.3",
+            "X-Forwarded-For": "198.51.100.5",
+        }, "198.51.100.3"},
+        {"CF-Connecting-IP", "10.1.2.3:80", "Cf-Connecting-Ip", map[string]string{
+            "CF-Connecting-IP": "198.51.100.4",
+        }, "198.51.100.4"},
+        {"Trusted peer without headers", "10.1.2.3:80", "X-Forwarded-For", nil, "10.1.2.3"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := httptest.NewRequest("GET", "/", nil)
+            req.RemoteAddr = tt.remoteAddr
+            for k, v := range tt.headers {
+                req.Header.Set(k, v)
+            }
+            if got := resolveClientIP(req, trusted, tt.header); got != tt.expected {
+                t.Errorf("resolveClientIP() = %q, want %q", got, tt.expected)
+            }
+        })
+    }
+}
+
+func Test_clientIPDefaults(t *testing.T) {
+    for _, ip := range []string{"10.1.2.3", "172.16.0.1", "192.168.1.1", "fd00::1"} {
+        if isTrustedProxy(net.ParseIP(ip), parseTrustedProxies("")) {
+            t.Errorf("%s is trusted by default", ip)
+        }
+    }
+    if !isTrustedProxy(net.ParseIP("127.0.0.1"), parseTrustedProxies("")) {
+        t.Error("loopback is not trusted by default")
+    }
+    for raw, want := range map[string]string{"": "X-Forwarded-For", "forwarded": "Forwarded", "x-real-ip": "X-Real-Ip", "X-Client-IP": "X-Forwarded-For"} {
+        if got := parseClientIPHeader(raw); got != want {
+            t.Errorf("parseClientIPHeader(%q) = %q, want %q", raw, got, want)
+        }
+    }
+}
+
+func Test_ClientIPHandler(t *testing.T) {
+    var got string
+    h := ClientIPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        r.Header.Set("CF-Connecting-IP", "198.51.100.77")
+        got = getIPAddress(r)
+    }))
+    req := httptest.NewRequest("GET", "/", nil)
+    req.RemoteAddr = "203.0.113.7:4711"
+    h.ServeHTTP(httptest.NewRecorder(), req)
+    if got != "203.0.113.7" {
+        t.Errorf("getIPAddress() = %q, want %q", got, "203.0.113.7")
+    }
+}
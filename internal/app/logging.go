@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// logLevel can be changed at runtime; it is initialised from LOG_LEVEL.
+var logLevel = new(slog.LevelVar)
+
+// configureLogging installs a JSON (default) or text slog handler according to
+// LOG_FORMAT and LOG_LEVEL. The standard library logger is routed through it.
+// Run and the subcommands call it first, before anything is logged.
+func configureLogging(w io.Writer) *slog.Logger {
+	logLevel.Set(parseLogLevel(os.Getenv("LOG_LEVEL")))
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT"))) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger
+}
+
+func parseLogLevel(raw string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// fatal logs the error and terminates the process.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// requestInfo collects request-scoped log fields as they become known while
+// the request travels through the middleware chain.
+type requestInfo struct {
+	requestID    string
+	traceID      string
+	traceSampled bool
+	route        string
+	user         string
+}
+
+type requestInfoContextKey struct{}
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey{}).(*requestInfo)
+	return info
+}
+
+// requestLogger returns a logger carrying the request ID, trace ID, route
+// template, authenticated user and client IP of the request.
+func requestLogger(r *http.Request) *slog.Logger {
+	attrs := []any{}
+	if info := requestInfoFromContext(r.Context()); info != nil {
+		if info.requestID != "" {
+			attrs = append(attrs, slog.String("request_id", info.requestID))
+		}
+		if info.traceID != "" {
+			attrs = append(attrs, slog.String("trace_id", info.traceID))
+		}
+		if info.route != "" {
+			attrs = append(attrs, slog.String("route", info.route))
+		}
+		if info.user != "" {
+			attrs = append(attrs, slog.String("user", info.user))
+		}
+	}
+	if ip := getIPAddress(r); ip != "" {
+		attrs = append(attrs, slog.String("client_ip", ip))
+	}
+	return slog.Default().With(attrs...)
+}
+
+// sensitiveHeaders are never written to the logs verbatim.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Csrf-Token":        true,
+	"X-Api-Key":           true,
+}
+
+// redactedHeaders renders the headers as a log group with sensitive values masked.
+func redactedHeaders(h http.Header) slog.Attr {
+	attrs := make([]any, 0, len(h))
+	for name, values := range h {
+		canonical := http.CanonicalHeaderKey(name)
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[canonical] || (rateLimitAPIKeyHeader() != "" && canonical == http.CanonicalHeaderKey(rateLimitAPIKeyHeader())) {
+			value = "[REDACTED]"
+		}
+		attrs = append(attrs, slog.String(canonical, value))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+func rateLimitAPIKeyHeader() string {
+	return getRateLimiter().apiKeyHeader
+}
+
+// LoggingHandler writes one access log line per request and makes the
+// request-scoped fields available to requestLogger.
+func LoggingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{
+			requestID: requestIDFromContext(r.Context()),
+		}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoContextKey{}, info))
+		delegate := &responseWriterDelegator{ResponseWriter: w}
+
+		next.ServeHTTP(delegate, r)
+
+		status := delegate.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("proto", r.Proto),
+			slog.Int("status", status),
+			slog.Int64("bytes", delegate.written),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if referer := r.Referer(); referer != "" {
+			attrs = append(attrs, slog.String("referer", referer))
+		}
+		logger := requestLogger(r)
+		if logger.Enabled(r.Context(), slog.LevelDebug) {
+			attrs = append(attrs, redactedHeaders(r.Header))
+		}
+		logger.LogAttrs(r.Context(), level, "request completed", attrs...)
+	})
+}
+
+// RouteLoggingHandler records the matched route template for the access log.
+func RouteLoggingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := requestInfoFromContext(r.Context()); info != nil {
+			if route := mux.CurrentRoute(r); route != nil {
+				info.route, _ = route.GetPathTemplate()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
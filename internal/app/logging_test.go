@@ -0,0 +1,68 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_LoggingHandler(t *testing.T) {
+	resetRepository()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	router := mux.NewRouter()
+	router.Use(RouteLoggingHandler)
+	router.HandleFunc("/api/v1/content/{id}", basicAuth(getSingleContent)).Methods("GET")
+	handler := ClientIPHandler(RequestIDHandler(LoggingHandler(router)))
+
+	req := httptest.NewRequest("GET", "/api/v1/content/7", nil)
+	req.RemoteAddr = "203.0.113.7:4711"
+	req.Header.Set("X-Request-Id", "req-123")
+	req.Header.Set("Cookie", "token=secret-cookie")
+	req.SetBasicAuth(username, password)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(buf.String(), "secret-cookie") || strings.Contains(buf.String(), req.Header.Get("Authorization")) {
+		t.Fatalf("sensitive headers leaked into logs: %s", buf.String())
+	}
+
+	var access map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		if entry["msg"] == "request completed" {
+			access = entry
+		}
+	}
+	if access == nil {
+		t.Fatalf("no access log entry written: %s", buf.String())
+	}
+	expected := map[string]any{
+		"request_id": "req-123",
+		"route":      "/api/v1/content/{id}",
+		"user":       username,
+		"client_ip":  "203.0.113.7",
+		"method":     "GET",
+		"status":     float64(http.StatusNotFound),
+	}
+	for key, want := range expected {
+		if access[key] != want {
+			t.Errorf("access log %s = %v, want %v", key, access[key], want)
+		}
+	}
+	headers, _ := access["headers"].(map[string]any)
+	if headers["Authorization"] != "[REDACTED]" || headers["Cookie"] != "[REDACTED]" {
+		t.Errorf("sensitive headers not redacted: %v", headers)
+	}
+}
@@ -1,21 +1,21 @@
 package app
 
 import (
+    "context"
     "fmt"
-    "github.com/gorilla/handlers"
     "github.com/gorilla/mux"
-    opentracing "github.com/opentracing/opentracing-go"
     "github.com/prometheus/client_golang/prometheus"
     "github.com/prometheus/client_golang/prometheus/promhttp"
-    "log"
+    "log/slog"
     "net/http"
     "os"
 )
 
 // all constant variables
 const (
-    contentRoot = "/content"
-    contentID   = "/content/{id}"
+    contentRoot  = "/content"
+    contentID    = "/content/{id}"
+    contentBatch = "/content:batch"
 )
 
 // default variables and data access object
@@ -27,6 +27,8 @@ var (
     // http ports
     httpPort    = os.Getenv("PORT")
     metricsPort = os.Getenv("METRICSPORT")
+    // build version set at link time, e.g. -ldflags "-X <module>/internal/app.buildVersion=v1.2.3"
+    buildVersion = ""
 )
 
 // init function to populate runtime variables and defaults
@@ -50,17 +52,30 @@ func init() {
 }
 
 func Run() {
-    // initialize tracer and servicename
-    tracer, closer := initTracer(serviceName)
-    opentracing.SetGlobalTracer(tracer)
-    defer closer.Close()
-    // application version displayed in prometheus
-    version.Set(0.1)
+    configureLogging(os.Stdout)
+    // initialize opentelemetry tracer provider and servicename
+    shutdownTracer, err := initTracer(context.Background(), serviceName)
+    if err != nil {
+        fatal("tracer initialisation failed", err)
+    }
+    defer shutdownTracer(context.Background())
+    // application version and revision displayed in prometheus
+    setBuildInfo()
+    cleanupRepository := configureContentRepository()
+    defer cleanupRepository()
     cleanupPublisher := configureContentPublisher()
     defer cleanupPublisher()
-    log.Print("helloworld: is starting...")
+    // trace and measure content repository and publisher calls
+    setContentRepository(newMetricsContentRepository(newTracingContentRepository(getContentRepository())))
+    setContentPublisher(newMetricsContentPublisher(newTracingContentPublisher(getContentPublisher())))
+    // cache hits are served in front of the traced and measured repository
+    cleanupCache := configureContentCache()
+    defer cleanupCache()
+    configureLoginGuard()
+    configureRateLimiter()
+    slog.Info("helloworld is starting", "service", serviceName, "log_level", logLevel.Level().String())
     // log the running UID/GID for visibility in non-root environments
-    log.Printf("helloworld: running as uid=%d gid=%d", os.Getuid(), os.Getgid())
+    slog.Info("running as", "uid", os.Getuid(), "gid", os.Getgid())
     // prometheus registry filtering the exported metrics
     registry := prometheus.NewRegistry()
     registry.MustRegister(httpRequestDuration)
@@ -68,21 +83,71 @@ func Run() {
     registry.MustRegister(httpRequestsResponseTime)
     registry.MustRegister(httpRequestSizeBytes)
     registry.MustRegister(httpResponseSizeBytes)
-    registry.MustRegister(version)
+    registry.MustRegister(buildInfo)
+    registry.MustRegister(httpRequestsInFlight)
+    registry.MustRegister(authFailuresTotal)
+    registry.MustRegister(authLockoutsTotal)
+    registry.MustRegister(httpRequestsRateLimited)
+    registry.MustRegister(contentMetrics()...)
+    // opt-in go runtime and process metrics
+    diagnostics := loadDiagnosticsSettings()
+    registerRuntimeMetrics(registry, diagnostics)
     // http request router for /metrics path to be not exposed through main root path
     routerInternal := mux.NewRouter()
-    routerInternal.Path("/metrics").Handler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+    routerInternal.Path("/metrics").Handler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
     // exposing healthz and readyz handlers via internal router
     routerInternal.HandleFunc("/healthz", healthz)
     routerInternal.HandleFunc("/readyz", readyz)
+    // opt-in pprof, runtime trace and profile capture endpoints
+    registerDiagnostics(routerInternal, diagnostics)
     // main request router for rest-api
+    router := newRouter()
+    // native tls settings for the public and internal listeners
+    tlsConf, err := loadTLSSettings(false)
+    if err != nil {
+        fatal("error loading tls settings", err)
+    }
+    metricsTLSConf, err := loadTLSSettings(true)
+    if err != nil {
+        fatal("error loading metrics tls settings", err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    // function to start internal request router on port TCP 9100 (default)
+    go func() {
+        slog.Info("metrics listening", "port", metricsPort, "tls", metricsTLSConf.enabled())
+        metricsServer := &http.Server{Addr: fmt.Sprintf(":%s", metricsPort), Handler: routerInternal}
+        if err := serveHTTP(ctx, metricsServer, metricsTLSConf); err != nil {
+            fatal("error starting metrics http server", err)
+            return
+        }
+    }()
+    // structured access logging for external request router, resolving the client ip and request id first
+    loggingRouter := ClientIPHandler(RequestIDHandler(LoggingHandler(router)))
+    // main request router to expose default handlers and api versions on port TCP 8080 (default)
+    slog.Info("listening", "port", httpPort, "tls", tlsConf.enabled())
+    server := &http.Server{Addr: fmt.Sprintf(":%s", httpPort), Handler: loggingRouter}
+    if err := serveHTTP(ctx, server, tlsConf); err != nil {
+        fatal("error starting http server", err)
+        return
+    }
+}
+
+// function to build the public request router with all api versions, proxy and static routes
+func newRouter() *mux.Router {
     router := mux.NewRouter()
     // prometheus middleware handlers to capture application metrics
     router.Use(InstrumentHandler)
+    // record the matched route template for request logs
+    router.Use(RouteLoggingHandler)
+    // per-client rate limiting for all matched routes
+    router.Use(RateLimitHandler)
     // default response handler
     router.HandleFunc("/", handler)
-    // static file http handler (served from /static inside container)
-    router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("/static/"))))
+    // static file http handler (embedded web/static, STATIC_DIR overrides it during development)
+    router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", newStaticFileServer(staticAssets(), true)))
+    // embedded api explorer loading /api/openapi.json
+    registerDocs(router)
     // reverse proxy server
     var proxy = router.PathPrefix("/proxy").Subrouter()
     for _, conf := range configuration {
@@ -99,13 +164,16 @@ func Run() {
     api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusNotFound)
     })
+    // openapi description of the v1 and v2 api
+    api.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
     // version 1 of the api using basicAuth
     var v1 = api.PathPrefix("/v1").Subrouter()
-    v1.Handle(contentRoot, tracingHandler(basicAuth(getIndexContent))).Methods("GET")
-    v1.Handle(contentRoot, tracingHandler(basicAuth(createContent))).Methods("POST")
-    v1.Handle(contentID, tracingHandler(basicAuth(getSingleContent))).Methods("GET")
-    v1.Handle(contentID, tracingHandler(basicAuth(updateContent))).Methods("PUT")
-    v1.Handle(contentID, tracingHandler(basicAuth(deleteContent))).Methods("DELETE")
+    v1.Handle(contentRoot, authenticated(tracingHandler(basicAuth(getIndexContent)))).Methods("GET")
+    v1.Handle(contentRoot, authenticated(tracingHandler(basicAuth(createContent)))).Methods("POST")
+    v1.Handle(contentBatch, authenticated(tracingHandler(basicAuth(batchContent)))).Methods("POST")
+    v1.Handle(contentID, authenticated(tracingHandler(basicAuth(getSingleContent)))).Methods("GET")
+    v1.Handle(contentID, authenticated(tracingHandler(basicAuth(updateContent)))).Methods("PUT")
+    v1.Handle(contentID, authenticated(tracingHandler(basicAuth(deleteContent)))).Methods("DELETE")
     v1.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusNotFound)
     })
@@ -113,29 +181,19 @@ func Run() {
     var v2 = api.PathPrefix("/v2").Subrouter()
     v2.HandleFunc("/login", jwtLogin).Methods("POST")
     v2.HandleFunc("/logout", jwtLogout).Methods("POST")
-    v2.HandleFunc("/refresh", jwtAuth(jwtRefresh)).Methods("POST")
-    v2.Handle(contentRoot, tracingHandler(jwtAuth(getIndexContent))).Methods("GET")
-    v2.Handle(contentRoot, tracingHandler(jwtAuth(createContent))).Methods("POST")
-    v2.Handle(contentID, tracingHandler(jwtAuth(getSingleContent))).Methods("GET")
-    v2.Handle(contentID, tracingHandler(jwtAuth(updateContent))).Methods("PUT")
-    v2.Handle(contentID, tracingHandler(jwtAuth(deleteContent))).Methods("DELETE")
+    v2.Handle("/refresh", authenticated(jwtAuth(jwtRefresh))).Methods("POST")
+    v2.Handle(contentRoot, authenticated(tracingHandler(jwtAuth(getIndexContent)))).Methods("GET")
+    v2.Handle(contentRoot, authenticated(tracingHandler(jwtAuth(createContent)))).Methods("POST")
+    v2.Handle(contentBatch, authenticated(tracingHandler(jwtAuth(batchContent)))).Methods("POST")
+    v2.Handle(contentID, authenticated(tracingHandler(jwtAuth(getSingleContent)))).Methods("GET")
+    v2.Handle(contentID, authenticated(tracingHandler(jwtAuth(updateContent)))).Methods("PUT")
+    v2.Handle(contentID, authenticated(tracingHandler(jwtAuth(deleteContent)))).Methods("DELETE")
     v2.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusNotFound)
     })
-    // function to start internal request router on port TCP 9100 (default)
-    go func() {
-        log.Printf("helloworld: metrics listening on port %s", metricsPort)
-        if err := http.ListenAndServe(fmt.Sprintf(":%s", metricsPort), routerInternal); err != nil {
-            log.Fatal("error starting metrics http server : ", err)
-            return
-        }
-    }()
-    // enable mux request logging handler for external request router
-    loggingRouter := handlers.CombinedLoggingHandler(os.Stdout, router)
-    // main request router to expose default handlers and api versions on port TCP 8080 (default)
-    log.Printf("helloworld: listening on port %s", httpPort)
-    if err := http.ListenAndServe(fmt.Sprintf(":%s", httpPort), loggingRouter); err != nil {
-        log.Fatal("error starting http server : ", err)
-        return
+    // measure 404 and 405 responses, which bypass the router middleware
+    for _, r := range []*mux.Router{router, proxy, api, v1, v2} {
+        instrumentUnmatched(r)
     }
+    return router
 }
@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// error classes used as metric label values
+const (
+	errorClassNotFound  = "not_found"
+	errorClassConflict  = "conflict"
+	errorClassThrottled = "throttled"
+	errorClassOther     = "other"
+)
+
+// throttlingErrorCodes are the AWS API error codes returned when DynamoDB throttles a request.
+var throttlingErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"RequestLimitExceeded":                   true,
+	"ThrottlingException":                    true,
+}
+
+// errorClass maps an error to a bounded set of metric label values.
+func errorClass(err error) string {
+	var apiErr smithy.APIError
+	switch {
+	case errors.Is(err, ErrContentNotFound):
+		return errorClassNotFound
+	case errors.Is(err, ErrContentAlreadyExists):
+		return errorClassConflict
+	case errors.Is(err, kafka.ThrottlingQuotaExceeded):
+		return errorClassThrottled
+	case errors.As(err, &apiErr) && throttlingErrorCodes[apiErr.ErrorCode()]:
+		return errorClassThrottled
+	}
+	return errorClassOther
+}
+
+// contentRepositoryUnwrapper is implemented by repository decorators so the
+// backend can be identified through any number of wrappers.
+type contentRepositoryUnwrapper interface {
+	unwrap() ContentRepository
+}
+
+func baseContentRepository(repo ContentRepository) ContentRepository {
+	for {
+		wrapper, ok := repo.(contentRepositoryUnwrapper)
+		if !ok {
+			return repo
+		}
+		repo = wrapper.unwrap()
+	}
+}
+
+// contentRepositoryBackend names the repository backend for metric labels.
+func contentRepositoryBackend(repo ContentRepository) string {
+	switch base := baseContentRepository(repo).(type) {
+	case *dynamoContentRepository:
+		return "dynamodb"
+	case *sqlContentRepository:
+		return base.dialect.name
+	case *redisContentRepository:
+		return "redis"
+	case *inMemoryRepository:
+		return "memory"
+	}
+	return "unknown"
+}
+
+// contentPublisherUnwrapper is the ContentPublisher counterpart of contentRepositoryUnwrapper.
+type contentPublisherUnwrapper interface {
+	unwrap() ContentPublisher
+}
+
+func baseContentPublisher(p ContentPublisher) ContentPublisher {
+	for {
+		wrapper, ok := p.(contentPublisherUnwrapper)
+		if !ok {
+			return p
+		}
+		p = wrapper.unwrap()
+	}
+}
+
+// contentPublisherBackend names the publisher backend for metric labels.
+func contentPublisherBackend(p ContentPublisher) string {
+	switch baseContentPublisher(p).(type) {
+	case *kafkaPublisher:
+		return "kafka"
+	case *noopPublisher:
+		return "noop"
+	}
+	return "unknown"
+}
+
+// metricsContentRepository records latency, errors and in-flight calls per operation.
+type metricsContentRepository struct {
+	next    ContentRepository
+	backend string
+}
+
+func newMetricsContentRepository(next ContentRepository) ContentRepository {
+	return &metricsContentRepository{next: next, backend: contentRepositoryBackend(next)}
+}
+
+func (m *metricsContentRepository) unwrap() ContentRepository {
+	return m.next
+}
+
+// observe starts timing an operation and returns the function recording its outcome.
+func (m *metricsContentRepository) observe(operation string) func(error) {
+	inFlight := contentRepositoryInFlight.WithLabelValues(m.backend)
+	inFlight.Inc()
+	start := time.Now()
+	return func(err error) {
+		inFlight.Dec()
+		contentRepositoryDuration.WithLabelValues(m.backend, operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			contentRepositoryErrors.WithLabelValues(m.backend, operation, errorClass(err)).Inc()
+		}
+	}
+}
+
+func (m *metricsContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	done := m.observe("list")
+	items, err := m.next.ListContent(ctx)
+	done(err)
+	return items, err
+}
+
+func (m *metricsContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	done := m.observe("list_by_name_prefix")
+	items, err := m.next.ListContentByNamePrefix(ctx, prefix)
+	done(err)
+	return items, err
+}
+
+func (m *metricsContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	done := m.observe("get")
+	item, err := m.next.GetContent(ctx, id)
+	done(err)
+	return item, err
+}
+
+func (m *metricsContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	done := m.observe("create")
+	created, err := m.next.CreateContent(ctx, item)
+	done(err)
+	return created, err
+}
+
+func (m *metricsContentRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	done := m.observe("update")
+	updated, err := m.next.UpdateContent(ctx, id, name)
+	done(err)
+	return updated, err
+}
+
+func (m *metricsContentRepository) DeleteContent(ctx context.Context, id string) error {
+	done := m.observe("delete")
+	err := m.next.DeleteContent(ctx, id)
+	done(err)
+	return err
+}
+
+// BatchContent records the batch as one operation; per-item conflicts and
+// missing ids are regular outcomes and not counted as errors.
+func (m *metricsContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	done := m.observe("batch")
+	results, err := m.next.BatchContent(ctx, ops)
+	done(err)
+	return results, err
+}
+
+// metricsContentPublisher records latency, errors and in-flight publishes.
+type metricsContentPublisher struct {
+	next    ContentPublisher
+	backend string
+}
+
+func newMetricsContentPublisher(next ContentPublisher) ContentPublisher {
+	return &metricsContentPublisher{next: next, backend: contentPublisherBackend(next)}
+}
+
+func (m *metricsContentPublisher) unwrap() ContentPublisher {
+	return m.next
+}
+
+func (m *metricsContentPublisher) Publish(ctx context.Context, item api) error {
+	done := m.observe()
+	err := m.next.Publish(ctx, item)
+	done(err)
+	return err
+}
+
+func (m *metricsContentPublisher) PublishBatch(ctx context.Context, items []api) error {
+	done := m.observe()
+	err := m.next.PublishBatch(ctx, items)
+	done(err)
+	return err
+}
+
+// observe starts timing a publish and returns the function recording its outcome.
+func (m *metricsContentPublisher) observe() func(error) {
+	inFlight := contentPublisherInFlight.WithLabelValues(m.backend)
+	inFlight.Inc()
+	start := time.Now()
+	return func(err error) {
+		inFlight.Dec()
+		contentPublisherDuration.WithLabelValues(m.backend).Observe(time.Since(start).Seconds())
+		if err != nil {
+			contentPublisherErrors.WithLabelValues(m.backend, errorClass(err)).Inc()
+		}
+	}
+}
+
+func (m *metricsContentPublisher) Close() error {
+	return m.next.Close()
+}
+
+// contentMetrics lists the collectors of the decorators for registration in Run.
+func contentMetrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		contentRepositoryDuration,
+		contentRepositoryErrors,
+		contentRepositoryInFlight,
+		contentPublisherDuration,
+		contentPublisherErrors,
+		contentPublisherInFlight,
+		contentCacheRequests,
+		contentCacheEvictions,
+		contentCacheEntries,
+	}
+}
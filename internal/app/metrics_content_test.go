@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/segmentio/kafka-go"
+)
+
+func Test_errorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"Not found", fmt.Errorf("get: %w", ErrContentNotFound), errorClassNotFound},
+		{"Conflict", ErrContentAlreadyExists, errorClassConflict},
+		{"DynamoDB throttling", &smithy.GenericAPIError{Code: "ProvisionedThroughputExceededException"}, errorClassThrottled},
+		{"Kafka throttling", kafka.ThrottlingQuotaExceeded, errorClassThrottled},
+		{"Other", errors.New("connection reset"), errorClassOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.want {
+				t.Errorf("unexpected error class: got %s want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// sampleCount returns the number of observations of a histogram series.
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := observer.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_metricsContentRepository(t *testing.T) {
+	repo := newMetricsContentRepository(newTracingContentRepository(newInMemoryRepository(allContent{{ID: "1", Name: "Measured"}})))
+	ctx := context.Background()
+
+	gets := sampleCount(t, contentRepositoryDuration.WithLabelValues("memory", "get"))
+	creates := sampleCount(t, contentRepositoryDuration.WithLabelValues("memory", "create"))
+	notFound := testutil.ToFloat64(contentRepositoryErrors.WithLabelValues("memory", "get", errorClassNotFound))
+	conflict := testutil.ToFloat64(contentRepositoryErrors.WithLabelValues("memory", "create", errorClassConflict))
+
+	repo.GetContent(ctx, "1")
+	repo.GetContent(ctx, "missing")
+	repo.CreateContent(ctx, api{ID: "1", Name: "Duplicate"})
+
+	if got := testutil.ToFloat64(contentRepositoryErrors.WithLabelValues("memory", "get", errorClassNotFound)) - notFound; got != 1 {
+		t.Errorf("unexpected not found errors: got %v want 1", got)
+	}
+	if got := testutil.ToFloat64(contentRepositoryErrors.WithLabelValues("memory", "create", errorClassConflict)) - conflict; got != 1 {
+		t.Errorf("unexpected conflict errors: got %v want 1", got)
+	}
+	if got := sampleCount(t, contentRepositoryDuration.WithLabelValues("memory", "get")) - gets; got != 2 {
+		t.Errorf("unexpected get latency observations: got %v want 2", got)
+	}
+	if got := sampleCount(t, contentRepositoryDuration.WithLabelValues("memory", "create")) - creates; got != 1 {
+		t.Errorf("unexpected create latency observations: got %v want 1", got)
+	}
+	if got := testutil.ToFloat64(contentRepositoryInFlight.WithLabelValues("memory")); got != 0 {
+		t.Errorf("unexpected in-flight operations: got %v want 0", got)
+	}
+}
+
+// failingPublisher fails every publish with err, or succeeds when err is nil.
+type failingPublisher struct {
+	err error
+}
+
+func (f *failingPublisher) Publish(context.Context, api) error {
+	return f.err
+}
+
+func (f *failingPublisher) PublishBatch(context.Context, []api) error {
+	return f.err
+}
+
+func (f *failingPublisher) Close() error {
+	return nil
+}
+
+func Test_metricsContentPublisher(t *testing.T) {
+	fake := &failingPublisher{}
+	pub := newMetricsContentPublisher(fake)
+	ctx := context.Background()
+
+	publishes := sampleCount(t, contentPublisherDuration.WithLabelValues("unknown"))
+	throttled := testutil.ToFloat64(contentPublisherErrors.WithLabelValues("unknown", errorClassThrottled))
+	other := testutil.ToFloat64(contentPublisherErrors.WithLabelValues("unknown", errorClassOther))
+
+	if err := pub.Publish(ctx, api{ID: "1", Name: "Measured"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.PublishBatch(ctx, []api{{ID: "2", Name: "Measured"}, {ID: "3", Name: "Measured"}}); err != nil {
+		t.Fatal(err)
+	}
+	fake.err = kafka.ThrottlingQuotaExceeded
+	if err := pub.Publish(ctx, api{ID: "4", Name: "Throttled"}); !errors.Is(err, kafka.ThrottlingQuotaExceeded) {
+		t.Fatalf("publish error was not passed on: %v", err)
+	}
+	fake.err = errors.New("broker unreachable")
+	if err := pub.PublishBatch(ctx, []api{{ID: "5", Name: "Failed"}}); err == nil {
+		t.Fatal("batch error was not passed on")
+	}
+
+	if got := sampleCount(t, contentPublisherDuration.WithLabelValues("unknown")) - publishes; got != 4 {
+		t.Errorf("unexpected publish latency observations: got %v want 4", got)
+	}
+	if got := testutil.ToFloat64(contentPublisherErrors.WithLabelValues("unknown", errorClassThrottled)) - throttled; got != 1 {
+		t.Errorf("unexpected throttled errors: got %v want 1", got)
+	}
+	if got := testutil.ToFloat64(contentPublisherErrors.WithLabelValues("unknown", errorClassOther)) - other; got != 1 {
+		t.Errorf("unexpected other errors: got %v want 1", got)
+	}
+	if got := testutil.ToFloat64(contentPublisherInFlight.WithLabelValues("unknown")); got != 0 {
+		t.Errorf("unexpected in-flight publishes: got %v want 0", got)
+	}
+}
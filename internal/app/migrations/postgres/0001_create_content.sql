@@ -0,0 +1,4 @@
+CREATE TABLE content (
+    id   TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
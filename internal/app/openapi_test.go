@@ -0,0 +1,342 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// openAPIDocument is the decoded spec with helpers to resolve local $refs.
+type openAPIDocument map[string]any
+
+func loadOpenAPIDocument(t *testing.T) openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Fatalf("unexpected openapi version %v", doc["openapi"])
+	}
+	return doc
+}
+
+// resolve follows a "#/..." $ref until a non-reference object is reached.
+func (d openAPIDocument) resolve(node map[string]any) (map[string]any, error) {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node, nil
+		}
+		var current any = map[string]any(d)
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, ok := current.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("unresolvable $ref %s", ref)
+			}
+			current = m[part]
+		}
+		next, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+		node = next
+	}
+}
+
+func (d openAPIDocument) operations() map[string]map[string]any {
+	ops := make(map[string]map[string]any)
+	for path, item := range d["paths"].(map[string]any) {
+		for method, op := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			ops[strings.ToUpper(method)+" "+path] = op.(map[string]any)
+		}
+	}
+	return ops
+}
+
+// validate checks value against the subset of JSON schema used by the spec.
+func (d openAPIDocument) validate(schema map[string]any, value any, at string) error {
+	schema, err := d.resolve(schema)
+	if err != nil {
+		return err
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, value)
+		}
+		for _, name := range asSlice(schema["required"]) {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for name, v := range obj {
+			prop, ok := props[name].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: unexpected property %q", at, name)
+				}
+				continue
+			}
+			if err := d.validate(prop, v, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, value)
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, v := range arr {
+			if err := d.validate(items, v, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, value)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected number, got %T", at, value)
+		}
+	}
+	return nil
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+// checkResponse validates a recorded response against the operation's declared responses.
+func (d openAPIDocument) checkResponse(op map[string]any, rr *httptest.ResponseRecorder) error {
+	responses := op["responses"].(map[string]any)
+	declared, ok := responses[fmt.Sprint(rr.Code)].(map[string]any)
+	if !ok {
+		return fmt.Errorf("status %d is not declared", rr.Code)
+	}
+	response, err := d.resolve(declared)
+	if err != nil {
+		return err
+	}
+	content, _ := response["content"].(map[string]any)
+	if len(content) == 0 {
+		if rr.Body.Len() != 0 {
+			return fmt.Errorf("status %d declares no body but got %q", rr.Code, rr.Body.String())
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid content type %q", rr.Header().Get("Content-Type"))
+	}
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		return fmt.Errorf("content type %s is not declared for status %d", mediaType, rr.Code)
+	}
+	if mediaType != "application/json" {
+		return nil
+	}
+	var body any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		return fmt.Errorf("body is not JSON: %v", err)
+	}
+	return d.validate(media["schema"].(map[string]any), body, "body")
+}
+
+// routeOperations returns the openapi operations a route serves. Prefix
+// routes serve the files below them as {path}, and routes without a method
+// restriction are documented by their GET operation. Subrouters serve nothing.
+func routeOperations(route *mux.Route) []string {
+	if route.GetHandler() == nil {
+		return nil
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	if pattern, err := route.GetPathRegexp(); err == nil && !strings.HasSuffix(pattern, "$") {
+		path += "{path}"
+	}
+	methods, err := route.GetMethods()
+	if err != nil {
+		methods = []string{"GET"}
+	}
+	ops := make([]string, len(methods))
+	for i, method := range methods {
+		ops[i] = method + " " + path
+	}
+	return ops
+}
+
+func Test_openAPIRoutes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	registered := map[string]bool{}
+	err := newRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		for _, op := range routeOperations(route) {
+			registered[op] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := doc.operations()
+	var missing, stale []string
+	for op := range registered {
+		if _, ok := documented[op]; !ok {
+			missing = append(missing, op)
+		}
+	}
+	for op := range documented {
+		if !registered[op] {
+			stale = append(stale, op)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	if len(missing) > 0 {
+		t.Errorf("routes missing from openapi.json: %v", missing)
+	}
+	if len(stale) > 0 {
+		t.Errorf("openapi.json documents unregistered routes: %v", stale)
+	}
+}
+
+func Test_openAPIContract(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+	operations := doc.operations()
+	resetRepository()
+	resetContentPublisher()
+	defer setLoginGuard(getLoginGuard())
+	setLoginGuard(newLoginGuardFromEnv(newInMemoryLoginAttemptStore()))
+	router := newRouter()
+	handler := RequestIDHandler(LoggingHandler(router))
+
+	serve := func(method, path, body string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if auth != nil {
+			auth(req)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	login := serve("POST", "/api/v2/login", `{"username":"user1","password":"password1"}`, nil)
+	var session, csrf string
+	for _, c := range login.Result().Cookies() {
+		switch c.Name {
+		case "token":
+			session = c.Value
+		case csrfCookieName:
+			csrf = c.Value
+		}
+	}
+	if session == "" || csrf == "" {
+		t.Fatalf("login did not issue a session: %d", login.Code)
+	}
+
+	basic := func(req *http.Request) { req.SetBasicAuth(username, password) }
+	wrongBasic := func(req *http.Request) { req.SetBasicAuth(username, "wrong") }
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+session) }
+	cookieWithoutCSRF := func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "token", Value: session}) }
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		auth   func(*http.Request)
+		want   int
+	}{
+		{"GET", "/", "", nil, http.StatusOK},
+		{"GET", "/static/", "", nil, http.StatusOK},
+		{"GET", "/static/missing.css", "", nil, http.StatusNotFound},
+		{"GET", "/docs", "", nil, http.StatusMovedPermanently},
+		{"GET", "/docs/explorer.css", "", nil, http.StatusOK},
+		{"GET", "/api/openapi.json", "", nil, http.StatusOK},
+		{"POST", "/api/v1/content", `{"id":"contract-1","name":"Contract"}`, basic, http.StatusCreated},
+		{"POST", "/api/v1/content", `{"id":"contract-1","name":"Contract"}`, basic, http.StatusConflict},
+		{"GET", "/api/v1/content", "", basic, http.StatusOK},
+		{"GET", "/api/v1/content?name_prefix=Contr", "", basic, http.StatusOK},
+		{"GET", "/api/v1/content", "", wrongBasic, http.StatusUnauthorized},
+		{"GET", "/api/v1/content/contract-1", "", basic, http.StatusOK},
+		{"GET", "/api/v1/content/missing", "", basic, http.StatusNotFound},
+		{"PUT", "/api/v1/content/contract-1", `{"name":"Renamed"}`, basic, http.StatusOK},
+		{"PUT", "/api/v1/content/missing", `{"name":"Renamed"}`, basic, http.StatusNotFound},
+		{"DELETE", "/api/v1/content/contract-1", "", basic, http.StatusOK},
+		{"DELETE", "/api/v1/content/contract-1", "", basic, http.StatusNotFound},
+		{"POST", "/api/v1/content:batch", `{"operations":[{"op":"create","id":"batch-1","name":"Batch"},{"op":"upsert","id":"batch-2","name":"Batch"},{"op":"delete","id":"missing"}]}`, basic, http.StatusOK},
+		{"POST", "/api/v1/content:batch", `{"operations":[]}`, basic, http.StatusBadRequest},
+		{"POST", "/api/v2/login", `{"username":"user1","password":"wrong"}`, nil, http.StatusUnauthorized},
+		{"POST", "/api/v2/login", `not json`, nil, http.StatusBadRequest},
+		{"POST", "/api/v2/refresh", "", bearer, http.StatusOK},
+		{"POST", "/api/v2/refresh", "", nil, http.StatusUnauthorized},
+		{"POST", "/api/v2/content", `{"id":"contract-2","name":"Contract"}`, bearer, http.StatusCreated},
+		{"POST", "/api/v2/content", `{"id":"contract-3","name":"Contract"}`, cookieWithoutCSRF, http.StatusForbidden},
+		{"GET", "/api/v2/content", "", bearer, http.StatusOK},
+		{"GET", "/api/v2/content?name_prefix=Contr", "", bearer, http.StatusOK},
+		{"GET", "/api/v2/content", "", nil, http.StatusUnauthorized},
+		{"GET", "/api/v2/content/contract-2", "", bearer, http.StatusOK},
+		{"GET", "/api/v2/content/missing", "", bearer, http.StatusNotFound},
+		{"PUT", "/api/v2/content/contract-2", `{"name":"Renamed"}`, bearer, http.StatusOK},
+		{"DELETE", "/api/v2/content/contract-2", "", bearer, http.StatusOK},
+		{"DELETE", "/api/v2/content/contract-2", "", bearer, http.StatusNotFound},
+		{"POST", "/api/v2/content:batch", `{"operations":[{"op":"create","id":"batch-1","name":"Batch"},{"op":"delete","id":"batch-2"}]}`, bearer, http.StatusOK},
+		{"POST", "/api/v2/content:batch", `not json`, bearer, http.StatusBadRequest},
+		{"POST", "/api/v2/logout", "", nil, http.StatusOK},
+	}
+	covered := map[string]bool{"POST /api/v2/login": true}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s %d", tt.method, tt.path, tt.want), func(t *testing.T) {
+			rr := serve(tt.method, tt.path, tt.body, tt.auth)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status code: got %d want %d (%s)", rr.Code, tt.want, rr.Body.String())
+			}
+			var match mux.RouteMatch
+			if !router.Match(httptest.NewRequest(tt.method, tt.path, nil), &match) {
+				t.Fatal("request did not match a route")
+			}
+			var key string
+			for _, routeOp := range routeOperations(match.Route) {
+				if strings.HasPrefix(routeOp, tt.method+" ") {
+					key = routeOp
+				}
+			}
+			op, ok := operations[key]
+			if !ok {
+				t.Fatalf("operation %s %s is not documented", tt.method, tt.path)
+			}
+			covered[key] = true
+			if err := doc.checkResponse(op, rr); err != nil {
+				t.Fatalf("response violates openapi.json: %v", err)
+			}
+		})
+	}
+	for op, spec := range operations {
+		// the proxy routes would reach out to the real upstreams
+		if tags := asSlice(spec["tags"]); len(tags) > 0 && tags[0] == "proxy" {
+			continue
+		}
+		if !covered[op] {
+			t.Errorf("operation %s is not exercised by the contract test", op)
+		}
+	}
+}
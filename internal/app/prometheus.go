@@ -4,24 +4,37 @@ import (
     "github.com/gorilla/mux"
     "github.com/prometheus/client_golang/prometheus"
     "net/http"
+    "runtime"
+    "runtime/debug"
     "strconv"
     "strings"
     "time"
 )
 
+// route label used for requests without a matched route template
+const unmatchedRoute = "unmatched"
+
 var (
-    appName = string("helloworld")
-    version = prometheus.NewGauge(prometheus.GaugeOpts{
-        Name:        "version",
-        Help:        "Version information about this binary",
+    appName   = string("helloworld")
+    buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name:        "build_info",
+        Help:        "Build information about this binary, the value is always 1.",
         ConstLabels: map[string]string{"appName": appName},
-    })
+    },
+        []string{"version", "revision", "goversion"})
     httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-        Name:    "http_request_duration_seconds",
-        Help:    "Duration of all HTTP requests",
-        Buckets: prometheus.LinearBuckets(0.01, 0.05, 10),
+        Name:                            "http_request_duration_seconds",
+        Help:                            "Duration of all HTTP requests",
+        Buckets:                         prometheus.LinearBuckets(0.01, 0.05, 10),
+        NativeHistogramBucketFactor:     nativeHistogramBucketFactor(),
+        NativeHistogramMaxBucketNumber:  160,
+        NativeHistogramMinResetDuration: time.Hour,
     },
         []string{"method", "code", "path"})
+    httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "http_requests_in_flight",
+        Help: "HTTP requests currently being served.",
+    })
     httpRequestsResponseTime = prometheus.NewSummary(prometheus.SummaryOpts{
         Namespace: "http",
         Name:      "response_time_seconds",
@@ -42,32 +55,167 @@ var (
         Help: "Summary of response bytes sent",
     },
         []string{"code", "method", "path"})
+    httpRequestsRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "http_requests_rate_limited_total",
+        Help: "How many HTTP requests were rejected by the rate limiter, partitioned by HTTP path.",
+    },
+        []string{"path"})
+    authFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "auth_failures_total",
+        Help: "How many logins failed, partitioned by authentication method and reason.",
+    },
+        []string{"method", "reason"})
+    authLockoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "auth_lockouts_total",
+        Help: "How many temporary lockouts were imposed, partitioned by authentication method and scope.",
+    },
+        []string{"method", "scope"})
+    contentRepositoryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "content_repository_operation_duration_seconds",
+        Help:    "Duration of content repository operations, partitioned by backend and operation.",
+        Buckets: prometheus.DefBuckets,
+    },
+        []string{"backend", "operation"})
+    contentRepositoryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "content_repository_errors_total",
+        Help: "How many content repository operations failed, partitioned by backend, operation and error class.",
+    },
+        []string{"backend", "operation", "class"})
+    contentRepositoryInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "content_repository_in_flight_operations",
+        Help: "Content repository operations currently in progress, partitioned by backend.",
+    },
+        []string{"backend"})
+    contentPublisherDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "content_publisher_publish_duration_seconds",
+        Help:    "Duration of content event publishes, partitioned by publisher backend.",
+        Buckets: prometheus.DefBuckets,
+    },
+        []string{"backend"})
+    contentPublisherErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "content_publisher_errors_total",
+        Help: "How many content event publishes failed, partitioned by publisher backend and error class.",
+    },
+        []string{"backend", "class"})
+    contentPublisherInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "content_publisher_in_flight_publishes",
+        Help: "Content event publishes currently in progress, partitioned by publisher backend.",
+    },
+        []string{"backend"})
+    contentCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "content_cache_requests_total",
+        Help: "How many content cache lookups were made, partitioned by result (hit, negative_hit, miss).",
+    },
+        []string{"result"})
+    contentCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "content_cache_evictions_total",
+        Help: "How many content cache entries were removed, partitioned by reason (capacity, expired, invalidated).",
+    },
+        []string{"reason"})
+    contentCacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "content_cache_entries",
+        Help: "Number of entries currently held in the content cache.",
+    })
 )
 
+// native histograms are opt-in via METRICS_NATIVE_HISTOGRAMS as scrapers need to negotiate protobuf
+func nativeHistogramBucketFactor() float64 {
+    if envBool("METRICS_NATIVE_HISTOGRAMS") {
+        return 1.1
+    }
+    return 0
+}
+
+// function to set the build_info metric from the ldflags version and the embedded vcs information
+func setBuildInfo() {
+    revision, goVersion := "unknown", runtime.Version()
+    if info, ok := debug.ReadBuildInfo(); ok {
+        for _, setting := range info.Settings {
+            if setting.Key == "vcs.revision" {
+                revision = setting.Value
+            }
+        }
+    }
+    buildInfo.Reset()
+    buildInfo.WithLabelValues(serviceVersion(), revision, goVersion).Set(1)
+}
+
+// function to get the matched route template, collapsing unknown routes to a fixed label
+func routeLabel(r *http.Request) string {
+    route := mux.CurrentRoute(r)
+    if route == nil {
+        return unmatchedRoute
+    }
+    path, err := route.GetPathTemplate()
+    if err != nil || path == "" {
+        return unmatchedRoute
+    }
+    return path
+}
+
+// function to measure the responses for requests without a matching route or method under
+// the unmatched label, router middleware only runs for matched routes
+func instrumentUnmatched(router *mux.Router) {
+    unmatched := func(*http.Request) string { return unmatchedRoute }
+    if router.NotFoundHandler == nil {
+        router.NotFoundHandler = http.NotFoundHandler()
+    }
+    router.NotFoundHandler = instrument(router.NotFoundHandler, unmatched)
+    if router.MethodNotAllowedHandler == nil {
+        router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(http.StatusMethodNotAllowed)
+        })
+    }
+    router.MethodNotAllowedHandler = instrument(router.MethodNotAllowedHandler, unmatched)
+}
+
 func InstrumentHandler(next http.Handler) http.Handler {
+    return instrument(next, routeLabel)
+}
+
+// function to measure next, labelling the requests with the path returned by label
+func instrument(next http.Handler, label func(*http.Request) string) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         start := time.Now()
+        httpRequestsInFlight.Inc()
+        defer httpRequestsInFlight.Dec()
 
         delegate := &responseWriterDelegator{ResponseWriter: w}
         rw := delegate
 
         next.ServeHTTP(rw, r)
 
-        route := mux.CurrentRoute(r)
-        path, _ := route.GetPathTemplate()
-        code := strconv.Itoa(delegate.status)
+        duration := time.Since(start).Seconds()
+        path := label(r)
+        status := delegate.status
+        if status == 0 {
+            status = http.StatusOK
+        }
+        code := strconv.Itoa(status)
         method := strings.ToLower(r.Method)
 
-        httpRequestsResponseTime.Observe(float64(time.Since(start).Seconds()))
+        httpRequestsResponseTime.Observe(duration)
         httpRequestsTotal.WithLabelValues(code, method, path).Inc()
         httpRequestSizeBytes.WithLabelValues(code, method, path).Observe(float64(estimateRequestSize(r)))
         httpResponseSizeBytes.WithLabelValues(code, method, path).Observe(float64(delegate.written))
-        timer := prometheus.NewTimer(httpRequestDuration.WithLabelValues(method, code, path))
-        timer.ObserveDuration()
-
+        observer := httpRequestDuration.WithLabelValues(method, code, path)
+        // link the observation to the request trace when the span was sampled
+        if traceID := sampledTraceID(r); traceID != "" {
+            observer.(prometheus.ExemplarObserver).ObserveWithExemplar(duration, prometheus.Labels{"trace_id": traceID})
+            return
+        }
+        observer.Observe(duration)
     })
 }
 
+// function to get the trace id recorded by tracingHandler for sampled requests
+func sampledTraceID(r *http.Request) string {
+    if info := requestInfoFromContext(r.Context()); info != nil && info.traceSampled {
+        return info.traceID
+    }
+    return ""
+}
+
 type responseWriterDelegator struct {
     http.ResponseWriter
     status      int
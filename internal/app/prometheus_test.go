@@ -1,25 +1,30 @@
 package app
 
 import (
+    "context"
     "net/http"
     "net/http/httptest"
     "strings"
     "testing"
+    "time"
 
     "github.com/gorilla/mux"
     "github.com/prometheus/client_golang/prometheus"
     "github.com/prometheus/client_golang/prometheus/promhttp"
+    "github.com/prometheus/client_golang/prometheus/testutil"
+    dto "github.com/prometheus/client_model/go"
 )
 
 func Test_InstrumentHandler(t *testing.T) {
-
     r := prometheus.NewRegistry()
     r.MustRegister(httpRequestDuration)
     r.MustRegister(httpRequestsTotal)
     r.MustRegister(httpRequestsResponseTime)
     r.MustRegister(httpRequestSizeBytes)
     r.MustRegister(httpResponseSizeBytes)
-    r.MustRegister(version)
+    r.MustRegister(buildInfo)
+    r.MustRegister(httpRequestsInFlight)
+    setBuildInfo()
 
     router := mux.NewRouter()
     router.Path("/metrics").Handler(promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
@@ -61,10 +66,107 @@ func Test_InstrumentHandler(t *testing.T) {
             t.Errorf("body does not contain request duration entry '%s'", "http_response_size_bytes")
         }
     })
-    t.Run("Check version", func(t *testing.T) {
-        if !strings.Contains(body, "version") {
-            t.Errorf("body does not contain request duration entry '%s'", "versions")
+    t.Run("Check build_info", func(t *testing.T) {
+        if !strings.Contains(body, "build_info") {
+            t.Errorf("body does not contain build info entry '%s'", "build_info")
+        }
+    })
+    t.Run("Check http_requests_in_flight", func(t *testing.T) {
+        if !strings.Contains(body, "http_requests_in_flight") {
+            t.Errorf("body does not contain in flight entry '%s'", "http_requests_in_flight")
+        }
+    })
+}
+
+func Test_InstrumentHandlerDuration(t *testing.T) {
+    router := mux.NewRouter()
+    router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+        time.Sleep(20 * time.Millisecond)
+    })
+    router.Use(InstrumentHandler)
+
+    traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+    req, err := http.NewRequest("GET", "/slow", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    info := &requestInfo{traceID: traceID, traceSampled: true}
+    req = req.WithContext(context.WithValue(req.Context(), requestInfoContextKey{}, info))
+    router.ServeHTTP(httptest.NewRecorder(), req)
+
+    metric := &dto.Metric{}
+    if err := httpRequestDuration.WithLabelValues("get", "200", "/slow").(prometheus.Metric).Write(metric); err != nil {
+        t.Fatal(err)
+    }
+    t.Run("Check measured duration", func(t *testing.T) {
+        if got := metric.GetHistogram().GetSampleSum(); got < 0.02 {
+            t.Errorf("request duration not measured: got %v want >= 0.02", got)
+        }
+    })
+    t.Run("Check trace exemplar", func(t *testing.T) {
+        found := false
+        for _, bucket := range metric.GetHistogram().GetBucket() {
+            for _, label := range bucket.GetExemplar().GetLabel() {
+                if label.GetName() == "trace_id" && label.GetValue() == traceID {
+                    found = true
+                }
+            }
+        }
+        if !found {
+            t.Errorf("histogram has no exemplar for trace %s", traceID)
         }
     })
 }
 
+func Test_InstrumentUnmatched(t *testing.T) {
+    router := newRouter()
+    tests := []struct {
+        method string
+        path   string
+    }{
+        {"GET", "/does/not/exist"},
+        {"GET", "/api/v1/unknown"},
+        {"PATCH", "/api/v1/content"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+            counter := httpRequestsTotal.WithLabelValues("404", strings.ToLower(tt.method), unmatchedRoute)
+            before := testutil.ToFloat64(counter)
+            rr := httptest.NewRecorder()
+            router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+            if rr.Code != http.StatusNotFound {
+                t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusNotFound)
+            }
+            if got := testutil.ToFloat64(counter) - before; got != 1 {
+                t.Errorf("404 response not measured as unmatched: got %v want 1", got)
+            }
+        })
+    }
+
+    t.Run("Method not allowed", func(t *testing.T) {
+        router := mux.NewRouter()
+        router.Use(InstrumentHandler)
+        router.HandleFunc("/get-only", handler).Methods("GET")
+        instrumentUnmatched(router)
+        counter := httpRequestsTotal.WithLabelValues("405", "post", unmatchedRoute)
+        before := testutil.ToFloat64(counter)
+        rr := httptest.NewRecorder()
+        router.ServeHTTP(rr, httptest.NewRequest("POST", "/get-only", nil))
+        if rr.Code != http.StatusMethodNotAllowed {
+            t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusMethodNotAllowed)
+        }
+        if got := testutil.ToFloat64(counter) - before; got != 1 {
+            t.Errorf("405 response not measured as unmatched: got %v want 1", got)
+        }
+    })
+}
+
+func Test_routeLabel(t *testing.T) {
+    req, err := http.NewRequest("GET", "/does/not/exist", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := routeLabel(req); got != unmatchedRoute {
+        t.Errorf("unexpected route label: got %s want %s", got, unmatchedRoute)
+    }
+}
@@ -2,6 +2,8 @@ package app
 
 import (
     "github.com/gorilla/mux"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/propagation"
     "net"
     "net/http"
     "net/http/httputil"
@@ -64,6 +66,11 @@ func generateProxy(conf config) http.Handler {
         contentID, _ := mux.Vars(r)["id"]
 
         r.Header.Add("X-Forwarded-Host", r.Host)
+        if id := requestIDFromContext(r.Context()); id != "" {
+            r.Header.Set(requestIDHeader, id)
+        }
+        // continue the trace at the upstream
+        otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
         r.Header.Add("X-Origin-Host", originHost)
         r.Host = originHost
         r.URL.Host = originHost
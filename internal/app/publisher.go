@@ -8,6 +8,8 @@ import (
 // ContentPublisher emits events whenever a content record is created.
 type ContentPublisher interface {
 	Publish(ctx context.Context, item api) error
+	// PublishBatch emits one event per item in a single round-trip.
+	PublishBatch(ctx context.Context, items []api) error
 	Close() error
 }
 
@@ -17,6 +19,10 @@ func (n *noopPublisher) Publish(_ context.Context, _ api) error {
 	return nil
 }
 
+func (n *noopPublisher) PublishBatch(_ context.Context, _ []api) error {
+	return nil
+}
+
 func (n *noopPublisher) Close() error {
 	return nil
 }
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
@@ -43,15 +43,46 @@ func newKafkaPublisher(brokers []string, topic, clientID string) (*kafkaPublishe
 }
 
 func (p *kafkaPublisher) Publish(ctx context.Context, item api) error {
+	msg, err := p.message(ctx, item)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, msg)
+}
+
+// PublishBatch hands all messages to the writer at once, so they are sent in
+// as few produce requests as the writer's batch size allows.
+func (p *kafkaPublisher) PublishBatch(ctx context.Context, items []api) error {
+	if len(items) == 0 {
+		return nil
+	}
+	msgs := make([]kafka.Message, 0, len(items))
+	for _, item := range items {
+		msg, err := p.message(ctx, item)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
+func (p *kafkaPublisher) message(ctx context.Context, item api) (kafka.Message, error) {
 	payload, err := json.Marshal(item)
 	if err != nil {
-		return fmt.Errorf("marshal kafka payload: %w", err)
+		return kafka.Message{}, fmt.Errorf("marshal kafka payload: %w", err)
 	}
-	return p.writer.WriteMessages(ctx, kafka.Message{
+	msg := kafka.Message{
 		Key:   []byte(item.ID),
 		Value: payload,
 		Time:  time.Now(),
-	})
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: "x-request-id", Value: []byte(id)})
+	}
+	// consumers continue the trace from the traceparent/b3 headers
+	injectKafkaTraceContext(ctx, &msg)
+	return msg, nil
 }
 
 func (p *kafkaPublisher) Close() error {
@@ -64,7 +95,7 @@ func configureContentPublisher() func() {
 	cleanup := func() {}
 
 	if len(brokers) == 0 || topic == "" {
-		log.Print("helloworld: kafka publisher disabled (missing KAFKA_BROKERS or KAFKA_TOPIC)")
+		slog.Info("kafka publisher disabled (missing KAFKA_BROKERS or KAFKA_TOPIC)")
 		return cleanup
 	}
 
@@ -75,15 +106,15 @@ func configureContentPublisher() func() {
 
 	publisher, err := newKafkaPublisher(brokers, topic, clientID)
 	if err != nil {
-		log.Printf("helloworld: unable to initialize kafka publisher: %v", err)
+		slog.Error("unable to initialize kafka publisher", "error", err)
 		return cleanup
 	}
 	setContentPublisher(publisher)
-	log.Printf("helloworld: kafka publisher enabled (topic=%s, brokers=%s)", topic, strings.Join(brokers, ","))
+	slog.Info("kafka publisher enabled", "topic", topic, "brokers", strings.Join(brokers, ","))
 
 	return func() {
 		if err := publisher.Close(); err != nil {
-			log.Printf("helloworld: error closing kafka publisher: %v", err)
+			slog.Error("error closing kafka publisher", "error", err)
 		}
 		resetContentPublisher()
 	}
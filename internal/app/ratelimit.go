@@ -0,0 +1,343 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to Burst.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitDecision is the outcome of taking a token from a bucket.
+type RateLimitDecision struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps token buckets; shared implementations make limits hold
+// across replicas.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitDecision, error)
+}
+
+type tokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// take refills the bucket for the elapsed time and tries to consume one token.
+func (b tokenBucket) take(limit RateLimit, now time.Time) (tokenBucket, RateLimitDecision) {
+	burst := float64(limit.Burst)
+	if b.Updated.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed*limit.Rate)
+	}
+	b.Updated = now
+	decision := RateLimitDecision{}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = rateDuration(1-b.Tokens, limit.Rate)
+	}
+	decision.Remaining = int(math.Floor(b.Tokens))
+	decision.Reset = rateDuration(burst-b.Tokens, limit.Rate)
+	return b, decision
+}
+
+func rateDuration(tokens, rate float64) time.Duration {
+	if rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+type rateLimitRule struct {
+	Prefix string
+	Limit  RateLimit
+}
+
+// rateLimiter applies per-route token buckets keyed by the caller identity.
+type rateLimiter struct {
+	store        RateLimitStore
+	rules        []rateLimitRule
+	apiKeyHeader string
+	now          func() time.Time
+}
+
+var (
+	rateLimiterMu  sync.RWMutex
+	requestLimiter = newRateLimiterFromEnv(newInMemoryRateLimitStore())
+)
+
+func getRateLimiter() *rateLimiter {
+	rateLimiterMu.RLock()
+	defer rateLimiterMu.RUnlock()
+	return requestLimiter
+}
+
+func setRateLimiter(l *rateLimiter) {
+	rateLimiterMu.Lock()
+	requestLimiter = l
+	rateLimiterMu.Unlock()
+}
+
+func newRateLimiterFromEnv(store RateLimitStore) *rateLimiter {
+	rules, err := parseRateLimitRules(os.Getenv("RATE_LIMIT_DEFAULT"), os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		slog.Error("invalid rate limit configuration, rate limiting disabled", "error", err)
+	}
+	return &rateLimiter{
+		store:        store,
+		rules:        rules,
+		apiKeyHeader: strings.TrimSpace(os.Getenv("RATE_LIMIT_API_KEY_HEADER")),
+		now:          time.Now,
+	}
+}
+
+// configureRateLimiter switches the bucket store to DynamoDB when RATE_LIMIT_TABLE is set.
+func configureRateLimiter() {
+	current := getRateLimiter()
+	if len(current.rules) == 0 {
+		slog.Info("rate limiting disabled (missing RATE_LIMIT_DEFAULT or RATE_LIMITS)")
+		return
+	}
+	table := strings.TrimSpace(os.Getenv("RATE_LIMIT_TABLE"))
+	if table == "" {
+		slog.Info("rate limiting enabled with in-memory buckets", "rules", len(current.rules))
+		return
+	}
+	client, err := newDynamoClientFromEnv()
+	if err != nil {
+		slog.Warn("DynamoDB rate limit store not initialised, keeping in-memory buckets", "error", err)
+		return
+	}
+	setRateLimiter(newRateLimiterFromEnv(newDynamoRateLimitStore(client, table)))
+	slog.Info("rate limiting enabled with DynamoDB", "table", table, "rules", len(current.rules))
+}
+
+// parseRateLimitRules reads "rate:burst" for the default and comma-separated
+// "prefix=rate:burst" entries for route templates. The longest prefix wins.
+func parseRateLimitRules(def, routes string) ([]rateLimitRule, error) {
+	var rules []rateLimitRule
+	if strings.TrimSpace(def) != "" {
+		limit, err := parseRateLimit(def)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_DEFAULT: %w", err)
+		}
+		rules = append(rules, rateLimitRule{Prefix: "", Limit: limit})
+	}
+	for _, entry := range strings.Split(routes, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, raw, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("RATE_LIMITS entry %q is not prefix=rate:burst", entry)
+		}
+		limit, err := parseRateLimit(raw)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMITS entry %q: %w", entry, err)
+		}
+		rules = append(rules, rateLimitRule{Prefix: strings.TrimSpace(prefix), Limit: limit})
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+	return rules, nil
+}
+
+func parseRateLimit(raw string) (RateLimit, error) {
+	rateStr, burstStr, ok := strings.Cut(strings.TrimSpace(raw), ":")
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate %q", rateStr)
+	}
+	burst := int(math.Ceil(rate))
+	if ok {
+		burst, err = strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return RateLimit{}, fmt.Errorf("invalid burst %q", burstStr)
+		}
+	}
+	return RateLimit{Rate: rate, Burst: burst}, nil
+}
+
+func (l *rateLimiter) rule(path string) (rateLimitRule, bool) {
+	for _, rule := range l.rules {
+		if strings.HasPrefix(path, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return rateLimitRule{}, false
+}
+
+// identity keys the bucket by verified client certificate, API key or client
+// IP, in that order. Passwords and tokens are not looked at before the auth
+// wrappers run, so the RateLimit-* headers cannot tell valid credentials apart.
+func (l *rateLimiter) identity(r *http.Request) string {
+	if principal, ok := clientCertPrincipal(r); ok {
+		return "user:" + principal
+	}
+	if l.apiKeyHeader != "" {
+		if key := r.Header.Get(l.apiKeyHeader); key != "" {
+			sum := sha256.Sum256([]byte(key))
+			return "apikey:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + getIPAddress(r)
+}
+
+// authenticatedHandler is a route handler that authenticates the caller with
+// basicAuth or jwtAuth; its bucket is charged by limitAuthenticated.
+type authenticatedHandler struct {
+	http.Handler
+}
+
+// authenticated marks the route handler as authenticating the caller, so its
+// requests are limited per user once authentication has succeeded.
+func authenticated(handler http.Handler) http.Handler {
+	return authenticatedHandler{handler}
+}
+
+type rateLimitCheckKey struct{}
+
+// rateLimitCheck is a bucket charge RateLimitHandler leaves to the auth wrapper.
+type rateLimitCheck struct {
+	limiter  *rateLimiter
+	rule     rateLimitRule
+	path     string
+	fallback string
+	done     bool
+}
+
+// limitAuthenticated charges the deferred bucket once the auth wrapper has
+// decided: the principal's bucket on success, the API key or client IP bucket
+// when principal is empty. It reports false after rejecting the request.
+func limitAuthenticated(w http.ResponseWriter, r *http.Request, principal string) bool {
+	check, ok := r.Context().Value(rateLimitCheckKey{}).(*rateLimitCheck)
+	if !ok || check.done {
+		return true
+	}
+	check.done = true
+	key := check.fallback
+	if principal != "" {
+		key = "user:" + principal
+	}
+	return check.limiter.allow(w, r, check.rule, check.path, key)
+}
+
+// allow takes a token from the bucket and sets the RateLimit-* headers, or
+// responds 429 and reports false when the bucket is empty.
+func (l *rateLimiter) allow(w http.ResponseWriter, r *http.Request, rule rateLimitRule, path, key string) bool {
+	decision, err := l.store.Take(r.Context(), rule.Prefix+"|"+key, rule.Limit, l.now())
+	if err != nil {
+		// fail open so a broken shared backend does not take the API down
+		requestLogger(r).Error("rate limit store error", "error", err)
+		return true
+	}
+	window := int(math.Ceil(float64(rule.Limit.Burst) / rule.Limit.Rate))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(rule.Limit.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(decision.Reset.Seconds()))))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit.Burst, window))
+	if !decision.Allowed {
+		httpRequestsRateLimited.WithLabelValues(path).Inc()
+		retryAfter := int(math.Max(1, math.Ceil(decision.RetryAfter.Seconds())))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		respondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+// RateLimitHandler rejects requests exceeding the configured per-route limits
+// with 429 and reports the bucket state in RateLimit-* response headers. On
+// authenticated routes the charge is deferred to the auth wrapper.
+func RateLimitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := getRateLimiter()
+		if len(l.rules) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path := "/"
+		deferred := false
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				path = tmpl
+			}
+			_, deferred = route.GetHandler().(authenticatedHandler)
+		}
+		rule, ok := l.rule(path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := l.identity(r)
+		if deferred {
+			if _, cert := clientCertPrincipal(r); !cert {
+				check := &rateLimitCheck{limiter: l, rule: rule, path: path, fallback: key}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitCheckKey{}, check)))
+				return
+			}
+		}
+		if !l.allow(w, r, rule, path, key) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type inMemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]tokenBucket
+	lastPrune time.Time
+}
+
+func newInMemoryRateLimitStore() *inMemoryRateLimitStore {
+	return &inMemoryRateLimitStore{buckets: make(map[string]tokenBucket)}
+}
+
+func (s *inMemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit, now time.Time) (RateLimitDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(now)
+	bucket, decision := s.buckets[key].take(limit, now)
+	s.buckets[key] = bucket
+	return decision, nil
+}
+
+// prune drops buckets idle for more than ten minutes, by which time any
+// reasonable bucket is full again and equivalent to a new one.
+func (s *inMemoryRateLimitStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Minute {
+		return
+	}
+	s.lastPrune = now
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.Updated) > 10*time.Minute {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// dynamoRateLimitStore keeps token buckets in DynamoDB so every replica draws from
+// the same bucket. Buckets are updated with optimistic concurrency on the
+// "updated" attribute; the table uses "key" as partition key and "expires_at"
+// as TTL attribute.
+type dynamoRateLimitStore struct {
+	client  dynamoItemAPI
+	table   string
+	retries int
+}
+
+func newDynamoRateLimitStore(client dynamoItemAPI, table string) *dynamoRateLimitStore {
+	return &dynamoRateLimitStore{client: client, table: table, retries: 3}
+}
+
+func (s *dynamoRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitDecision, error) {
+	for attempt := 0; attempt < s.retries; attempt++ {
+		out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(s.table),
+			Key:            map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return RateLimitDecision{}, fmt.Errorf("get rate limit bucket from DynamoDB: %w", err)
+		}
+		current, err := dynamoItemToTokenBucket(out.Item)
+		if err != nil {
+			return RateLimitDecision{}, err
+		}
+		bucket, decision := current.take(limit, now)
+
+		input := &dynamodb.PutItemInput{
+			TableName: aws.String(s.table),
+			Item: map[string]types.AttributeValue{
+				"key":        &types.AttributeValueMemberS{Value: key},
+				"tokens":     &types.AttributeValueMemberN{Value: strconv.FormatFloat(bucket.Tokens, 'f', -1, 64)},
+				"updated":    numberAttr(bucket.Updated.UnixNano()),
+				"expires_at": numberAttr(now.Add(time.Hour).Unix()),
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#k)"),
+			ExpressionAttributeNames: map[string]string{
+				"#k": "key",
+			},
+		}
+		if !current.Updated.IsZero() {
+			input.ConditionExpression = aws.String("updated = :prev")
+			input.ExpressionAttributeNames = nil
+			input.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":prev": numberAttr(current.Updated.UnixNano()),
+			}
+		}
+		if _, err := s.client.PutItem(ctx, input); err != nil {
+			var conditionalErr *types.ConditionalCheckFailedException
+			if errors.As(err, &conditionalErr) {
+				// another replica updated the bucket in the meantime, retry with fresh state
+				continue
+			}
+			return RateLimitDecision{}, fmt.Errorf("put rate limit bucket into DynamoDB: %w", err)
+		}
+		return decision, nil
+	}
+	return RateLimitDecision{}, fmt.Errorf("rate limit bucket %s is contended", key)
+}
+
+func dynamoItemToTokenBucket(item map[string]types.AttributeValue) (tokenBucket, error) {
+	var bucket tokenBucket
+	if item == nil {
+		return bucket, nil
+	}
+	tokensAttr, ok := item["tokens"].(*types.AttributeValueMemberN)
+	if !ok {
+		return bucket, fmt.Errorf("dynamodb rate limit bucket missing tokens attribute")
+	}
+	updatedAttr, ok := item["updated"].(*types.AttributeValueMemberN)
+	if !ok {
+		return bucket, fmt.Errorf("dynamodb rate limit bucket missing updated attribute")
+	}
+	tokens, err := strconv.ParseFloat(tokensAttr.Value, 64)
+	if err != nil {
+		return bucket, fmt.Errorf("dynamodb rate limit bucket tokens attribute is not a number")
+	}
+	updated, err := strconv.ParseInt(updatedAttr.Value, 10, 64)
+	if err != nil {
+		return bucket, fmt.Errorf("dynamodb rate limit bucket updated attribute is not a number")
+	}
+	bucket.Tokens = tokens
+	bucket.Updated = time.Unix(0, updated)
+	return bucket, nil
+}
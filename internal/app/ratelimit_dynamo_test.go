@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// contendedItemClient lets another replica update the bucket right before
+// each of the next conflicts writes.
+type contendedItemClient struct {
+	*fakeDynamoDB
+	conflicts int
+}
+
+func (c *contendedItemClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if c.conflicts > 0 {
+		c.conflicts--
+		key := params.Item["key"].(*types.AttributeValueMemberS).Value
+		if item, ok := c.items[key]; ok {
+			updated, _ := dynamoItemToTokenBucket(item)
+			item["updated"] = numberAttr(updated.Updated.Add(time.Millisecond).UnixNano())
+		}
+	}
+	return c.fakeDynamoDB.PutItem(ctx, params, optFns...)
+}
+
+func Test_dynamoRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	fake.key = "key"
+	client := &contendedItemClient{fakeDynamoDB: fake}
+	store := newDynamoRateLimitStore(client, "rate_limits")
+	limit := RateLimit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	t.Run("Bucket is shared across takes", func(t *testing.T) {
+		for want := 1; want >= 0; want-- {
+			decision, err := store.Take(ctx, "ip:192.0.2.1", limit, now)
+			if err != nil || !decision.Allowed || decision.Remaining != want {
+				t.Fatalf("unexpected decision %+v, %v", decision, err)
+			}
+		}
+		decision, err := store.Take(ctx, "ip:192.0.2.1", limit, now)
+		if err != nil || decision.Allowed || decision.RetryAfter != time.Second {
+			t.Fatalf("expected an empty bucket, got %+v, %v", decision, err)
+		}
+		if decision, err = store.Take(ctx, "ip:192.0.2.2", limit, now); err != nil || !decision.Allowed {
+			t.Fatalf("keys share a bucket: %+v, %v", decision, err)
+		}
+	})
+
+	t.Run("Bucket refills over time", func(t *testing.T) {
+		decision, err := store.Take(ctx, "ip:192.0.2.1", limit, now.Add(time.Second))
+		if err != nil || !decision.Allowed || decision.Remaining != 0 {
+			t.Fatalf("unexpected decision after refill %+v, %v", decision, err)
+		}
+	})
+
+	t.Run("Concurrent updates are retried", func(t *testing.T) {
+		client.conflicts = 1
+		puts := fake.callCount("PutItem")
+		decision, err := store.Take(ctx, "ip:192.0.2.1", limit, now.Add(3*time.Second))
+		if err != nil || !decision.Allowed {
+			t.Fatalf("unexpected decision after a conflict %+v, %v", decision, err)
+		}
+		if got := fake.callCount("PutItem") - puts; got != 2 {
+			t.Fatalf("expected one retried write, got %d writes", got)
+		}
+
+		client.conflicts = store.retries
+		if _, err := store.Take(ctx, "ip:192.0.2.1", limit, now.Add(4*time.Second)); err == nil || !strings.Contains(err.Error(), "contended") {
+			t.Fatalf("expected a contended bucket error, got %v", err)
+		}
+	})
+}
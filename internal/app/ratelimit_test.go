@@ -0,0 +1,122 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_parseRateLimitRules(t *testing.T) {
+	rules, err := parseRateLimitRules("10:20", "/api/v1=2:4, /api/v1/content/{id}=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(rules))
+	}
+	l := &rateLimiter{rules: rules}
+	cases := map[string]RateLimit{
+		"/api/v1/content/{id}": {Rate: 1, Burst: 1},
+		"/api/v1/content":      {Rate: 2, Burst: 4},
+		"/proxy/helloworld":    {Rate: 10, Burst: 20},
+	}
+	for path, want := range cases {
+		rule, ok := l.rule(path)
+		if !ok || rule.Limit != want {
+			t.Errorf("rule(%q) = %+v, want %+v", path, rule.Limit, want)
+		}
+	}
+	if _, err := parseRateLimitRules("", "/api=fast"); err == nil {
+		t.Error("expected invalid rate to fail")
+	}
+}
+
+func Test_RateLimitHandler(t *testing.T) {
+	resetRepository()
+	now := time.Now()
+	rules, _ := parseRateLimitRules("", "/api/v1/content=1:2")
+	setRateLimiter(&rateLimiter{
+		store: newInMemoryRateLimitStore(),
+		rules: rules,
+		now:   func() time.Time { return now },
+	})
+	defer setRateLimiter(newRateLimiterFromEnv(newInMemoryRateLimitStore()))
+
+	r := mux.NewRouter()
+	r.Use(RateLimitHandler)
+	r.Handle("/api/v1/content", authenticated(basicAuth(getIndexContent))).Methods("GET")
+	do := func(user, pass, remoteAddr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/api/v1/content", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = remoteAddr
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Burst is allowed", func(t *testing.T) {
+		for i, remaining := range []string{"1", "0"} {
+			rr := do("user1", "password1", "10.0.0.1:1234")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("request %d: unexpected status code: got %d want %d", i, rr.Code, http.StatusOK)
+			}
+			if got := rr.Header().Get("RateLimit-Remaining"); got != remaining {
+				t.Fatalf("request %d: unexpected RateLimit-Remaining: got %q want %q", i, got, remaining)
+			}
+		}
+	})
+
+	t.Run("Exhausted bucket is rejected", func(t *testing.T) {
+		rr := do("user1", "password1", "10.0.0.2:1234")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusTooManyRequests)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "1" {
+			t.Fatalf("unexpected Retry-After: got %q want %q", got, "1")
+		}
+		if got := rr.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Fatalf("unexpected RateLimit-Limit: got %q want %q", got, "2")
+		}
+	})
+
+	t.Run("Other users and clients have their own bucket", func(t *testing.T) {
+		if rr := do("user2", "password2", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code for user2: got %d want %d", rr.Code, http.StatusOK)
+		}
+		if rr := do("", "", "10.0.0.3:1234"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status code for anonymous client: got %d want %d", rr.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("Failed logins use the client bucket", func(t *testing.T) {
+		// user1's bucket is empty, a wrong password must not reveal that
+		rr := do("user1", "wrong", "10.0.0.4:1234")
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusUnauthorized)
+		}
+		if got := rr.Header().Get("RateLimit-Remaining"); got != "1" {
+			t.Fatalf("unexpected RateLimit-Remaining: got %q want %q", got, "1")
+		}
+		if rr := do("user1", "wrong", "10.0.0.4:1234"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusUnauthorized)
+		}
+		if rr := do("user1", "wrong", "10.0.0.4:1234"); rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("unexpected status code once the client bucket is empty: got %d want %d", rr.Code, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("Bucket refills over time", func(t *testing.T) {
+		now = now.Add(time.Second)
+		if rr := do("user1", "password1", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusOK)
+		}
+	})
+}
@@ -3,7 +3,13 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
 	"sync"
+	"text/tabwriter"
 )
 
 // ErrContentNotFound signals that the requested content could not be located in the backing store.
@@ -15,10 +21,27 @@ var ErrContentAlreadyExists = errors.New("content already exists")
 // ContentRepository defines the required behaviour for interacting with the content data store.
 type ContentRepository interface {
 	ListContent(ctx context.Context) (allContent, error)
+	// ListContentByNamePrefix returns the items whose name starts with prefix, ordered by id.
+	ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error)
 	GetContent(ctx context.Context, id string) (*api, error)
 	CreateContent(ctx context.Context, item api) (*api, error)
 	UpdateContent(ctx context.Context, id string, name string) (*api, error)
 	DeleteContent(ctx context.Context, id string) error
+	// BatchContent applies the operations independently and returns one result
+	// per operation in order. The error is only set when no operation was
+	// applied, e.g. for ErrInvalidContentBatch or a cancelled context.
+	BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error)
+}
+
+// filterByNamePrefix returns the items whose name starts with prefix, keeping their order.
+func filterByNamePrefix(items allContent, prefix string) allContent {
+	matches := make(allContent, 0)
+	for _, item := range items {
+		if strings.HasPrefix(item.Name, prefix) {
+			matches = append(matches, item)
+		}
+	}
+	return matches
 }
 
 var (
@@ -37,3 +60,175 @@ func setContentRepository(repo ContentRepository) {
 	contentRepo = repo
 	contentRepoMu.Unlock()
 }
+
+// contentBackend returns REPOSITORY_BACKEND or, when unset, the backend implied
+// by the configured environment: SQLITE_PATH, POSTGRES_DSN, DYNAMODB_TABLE, then REDIS_URL, else memory.
+func contentBackend() string {
+	if backend := strings.ToLower(strings.TrimSpace(os.Getenv("REPOSITORY_BACKEND"))); backend != "" {
+		return backend
+	}
+	switch {
+	case strings.TrimSpace(os.Getenv("SQLITE_PATH")) != "":
+		return "sqlite"
+	case strings.TrimSpace(os.Getenv("POSTGRES_DSN")) != "":
+		return "postgres"
+	case os.Getenv("DYNAMODB_TABLE") != "":
+		return "dynamodb"
+	case strings.TrimSpace(os.Getenv("REDIS_URL")) != "":
+		return "redis"
+	}
+	return "memory"
+}
+
+// configureContentRepository installs the configured repository and returns a
+// cleanup function releasing its resources. SQL, Redis, the persistent
+// in-memory store and a failed DynamoDB bootstrap fail hard so data is never
+// silently written to a volatile store instead.
+func configureContentRepository() func() {
+	cleanup := func() {}
+	switch backend := contentBackend(); backend {
+	case "memory":
+		settings := loadMemoryPersistenceSettings()
+		if settings.Dir == "" {
+			slog.Info("content repository enabled", "backend", backend)
+			return cleanup
+		}
+		repo, err := newPersistentInMemoryRepository(settings)
+		if err != nil {
+			fatal("persistent in-memory repository not initialised", err)
+		}
+		setContentRepository(repo)
+		slog.Info("content repository enabled", "backend", backend, "dir", settings.Dir, "fsync", settings.Fsync)
+		cleanup = func() {
+			if err := repo.Close(); err != nil {
+				slog.Error("error closing in-memory repository", "error", err)
+			}
+		}
+	case "dynamodb":
+		repo, err := newDynamoContentRepositoryFromEnv()
+		if errors.Is(err, errDynamoBootstrap) {
+			fatal("DynamoDB table bootstrap failed", err)
+		}
+		if err != nil {
+			slog.Warn("DynamoDB repository not initialised, falling back to in-memory store", "error", err)
+			return cleanup
+		}
+		if ttl := envDuration("REDIS_CACHE_TTL", 0); ttl > 0 {
+			client, err := newRedisClientFromEnv(context.Background())
+			if err != nil {
+				slog.Warn("redis cache not initialised, reading from DynamoDB directly", "error", err)
+			} else {
+				cached := newRedisCachedContentRepository(repo, client, redisKeyPrefix(), ttl)
+				repo = cached
+				cleanup = func() {
+					if err := cached.Close(); err != nil {
+						slog.Error("error closing redis cache", "error", err)
+					}
+				}
+				slog.Info("redis read-through cache enabled", "ttl", ttl)
+			}
+		}
+		setContentRepository(repo)
+		slog.Info("content repository enabled", "backend", backend)
+	case "redis":
+		repo, err := newRedisContentRepositoryFromEnv(context.Background())
+		if err != nil {
+			fatal("redis repository not initialised", err)
+		}
+		setContentRepository(repo)
+		slog.Info("content repository enabled", "backend", backend, "prefix", repo.prefix)
+		cleanup = func() {
+			if err := repo.Close(); err != nil {
+				slog.Error("error closing redis repository", "error", err)
+			}
+		}
+	case "sqlite":
+		repo, err := newSQLiteContentRepositoryFromEnv(context.Background())
+		if err != nil {
+			fatal("sqlite repository not initialised", err)
+		}
+		setContentRepository(repo)
+		slog.Info("content repository enabled", "backend", backend, "path", os.Getenv("SQLITE_PATH"))
+		cleanup = func() {
+			if err := repo.Close(); err != nil {
+				slog.Error("error closing sqlite repository", "error", err)
+			}
+		}
+	case "postgres":
+		repo, err := newPostgresContentRepositoryFromEnv(context.Background())
+		if err != nil {
+			fatal("postgres repository not initialised", err)
+		}
+		setContentRepository(repo)
+		slog.Info("content repository enabled", "backend", backend)
+		cleanup = func() {
+			if err := repo.Close(); err != nil {
+				slog.Error("error closing postgres repository", "error", err)
+			}
+		}
+	default:
+		fatal("unsupported content repository", fmt.Errorf("unknown REPOSITORY_BACKEND %q", backend))
+	}
+	return cleanup
+}
+
+// Migrate implements the "migrate" subcommand: "up" (default) applies pending
+// schema migrations of the configured SQL backend, "status" lists them.
+func Migrate(args []string, out io.Writer) error {
+	configureLogging(os.Stdout)
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if command != "up" && command != "status" {
+		return fmt.Errorf("unknown migrate command %q, expected up or status", command)
+	}
+	ctx := context.Background()
+	var conn migrationTarget
+	switch backend := contentBackend(); backend {
+	case "sqlite":
+		db, err := openSQLite(strings.TrimSpace(os.Getenv("SQLITE_PATH")))
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		conn = migrationTarget{db: db, dialect: sqliteDialect()}
+	case "postgres":
+		db, err := openPostgres(strings.TrimSpace(os.Getenv("POSTGRES_DSN")), loadPostgresPoolSettings())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		conn = migrationTarget{db: db, dialect: postgresDialect()}
+	default:
+		return fmt.Errorf("backend %q has no schema migrations", backend)
+	}
+
+	if command == "up" {
+		applied, err := migrateSQL(ctx, conn.db, conn.dialect)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return nil
+	}
+	migrations, err := sqlMigrationStatus(ctx, conn.db, conn.dialect)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, m := range migrations {
+		applied := "pending"
+		if !m.AppliedAt.IsZero() {
+			applied = m.AppliedAt.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+	return tw.Flush()
+}
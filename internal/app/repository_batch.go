@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidContentBatch signals a batch that was rejected as a whole without applying any operation.
+var ErrInvalidContentBatch = errors.New("invalid content batch")
+
+// maxContentBatchOperations bounds a batch; it matches the item limit of a
+// DynamoDB TransactWriteItems call.
+const maxContentBatchOperations = 100
+
+// contentOperationKind is the kind of write in a batch.
+type contentOperationKind string
+
+const (
+	// contentOperationCreate fails with ErrContentAlreadyExists for an existing id.
+	contentOperationCreate contentOperationKind = "create"
+	// contentOperationUpsert creates the item or replaces its name.
+	contentOperationUpsert contentOperationKind = "upsert"
+	// contentOperationDelete fails with ErrContentNotFound for a missing id.
+	contentOperationDelete contentOperationKind = "delete"
+)
+
+// contentOperation is one write of a batch; a delete only uses Item.ID.
+type contentOperation struct {
+	Kind contentOperationKind
+	Item api
+}
+
+// contentOperationResult is the outcome of one operation: the written item,
+// nil for deletes, or the error that kept the operation from being applied.
+type contentOperationResult struct {
+	Item *api
+	Err  error
+}
+
+// validateContentBatch rejects empty and oversized batches, unknown kinds,
+// empty ids and ids that appear more than once, which DynamoDB refuses
+// within a single batch request.
+func validateContentBatch(ops []contentOperation) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("%w: no operations", ErrInvalidContentBatch)
+	}
+	if len(ops) > maxContentBatchOperations {
+		return fmt.Errorf("%w: %d operations exceed the limit of %d", ErrInvalidContentBatch, len(ops), maxContentBatchOperations)
+	}
+	seen := make(map[string]bool, len(ops))
+	for i, op := range ops {
+		switch op.Kind {
+		case contentOperationCreate, contentOperationUpsert, contentOperationDelete:
+		default:
+			return fmt.Errorf("%w: operation %d has unknown kind %q", ErrInvalidContentBatch, i, op.Kind)
+		}
+		if op.Item.ID == "" {
+			return fmt.Errorf("%w: operation %d has no id", ErrInvalidContentBatch, i)
+		}
+		if seen[op.Item.ID] {
+			return fmt.Errorf("%w: id %q appears more than once", ErrInvalidContentBatch, op.Item.ID)
+		}
+		seen[op.Item.ID] = true
+	}
+	return nil
+}
+
+// writtenItem returns the result of a successful create or upsert.
+func writtenItem(item api) contentOperationResult {
+	return contentOperationResult{Item: &item}
+}
@@ -0,0 +1,388 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// RunContentRepositoryConformance checks the behaviour every ContentRepository
+// has to provide. newRepository must return an empty repository; it is
+// called once per subtest.
+func RunContentRepositoryConformance(t *testing.T, newRepository func(t *testing.T) ContentRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	t.Run("Create and get", func(t *testing.T) {
+		repo := newRepository(t)
+		created, err := repo.CreateContent(ctx, api{ID: "1", Name: "One"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *created != (api{ID: "1", Name: "One"}) {
+			t.Fatalf("unexpected created item %v", created)
+		}
+		item, err := repo.GetContent(ctx, "1")
+		if err != nil || *item != (api{ID: "1", Name: "One"}) {
+			t.Fatalf("unexpected item %v, %v", item, err)
+		}
+	})
+
+	t.Run("Create duplicate", func(t *testing.T) {
+		repo := newRepository(t)
+		mustCreate(t, repo, "1", "Original")
+		if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Duplicate"}); !errors.Is(err, ErrContentAlreadyExists) {
+			t.Fatalf("expected ErrContentAlreadyExists, got %v", err)
+		}
+		if item, err := repo.GetContent(ctx, "1"); err != nil || item.Name != "Original" {
+			t.Fatalf("duplicate create changed the item: %v, %v", item, err)
+		}
+	})
+
+	t.Run("Get missing", func(t *testing.T) {
+		repo := newRepository(t)
+		if item, err := repo.GetContent(ctx, "missing"); !errors.Is(err, ErrContentNotFound) || item != nil {
+			t.Fatalf("expected ErrContentNotFound, got %v, %v", item, err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepository(t)
+		mustCreate(t, repo, "1", "One")
+		updated, err := repo.UpdateContent(ctx, "1", "Renamed")
+		if err != nil || *updated != (api{ID: "1", Name: "Renamed"}) {
+			t.Fatalf("unexpected updated item %v, %v", updated, err)
+		}
+		if item, err := repo.GetContent(ctx, "1"); err != nil || item.Name != "Renamed" {
+			t.Fatalf("update not visible: %v, %v", item, err)
+		}
+	})
+
+	t.Run("Update missing", func(t *testing.T) {
+		repo := newRepository(t)
+		if _, err := repo.UpdateContent(ctx, "missing", "Name"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("expected ErrContentNotFound, got %v", err)
+		}
+		if _, err := repo.GetContent(ctx, "missing"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("update of a missing item created it: %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepository(t)
+		mustCreate(t, repo, "1", "One")
+		mustCreate(t, repo, "2", "Two")
+		if err := repo.DeleteContent(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.GetContent(ctx, "1"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("expected ErrContentNotFound after delete, got %v", err)
+		}
+		if err := repo.DeleteContent(ctx, "1"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("expected ErrContentNotFound on second delete, got %v", err)
+		}
+		if _, err := repo.GetContent(ctx, "2"); err != nil {
+			t.Fatalf("delete removed another item: %v", err)
+		}
+	})
+
+	t.Run("List ordered by id", func(t *testing.T) {
+		repo := newRepository(t)
+		items, err := repo.ListContent(ctx)
+		if err != nil || len(items) != 0 {
+			t.Fatalf("expected an empty list, got %v, %v", items, err)
+		}
+		for _, id := range []string{"b", "10", "a", "2", "1"} {
+			mustCreate(t, repo, id, "Item "+id)
+		}
+		items, err = repo.ListContent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(items); got != "[{1 Item 1} {10 Item 10} {2 Item 2} {a Item a} {b Item b}]" {
+			t.Fatalf("unexpected list %s", got)
+		}
+	})
+
+	t.Run("List by name prefix", func(t *testing.T) {
+		repo := newRepository(t)
+		for id, name := range map[string]string{"1": "Apple", "2": "apricot", "3": "Apricot", "4": "Banana", "5": "100%", "6": "100x", "7": ""} {
+			mustCreate(t, repo, id, name)
+		}
+		if _, err := repo.UpdateContent(ctx, "4", "Apex"); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			prefix string
+			want   string
+		}{
+			{"Ap", "[{1 Apple} {3 Apricot} {4 Apex}]"},
+			{"Apr", "[{3 Apricot}]"},
+			{"a", "[{2 apricot}]"},
+			{"100%", "[{5 100%}]"},
+			{"Banana", "[]"},
+		}
+		for _, tt := range tests {
+			items, err := repo.ListContentByNamePrefix(ctx, tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(items); got != tt.want {
+				t.Errorf("prefix %q: got %s want %s", tt.prefix, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		repo := newRepository(t)
+		mustCreate(t, repo, "1", "One")
+		mustCreate(t, repo, "2", "Two")
+		mustCreate(t, repo, "6", "Six")
+		results, err := repo.BatchContent(ctx, []contentOperation{
+			{Kind: contentOperationCreate, Item: api{ID: "3", Name: "Three"}},
+			{Kind: contentOperationCreate, Item: api{ID: "1", Name: "Uno"}},
+			{Kind: contentOperationUpsert, Item: api{ID: "2", Name: "Dos"}},
+			{Kind: contentOperationUpsert, Item: api{ID: "4", Name: "Four"}},
+			{Kind: contentOperationDelete, Item: api{ID: "6"}},
+			{Kind: contentOperationDelete, Item: api{ID: "5"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			item string
+			err  error
+		}{
+			{"&{3 Three}", nil},
+			{"<nil>", ErrContentAlreadyExists},
+			{"&{2 Dos}", nil},
+			{"&{4 Four}", nil},
+			{"<nil>", nil},
+			{"<nil>", ErrContentNotFound},
+		}
+		if len(results) != len(want) {
+			t.Fatalf("expected %d results, got %d", len(want), len(results))
+		}
+		for i, w := range want {
+			if got := fmt.Sprint(results[i].Item); got != w.item || !errors.Is(results[i].Err, w.err) || (w.err == nil) != (results[i].Err == nil) {
+				t.Errorf("operation %d: got %s, %v want %s, %v", i, got, results[i].Err, w.item, w.err)
+			}
+		}
+		items, err := repo.ListContent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(items); got != "[{1 One} {2 Dos} {3 Three} {4 Four}]" {
+			t.Fatalf("unexpected content after batch: %s", got)
+		}
+		items, err = repo.ListContentByNamePrefix(ctx, "Do")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(items); got != "[{2 Dos}]" {
+			t.Fatalf("upserted name not listed by prefix: %s", got)
+		}
+	})
+
+	t.Run("Invalid batch", func(t *testing.T) {
+		repo := newRepository(t)
+		invalid := [][]contentOperation{
+			nil,
+			{{Kind: "rename", Item: api{ID: "1"}}},
+			{{Kind: contentOperationCreate, Item: api{Name: "No id"}}},
+			{{Kind: contentOperationCreate, Item: api{ID: "1"}}, {Kind: contentOperationDelete, Item: api{ID: "1"}}},
+			make([]contentOperation, maxContentBatchOperations+1),
+		}
+		for i, ops := range invalid {
+			if _, err := repo.BatchContent(ctx, ops); !errors.Is(err, ErrInvalidContentBatch) {
+				t.Errorf("batch %d: expected ErrInvalidContentBatch, got %v", i, err)
+			}
+		}
+		items, err := repo.ListContent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 0 {
+			t.Fatalf("invalid batches were applied: %v", items)
+		}
+	})
+
+	t.Run("Returned items are copies", func(t *testing.T) {
+		repo := newRepository(t)
+		created := mustCreate(t, repo, "1", "One")
+		created.Name = "Changed"
+		item, err := repo.GetContent(ctx, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.Name = "Changed"
+		items, err := repo.ListContent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items[0].Name = "Changed"
+		if item, _ := repo.GetContent(ctx, "1"); item.Name != "One" {
+			t.Fatalf("stored item was modified through a returned value: %v", item)
+		}
+	})
+
+	t.Run("Concurrent create of the same id", func(t *testing.T) {
+		repo := newRepository(t)
+		var created, conflicts atomic.Int32
+		runConcurrently(t, 16, func(i int) error {
+			_, err := repo.CreateContent(ctx, api{ID: "race", Name: fmt.Sprint("Writer ", i)})
+			switch {
+			case err == nil:
+				created.Add(1)
+			case errors.Is(err, ErrContentAlreadyExists):
+				conflicts.Add(1)
+			default:
+				return err
+			}
+			return nil
+		})
+		if created.Load() != 1 || conflicts.Load() != 15 {
+			t.Fatalf("expected exactly one winner, got %d created and %d conflicts", created.Load(), conflicts.Load())
+		}
+	})
+
+	t.Run("Concurrent writes to distinct ids", func(t *testing.T) {
+		repo := newRepository(t)
+		runConcurrently(t, 16, func(i int) error {
+			id := fmt.Sprintf("item-%02d", i)
+			if _, err := repo.CreateContent(ctx, api{ID: id, Name: "Created"}); err != nil {
+				return err
+			}
+			_, err := repo.UpdateContent(ctx, id, "Updated")
+			return err
+		})
+		items, err := repo.ListContent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 16 {
+			t.Fatalf("expected 16 items, got %d", len(items))
+		}
+		for _, item := range items {
+			if item.Name != "Updated" {
+				t.Fatalf("lost update for %v", item)
+			}
+		}
+	})
+
+	t.Run("Concurrent delete of the same id", func(t *testing.T) {
+		repo := newRepository(t)
+		mustCreate(t, repo, "1", "One")
+		var deleted atomic.Int32
+		runConcurrently(t, 8, func(int) error {
+			err := repo.DeleteContent(ctx, "1")
+			if err == nil {
+				deleted.Add(1)
+				return nil
+			}
+			if errors.Is(err, ErrContentNotFound) {
+				return nil
+			}
+			return err
+		})
+		if deleted.Load() != 1 {
+			t.Fatalf("expected exactly one successful delete, got %d", deleted.Load())
+		}
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		repo := newRepository(t)
+		mustCreate(t, repo, "1", "One")
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		calls := map[string]func() error{
+			"ListContent": func() error { _, err := repo.ListContent(cancelled); return err },
+			"ListContentByNamePrefix": func() error {
+				_, err := repo.ListContentByNamePrefix(cancelled, "O")
+				return err
+			},
+			"GetContent": func() error { _, err := repo.GetContent(cancelled, "1"); return err },
+			"CreateContent": func() error {
+				_, err := repo.CreateContent(cancelled, api{ID: "2", Name: "Two"})
+				return err
+			},
+			"UpdateContent": func() error { _, err := repo.UpdateContent(cancelled, "1", "Renamed"); return err },
+			"DeleteContent": func() error { return repo.DeleteContent(cancelled, "1") },
+			"BatchContent": func() error {
+				_, err := repo.BatchContent(cancelled, []contentOperation{{Kind: contentOperationUpsert, Item: api{ID: "1", Name: "Renamed"}}})
+				return err
+			},
+		}
+		for name, call := range calls {
+			if err := call(); !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: expected context.Canceled, got %v", name, err)
+			}
+		}
+		items, err := repo.ListContent(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(items); got != "[{1 One}]" {
+			t.Fatalf("cancelled writes were applied: %s", got)
+		}
+	})
+}
+
+func mustCreate(t *testing.T, repo ContentRepository, id, name string) *api {
+	t.Helper()
+	item, err := repo.CreateContent(context.Background(), api{ID: id, Name: name})
+	if err != nil {
+		t.Fatalf("create %s: %v", id, err)
+	}
+	return item
+}
+
+// runConcurrently starts n goroutines at once and fails the test on any error.
+func runConcurrently(t *testing.T, n int, fn func(i int) error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if err := fn(i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func Test_inMemoryRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		return newInMemoryRepository(nil)
+	})
+}
+
+func Test_persistentInMemoryRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		repo := newTestPersistentRepository(t, memoryPersistenceSettings{Dir: t.TempDir(), Fsync: walFsyncNever, SnapshotEvery: 5})
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	})
+}
+
+func Test_decoratedRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		repo := newMetricsContentRepository(newTracingContentRepository(newInMemoryRepository(nil)))
+		return newCachingContentRepository(repo, contentCacheSettings{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute})
+	})
+}
@@ -4,31 +4,101 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"golang.org/x/sync/errgroup"
 )
 
-type dynamoContentRepository struct {
-	client   *dynamodb.Client
-	table    string
-	scanPage int32
+// dynamoItemAPI is the subset of the DynamoDB client used for single item
+// reads and writes, such as by the login attempt and rate limit stores.
+type dynamoItemAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
 }
 
-func init() {
-	repo, err := newDynamoContentRepositoryFromEnv()
-	if err != nil {
-		log.Printf("helloworld: DynamoDB repository not initialised, falling back to in-memory store: %v", err)
-		return
+// dynamoAPI is the subset of the DynamoDB client used by the repository,
+// so tests can substitute a local fake.
+type dynamoAPI interface {
+	dynamoItemAPI
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// dynamoNameInitialAttribute holds the first character of the name. It is the
+// partition key of the name index, so prefix queries hit a single partition
+// while writes still spread across many.
+const dynamoNameInitialAttribute = "name_initial"
+
+// dynamoListSettings tunes how the repository reads many items at once.
+type dynamoListSettings struct {
+	// PageSize is the Limit of every Scan and Query page.
+	PageSize int32
+	// Segments > 1 splits ListContent into a parallel scan.
+	Segments int
+	// NameIndex is the global secondary index used for name prefix queries;
+	// without it they fall back to a filtered scan.
+	NameIndex string
+}
+
+func loadDynamoListSettings() dynamoListSettings {
+	settings := dynamoListSettings{
+		PageSize:  int32(envInt("DYNAMODB_SCAN_PAGE_SIZE", 100)),
+		Segments:  envInt("DYNAMODB_SCAN_SEGMENTS", 1),
+		NameIndex: strings.TrimSpace(os.Getenv("DYNAMODB_NAME_INDEX")),
+	}
+	if settings.PageSize < 1 {
+		slog.Warn("invalid page size, using default", "name", "DYNAMODB_SCAN_PAGE_SIZE", "value", settings.PageSize, "default", 100)
+		settings.PageSize = 100
 	}
-	setContentRepository(repo)
+	// DynamoDB accepts up to a million segments, more than a few dozen only adds overhead
+	if settings.Segments < 1 || settings.Segments > 64 {
+		slog.Warn("invalid scan segments, using default", "name", "DYNAMODB_SCAN_SEGMENTS", "value", settings.Segments, "default", 1)
+		settings.Segments = 1
+	}
+	return settings
+}
+
+// dynamoNameIndex is the keys-only index behind ListContentByNamePrefix;
+// its keys carry everything needed to build an item.
+func dynamoNameIndex(name string) dynamoIndexSpec {
+	return dynamoIndexSpec{
+		Name:         name,
+		PartitionKey: dynamoKeyAttribute{Name: dynamoNameInitialAttribute, Type: types.ScalarAttributeTypeS},
+		SortKey:      dynamoKeyAttribute{Name: "name", Type: types.ScalarAttributeTypeS},
+		Projection:   types.ProjectionTypeKeysOnly,
+	}
+}
+
+// nameInitial returns the first character of name, empty for an empty name.
+func nameInitial(name string) string {
+	for _, r := range name {
+		return string(r)
+	}
+	return ""
+}
+
+type dynamoContentRepository struct {
+	client    dynamoAPI
+	table     string
+	scanPage  int32
+	segments  int
+	nameIndex string
+	// timeout bounds each API call, 0 leaves it to the caller's context.
+	timeout time.Duration
+	// batchBackoff is the initial delay before unprocessed or conflicting
+	// batch writes are retried.
+	batchBackoff time.Duration
 }
 
 func newDynamoContentRepositoryFromEnv() (ContentRepository, error) {
@@ -37,80 +107,189 @@ func newDynamoContentRepositoryFromEnv() (ContentRepository, error) {
 		return nil, fmt.Errorf("DYNAMODB_TABLE environment variable not set")
 	}
 
-	region := os.Getenv("AWS_REGION")
-	if region == "" {
-		region = os.Getenv("AWS_DEFAULT_REGION")
+	settings := loadDynamoClientSettings()
+	client, err := newDynamoClient(context.Background(), settings)
+	if err != nil {
+		return nil, err
 	}
-	if region == "" {
-		return nil, fmt.Errorf("AWS_REGION or AWS_DEFAULT_REGION environment variable not set")
+
+	if envBool("DYNAMODB_BOOTSTRAP") {
+		if err := bootstrapDynamoTable(client, table); err != nil {
+			return nil, err
+		}
 	}
 
-	roleArn := os.Getenv("AWS_ROLE_ARN")
-	if roleArn == "" {
-		return nil, fmt.Errorf("AWS_ROLE_ARN environment variable not set")
+	list := loadDynamoListSettings()
+	repo := newDynamoContentRepository(client, table)
+	repo.timeout = settings.RequestTimeout
+	repo.scanPage = list.PageSize
+	repo.segments = list.Segments
+	if list.NameIndex != "" {
+		repo.nameIndex = repo.usableNameIndex(client, list.NameIndex)
 	}
+	return repo, nil
+}
 
-	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
-	if sessionName == "" {
-		sessionName = fmt.Sprintf("go-helloworld-%d", time.Now().Unix())
+// usableNameIndex returns index once the table is backfilled. Until then name
+// prefix queries keep using the filtered scan, as the index would leave out
+// the items written before it existed.
+func (r *dynamoContentRepository) usableNameIndex(client dynamoSchemaAPI, index string) string {
+	ctx, cancel := r.callContext(context.Background())
+	defer cancel()
+	backfilled, err := nameIndexBackfilled(ctx, client, r.table)
+	switch {
+	case err != nil:
+		slog.Warn("cannot check the name index backfill, using a filtered scan", "table", r.table, "index", index, "error", err)
+	case !backfilled:
+		slog.Warn("name index is not backfilled, using a filtered scan until dynamo apply has run", "table", r.table, "index", index)
+	default:
+		return index
 	}
+	return ""
+}
 
-	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(region))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+func newDynamoContentRepository(client dynamoAPI, table string) *dynamoContentRepository {
+	return &dynamoContentRepository{
+		client:       client,
+		table:        table,
+		scanPage:     100,
+		segments:     1,
+		batchBackoff: 50 * time.Millisecond,
 	}
-	stsClient := sts.NewFromConfig(cfg)
+}
 
-	var provider aws.CredentialsProvider
-	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); tokenFile != "" {
-		provider = stscreds.NewWebIdentityRoleProvider(stsClient, roleArn, stscreds.IdentityTokenFile(tokenFile), func(o *stscreds.WebIdentityRoleOptions) {
-			o.RoleSessionName = sessionName
-		})
-	} else {
-		provider = stscreds.NewAssumeRoleProvider(stsClient, roleArn, func(o *stscreds.AssumeRoleOptions) {
-			o.RoleSessionName = sessionName
-		})
+// callContext derives the context for a single API call.
+func (r *dynamoContentRepository) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
 	}
+	return context.WithCancel(ctx)
+}
 
-	creds := aws.NewCredentialsCache(provider)
-	if _, err := creds.Retrieve(context.Background()); err != nil {
-		return nil, fmt.Errorf("failed to obtain STS credentials: %w", err)
+// ListContent scans the table, in parallel segments when configured, reading
+// only the attributes of an item.
+func (r *dynamoContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	return r.scan(ctx, "")
+}
+
+// ListContentByNamePrefix queries the name index when configured. Index reads
+// are eventually consistent, so a just written item may be missing briefly.
+func (r *dynamoContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	if r.nameIndex == "" || prefix == "" {
+		return r.scan(ctx, prefix)
+	}
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.table),
+		IndexName:              aws.String(r.nameIndex),
+		KeyConditionExpression: aws.String("#i = :initial AND begins_with(#n, :prefix)"),
+		ExpressionAttributeNames: map[string]string{
+			"#i": dynamoNameInitialAttribute,
+			"#n": "name",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":initial": &types.AttributeValueMemberS{Value: nameInitial(prefix)},
+			":prefix":  &types.AttributeValueMemberS{Value: prefix},
+		},
+		Limit: aws.Int32(r.scanPage),
 	}
-	cfg.Credentials = creds
+	result := make(allContent, 0)
+	paginator := dynamodb.NewQueryPaginator(r.client, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := r.callContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("query DynamoDB index %s: %w", r.nameIndex, err)
+		}
+		if result, err = appendDynamoItems(result, page.Items); err != nil {
+			return nil, err
+		}
+	}
+	// the index is ordered by name, the repository contract is ordered by id
+	sortByID(result)
+	return result, nil
+}
 
-	client := dynamodb.NewFromConfig(cfg)
+// scan reads the whole table, keeping the items whose name starts with prefix.
+// The filter is applied by DynamoDB and saves transfer, not read capacity.
+func (r *dynamoContentRepository) scan(ctx context.Context, prefix string) (allContent, error) {
+	segments := max(r.segments, 1)
+	results := make([]allContent, segments)
+	group, groupCtx := errgroup.WithContext(ctx)
+	for segment := range segments {
+		group.Go(func() error {
+			items, err := r.scanSegment(groupCtx, segment, segments, prefix)
+			results[segment] = items
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
 
-	return &dynamoContentRepository{
-		client:   client,
-		table:    table,
-		scanPage: 25,
-	}, nil
+	result := make(allContent, 0)
+	for _, items := range results {
+		result = append(result, items...)
+	}
+	// a scan returns items in hash order, the repository contract is ordered by id
+	sortByID(result)
+	return result, nil
 }
 
-func (r *dynamoContentRepository) ListContent(ctx context.Context) (allContent, error) {
+func (r *dynamoContentRepository) scanSegment(ctx context.Context, segment, segments int, prefix string) (allContent, error) {
 	input := &dynamodb.ScanInput{
-		TableName: aws.String(r.table),
-		Limit:     aws.Int32(r.scanPage),
+		TableName:            aws.String(r.table),
+		Limit:                aws.Int32(r.scanPage),
+		ProjectionExpression: aws.String("#id, #n"),
+		ExpressionAttributeNames: map[string]string{
+			"#id": "id",
+			"#n":  "name",
+		},
+	}
+	if segments > 1 {
+		input.Segment = aws.Int32(int32(segment))
+		input.TotalSegments = aws.Int32(int32(segments))
+	}
+	if prefix != "" {
+		input.FilterExpression = aws.String("begins_with(#n, :prefix)")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: prefix},
+		}
 	}
 
 	result := make(allContent, 0)
 	paginator := dynamodb.NewScanPaginator(r.client, input)
 	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+		pageCtx, cancel := r.callContext(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
 		if err != nil {
 			return nil, fmt.Errorf("scan DynamoDB: %w", err)
 		}
-		for _, item := range page.Items {
-			content, convErr := dynamoItemToContent(item)
-			if convErr != nil {
-				return nil, convErr
-			}
-			result = append(result, *content)
+		if result, err = appendDynamoItems(result, page.Items); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func appendDynamoItems(result allContent, items []map[string]types.AttributeValue) (allContent, error) {
+	for _, item := range items {
+		content, err := dynamoItemToContent(item)
+		if err != nil {
+			return nil, err
 		}
+		result = append(result, *content)
 	}
 	return result, nil
 }
 
+func sortByID(items allContent) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+}
+
 func (r *dynamoContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
 	input := &dynamodb.GetItemInput{
 		TableName: aws.String(r.table),
@@ -120,6 +299,8 @@ func (r *dynamoContentRepository) GetContent(ctx context.Context, id string) (*a
 		ConsistentRead: aws.Bool(true),
 	}
 
+	ctx, cancel := r.callContext(ctx)
+	defer cancel()
 	out, err := r.client.GetItem(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("get item from DynamoDB: %w", err)
@@ -136,14 +317,13 @@ func (r *dynamoContentRepository) GetContent(ctx context.Context, id string) (*a
 
 func (r *dynamoContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String(r.table),
-		Item: map[string]types.AttributeValue{
-			"id":   &types.AttributeValueMemberS{Value: item.ID},
-			"name": &types.AttributeValueMemberS{Value: item.Name},
-		},
+		TableName:           aws.String(r.table),
+		Item:                contentToDynamoItem(item),
 		ConditionExpression: aws.String("attribute_not_exists(id)"),
 	}
 
+	ctx, cancel := r.callContext(ctx)
+	defer cancel()
 	if _, err := r.client.PutItem(ctx, input); err != nil {
 		var conditionalErr *types.ConditionalCheckFailedException
 		if errors.As(err, &conditionalErr) {
@@ -162,9 +342,10 @@ func (r *dynamoContentRepository) UpdateContent(ctx context.Context, id string,
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
-		UpdateExpression: aws.String("SET #n = :name"),
+		UpdateExpression: aws.String("SET #n = :name REMOVE #i"),
 		ExpressionAttributeNames: map[string]string{
 			"#n": "name",
+			"#i": dynamoNameInitialAttribute,
 		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":name": &types.AttributeValueMemberS{Value: name},
@@ -172,7 +353,13 @@ func (r *dynamoContentRepository) UpdateContent(ctx context.Context, id string,
 		ConditionExpression: aws.String("attribute_exists(id)"),
 		ReturnValues:        types.ReturnValueAllNew,
 	}
+	if initial := nameInitial(name); initial != "" {
+		input.UpdateExpression = aws.String("SET #n = :name, #i = :initial")
+		input.ExpressionAttributeValues[":initial"] = &types.AttributeValueMemberS{Value: initial}
+	}
 
+	ctx, cancel := r.callContext(ctx)
+	defer cancel()
 	out, err := r.client.UpdateItem(ctx, input)
 	if err != nil {
 		var conditionalErr *types.ConditionalCheckFailedException
@@ -198,6 +385,8 @@ func (r *dynamoContentRepository) DeleteContent(ctx context.Context, id string)
 		ConditionExpression: aws.String("attribute_exists(id)"),
 	}
 
+	ctx, cancel := r.callContext(ctx)
+	defer cancel()
 	if _, err := r.client.DeleteItem(ctx, input); err != nil {
 		var conditionalErr *types.ConditionalCheckFailedException
 		if errors.As(err, &conditionalErr) {
@@ -208,6 +397,18 @@ func (r *dynamoContentRepository) DeleteContent(ctx context.Context, id string)
 	return nil
 }
 
+func contentToDynamoItem(item api) map[string]types.AttributeValue {
+	out := map[string]types.AttributeValue{
+		"id":   &types.AttributeValueMemberS{Value: item.ID},
+		"name": &types.AttributeValueMemberS{Value: item.Name},
+	}
+	// index keys cannot be empty strings, an unnamed item stays out of the name index
+	if initial := nameInitial(item.Name); initial != "" {
+		out[dynamoNameInitialAttribute] = &types.AttributeValueMemberS{Value: initial}
+	}
+	return out
+}
+
 func dynamoItemToContent(item map[string]types.AttributeValue) (*api, error) {
 	idAttr, ok := item["id"]
 	if !ok {
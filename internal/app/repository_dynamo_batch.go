@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// dynamoBatchWriteLimit is the number of requests a BatchWriteItem call accepts.
+	dynamoBatchWriteLimit = 25
+	// dynamoBatchMaxAttempts bounds the calls spent on unprocessed items and
+	// transaction conflicts before the remaining operations fail.
+	dynamoBatchMaxAttempts = 6
+	// dynamoBatchMaxBackoff caps the delay between those calls.
+	dynamoBatchMaxBackoff = 2 * time.Second
+)
+
+// BatchContent writes upserts with BatchWriteItem, which cannot carry
+// conditions, and creates and deletes with one TransactWriteItems call so
+// their existence checks hold. Items DynamoDB leaves unprocessed and
+// transactions cancelled by conflicts are retried with exponential backoff.
+func (r *dynamoContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	if err := validateContentBatch(ops); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var upserts, conditional []int
+	for i, op := range ops {
+		if op.Kind == contentOperationUpsert {
+			upserts = append(upserts, i)
+		} else {
+			conditional = append(conditional, i)
+		}
+	}
+
+	results := make([]contentOperationResult, len(ops))
+	for start := 0; start < len(upserts); start += dynamoBatchWriteLimit {
+		r.batchWrite(ctx, ops, upserts[start:min(start+dynamoBatchWriteLimit, len(upserts))], results)
+	}
+	if len(conditional) > 0 {
+		r.transactWrite(ctx, ops, conditional, results)
+	}
+	return results, nil
+}
+
+// batchWrite puts the upserts at indexes, resubmitting unprocessed items.
+func (r *dynamoContentRepository) batchWrite(ctx context.Context, ops []contentOperation, indexes []int, results []contentOperationResult) {
+	// ids are unique within a batch, so unprocessed requests map back by id
+	pending := make(map[string]int, len(indexes))
+	requests := make([]types.WriteRequest, 0, len(indexes))
+	for _, i := range indexes {
+		pending[ops[i].Item.ID] = i
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: contentToDynamoItem(ops[i].Item)}})
+	}
+
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := r.callContext(ctx)
+		out, err := r.client.BatchWriteItem(callCtx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{r.table: requests},
+		})
+		cancel()
+		if err != nil {
+			failPending(results, pending, fmt.Errorf("batch write to DynamoDB: %w", err))
+			return
+		}
+
+		requests = out.UnprocessedItems[r.table]
+		unprocessed := make(map[string]int, len(requests))
+		for _, req := range requests {
+			if req.PutRequest == nil {
+				continue
+			}
+			if id, ok := req.PutRequest.Item["id"].(*types.AttributeValueMemberS); ok {
+				unprocessed[id.Value] = pending[id.Value]
+			}
+		}
+		for id, i := range pending {
+			if _, ok := unprocessed[id]; !ok {
+				results[i] = writtenItem(ops[i].Item)
+			}
+		}
+		pending = unprocessed
+		if len(pending) == 0 {
+			return
+		}
+		if attempt == dynamoBatchMaxAttempts {
+			failPending(results, pending, fmt.Errorf("batch write to DynamoDB: item still unprocessed after %d attempts", attempt))
+			return
+		}
+		if err := r.sleepBackoff(ctx, attempt); err != nil {
+			failPending(results, pending, err)
+			return
+		}
+	}
+}
+
+// transactWrite applies the creates and deletes at indexes in a transaction.
+// A cancelled transaction names the items whose condition failed; those fail
+// on their own and the others are resubmitted.
+func (r *dynamoContentRepository) transactWrite(ctx context.Context, ops []contentOperation, indexes []int, results []contentOperationResult) {
+	pending := indexes
+	for attempt := 1; ; attempt++ {
+		items := make([]types.TransactWriteItem, len(pending))
+		for n, i := range pending {
+			items[n] = r.transactItem(ops[i])
+		}
+		callCtx, cancel := r.callContext(ctx)
+		_, err := r.client.TransactWriteItems(callCtx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+		cancel()
+		if err == nil {
+			for _, i := range pending {
+				if ops[i].Kind == contentOperationCreate {
+					results[i] = writtenItem(ops[i].Item)
+				}
+			}
+			return
+		}
+
+		var cancelled *types.TransactionCanceledException
+		if !errors.As(err, &cancelled) || len(cancelled.CancellationReasons) != len(pending) {
+			failIndexes(results, pending, fmt.Errorf("transact write to DynamoDB: %w", err))
+			return
+		}
+		var retry []int
+		contended := false
+		for n, reason := range cancelled.CancellationReasons {
+			i := pending[n]
+			switch code := aws.ToString(reason.Code); code {
+			case "None":
+				retry = append(retry, i)
+			case "ConditionalCheckFailed":
+				results[i].Err = ErrContentNotFound
+				if ops[i].Kind == contentOperationCreate {
+					results[i].Err = ErrContentAlreadyExists
+				}
+			case "TransactionConflict", "ThrottlingError", "ProvisionedThroughputExceeded", "RequestLimitExceeded":
+				retry = append(retry, i)
+				contended = true
+			default:
+				results[i].Err = fmt.Errorf("transact write to DynamoDB: %s: %s", code, aws.ToString(reason.Message))
+			}
+		}
+		pending = retry
+		if len(pending) == 0 {
+			return
+		}
+		if attempt == dynamoBatchMaxAttempts {
+			failIndexes(results, pending, fmt.Errorf("transact write to DynamoDB: transaction still cancelled after %d attempts", attempt))
+			return
+		}
+		// items only cancelled because another condition failed are resubmitted right away
+		if contended {
+			if err := r.sleepBackoff(ctx, attempt); err != nil {
+				failIndexes(results, pending, err)
+				return
+			}
+		}
+	}
+}
+
+func (r *dynamoContentRepository) transactItem(op contentOperation) types.TransactWriteItem {
+	if op.Kind == contentOperationCreate {
+		return types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(r.table),
+			Item:                contentToDynamoItem(op.Item),
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		}}
+	}
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName: aws.String(r.table),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: op.Item.ID},
+		},
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	}}
+}
+
+// sleepBackoff waits a jittered exponential delay after the given attempt.
+func (r *dynamoContentRepository) sleepBackoff(ctx context.Context, attempt int) error {
+	delay := min(r.batchBackoff<<(attempt-1), dynamoBatchMaxBackoff)
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func failPending(results []contentOperationResult, pending map[string]int, err error) {
+	for _, i := range pending {
+		results[i].Err = err
+	}
+}
+
+func failIndexes(results []contentOperationResult, indexes []int, err error) {
+	for _, i := range indexes {
+		results[i].Err = err
+	}
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func Test_dynamoContentRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		return newDynamoContentRepository(newFakeDynamoDB(), "content")
+	})
+}
+
+func Test_dynamoContentRepositoryWithNameIndexConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		repo := newDynamoContentRepository(newFakeDynamoDB(), "content")
+		repo.nameIndex = "name_index"
+		repo.segments = 3
+		return repo
+	})
+}
+
+func Test_dynamoContentRepositoryListPages(t *testing.T) {
+	fake := newFakeDynamoDB()
+	repo := newDynamoContentRepository(fake, "content")
+	repo.scanPage = 2
+	for i := 0; i < 5; i++ {
+		mustCreate(t, repo, fmt.Sprint(i), fmt.Sprint("Item ", i))
+	}
+	items, err := repo.ListContent(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(items); got != "[{0 Item 0} {1 Item 1} {2 Item 2} {3 Item 3} {4 Item 4}]" {
+		t.Fatalf("unexpected list %s", got)
+	}
+	if calls := fake.callCount("Scan"); calls != 3 {
+		t.Fatalf("expected 3 scan pages, got %d", calls)
+	}
+}
+
+func Test_dynamoContentRepositoryParallelScan(t *testing.T) {
+	fake := newFakeDynamoDB()
+	repo := newDynamoContentRepository(fake, "content")
+	repo.scanPage = 3
+	repo.segments = 4
+	var want allContent
+	for i := 0; i < 20; i++ {
+		item := mustCreate(t, repo, fmt.Sprintf("%02d", i), fmt.Sprint("Item ", i))
+		want = append(want, *item)
+	}
+	items, err := repo.ListContent(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(items) != fmt.Sprint(want) {
+		t.Fatalf("unexpected list %v", items)
+	}
+	// every segment reads at least one page
+	if calls := fake.callCount("Scan"); calls < 4 || calls > 20/3+4 {
+		t.Fatalf("unexpected number of scan pages %d", calls)
+	}
+}
+
+func Test_dynamoContentRepositoryNamePrefix(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	repo := newDynamoContentRepository(fake, "content")
+	repo.scanPage = 2
+	for i := 0; i < 5; i++ {
+		mustCreate(t, repo, fmt.Sprint(i), fmt.Sprint("Item ", i))
+	}
+	mustCreate(t, repo, "other", "Other")
+
+	t.Run("Filtered scan without index", func(t *testing.T) {
+		items, err := repo.ListContentByNamePrefix(ctx, "Item")
+		if err != nil || len(items) != 5 {
+			t.Fatalf("unexpected items %v, %v", items, err)
+		}
+		if fake.callCount("Query") != 0 {
+			t.Fatal("queried an index that is not configured")
+		}
+	})
+
+	t.Run("Index query", func(t *testing.T) {
+		repo.nameIndex = "name_index"
+		scans := fake.callCount("Scan")
+		items, err := repo.ListContentByNamePrefix(ctx, "Item")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(items); got != "[{0 Item 0} {1 Item 1} {2 Item 2} {3 Item 3} {4 Item 4}]" {
+			t.Fatalf("unexpected items %s", got)
+		}
+		if fake.callCount("Scan") != scans || fake.callCount("Query") != 3 {
+			t.Fatalf("expected 3 query pages and no scan, got %d queries and %d scans", fake.callCount("Query"), fake.callCount("Scan")-scans)
+		}
+	})
+
+	t.Run("Rename moves the item between index partitions", func(t *testing.T) {
+		if _, err := repo.UpdateContent(ctx, "other", "Item 5"); err != nil {
+			t.Fatal(err)
+		}
+		if items, _ := repo.ListContentByNamePrefix(ctx, "Item 5"); fmt.Sprint(items) != "[{other Item 5}]" {
+			t.Fatalf("renamed item not found: %v", items)
+		}
+		if _, err := repo.UpdateContent(ctx, "other", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fake.items["other"][dynamoNameInitialAttribute]; ok {
+			t.Fatal("empty name kept an index key")
+		}
+	})
+}
+
+func Test_dynamoContentRepositoryBatchRetries(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeDynamoDB()
+	repo := newDynamoContentRepository(fake, "content")
+	repo.batchBackoff = time.Millisecond
+	mustCreate(t, repo, "exists", "Exists")
+
+	var ops []contentOperation
+	for i := 0; i < 30; i++ {
+		ops = append(ops, contentOperation{Kind: contentOperationUpsert, Item: api{ID: fmt.Sprintf("u%02d", i), Name: "Upsert"}})
+	}
+	ops = append(ops,
+		contentOperation{Kind: contentOperationCreate, Item: api{ID: "new", Name: "New"}},
+		contentOperation{Kind: contentOperationCreate, Item: api{ID: "exists", Name: "Again"}},
+		contentOperation{Kind: contentOperationDelete, Item: api{ID: "missing"}},
+	)
+	// the first chunk of 25 comes back half unprocessed twice, and the
+	// transaction conflicts on the new item while the other two fail their
+	// conditions
+	fake.throttled = 2
+	fake.conflicts = 1
+	results, err := repo.BatchContent(ctx, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results[:31] {
+		if result.Err != nil || result.Item == nil || result.Item.ID != ops[i].Item.ID {
+			t.Fatalf("operation %d: unexpected result %v, %v", i, result.Item, result.Err)
+		}
+	}
+	if !errors.Is(results[31].Err, ErrContentAlreadyExists) || !errors.Is(results[32].Err, ErrContentNotFound) {
+		t.Fatalf("unexpected conditional results %v, %v", results[31].Err, results[32].Err)
+	}
+	if calls := fake.callCount("BatchWriteItem"); calls != 4 {
+		t.Fatalf("expected 3 writes of the first chunk and 1 of the second, got %d", calls)
+	}
+	if calls := fake.callCount("TransactWriteItems"); calls != 2 {
+		t.Fatalf("expected the conflicting transaction and its resubmission, got %d transactions", calls)
+	}
+	items, err := repo.ListContent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 32 {
+		t.Fatalf("expected 32 items, got %d", len(items))
+	}
+
+	// items that stay unprocessed fail on their own
+	fake.throttled = dynamoBatchMaxAttempts
+	results, err = repo.BatchContent(ctx, ops[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed == 0 || failed == len(results) {
+		t.Fatalf("expected some operations to stay unprocessed, got %d failures", failed)
+	}
+}
+
+func Test_loadDynamoListSettings(t *testing.T) {
+	t.Setenv("DYNAMODB_SCAN_PAGE_SIZE", "50")
+	t.Setenv("DYNAMODB_SCAN_SEGMENTS", "8")
+	t.Setenv("DYNAMODB_NAME_INDEX", "name_index")
+	settings := loadDynamoListSettings()
+	if settings != (dynamoListSettings{PageSize: 50, Segments: 8, NameIndex: "name_index"}) {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+	if indexes := dynamoContentIndexes(settings); len(indexes) != 1 || indexes[0].Projection != types.ProjectionTypeKeysOnly {
+		t.Fatalf("unexpected indexes %+v", indexes)
+	}
+
+	t.Setenv("DYNAMODB_SCAN_PAGE_SIZE", "0")
+	t.Setenv("DYNAMODB_SCAN_SEGMENTS", "1000")
+	if settings := loadDynamoListSettings(); settings.PageSize != 100 || settings.Segments != 1 {
+		t.Fatalf("invalid values were not replaced by defaults: %+v", settings)
+	}
+}
+
+func Test_dynamoItemToContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    map[string]types.AttributeValue
+		wantErr bool
+	}{
+		{"Valid", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "1"}, "name": &types.AttributeValueMemberS{Value: "One"}}, false},
+		{"Missing id", map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: "One"}}, true},
+		{"Numeric id", map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: "1"}, "name": &types.AttributeValueMemberS{Value: "One"}}, true},
+		{"Missing name", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := dynamoItemToContent(tt.item)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected result %v, %v", item, err)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 type inMemoryRepository struct {
 	mu    sync.RWMutex
 	items map[string]api
+	// wal is nil unless persistence is enabled with MEMORY_DATA_DIR.
+	wal *contentWAL
 }
 
 func newInMemoryRepository(seed allContent) *inMemoryRepository {
@@ -21,20 +23,27 @@ func newInMemoryRepository(seed allContent) *inMemoryRepository {
 	return repo
 }
 
-func (r *inMemoryRepository) ListContent(_ context.Context) (allContent, error) {
+func (r *inMemoryRepository) ListContent(ctx context.Context) (allContent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	result := make(allContent, 0, len(r.items))
-	for _, item := range r.items {
-		result = append(result, item)
+	return r.snapshotLocked(), nil
+}
+
+func (r *inMemoryRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	items, err := r.ListContent(ctx)
+	if err != nil {
+		return nil, err
 	}
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].ID < result[j].ID
-	})
-	return result, nil
+	return filterByNamePrefix(items, prefix), nil
 }
 
-func (r *inMemoryRepository) GetContent(_ context.Context, id string) (*api, error) {
+func (r *inMemoryRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	item, ok := r.items[id]
@@ -45,18 +54,72 @@ func (r *inMemoryRepository) GetContent(_ context.Context, id string) (*api, err
 	return &copy, nil
 }
 
-func (r *inMemoryRepository) CreateContent(_ context.Context, item api) (*api, error) {
+func (r *inMemoryRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, exists := r.items[item.ID]; exists {
 		return nil, ErrContentAlreadyExists
 	}
+	if err := r.persist(walRecord{Op: walPut, Item: &item}); err != nil {
+		return nil, err
+	}
 	r.items[item.ID] = item
+	r.compactIfDue()
 	copy := item
 	return &copy, nil
 }
 
-func (r *inMemoryRepository) UpdateContent(_ context.Context, id string, name string) (*api, error) {
+// BatchContent applies all operations under a single lock acquisition.
+func (r *inMemoryRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	if err := validateContentBatch(ops); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := make([]contentOperationResult, len(ops))
+	for i, op := range ops {
+		results[i] = r.applyLocked(op)
+	}
+	r.compactIfDue()
+	return results, nil
+}
+
+// applyLocked applies one batch operation. Callers hold r.mu.
+func (r *inMemoryRepository) applyLocked(op contentOperation) contentOperationResult {
+	item := op.Item
+	_, exists := r.items[item.ID]
+	switch op.Kind {
+	case contentOperationCreate, contentOperationUpsert:
+		if exists && op.Kind == contentOperationCreate {
+			return contentOperationResult{Err: ErrContentAlreadyExists}
+		}
+		if err := r.persist(walRecord{Op: walPut, Item: &item}); err != nil {
+			return contentOperationResult{Err: err}
+		}
+		r.items[item.ID] = item
+		return writtenItem(item)
+	default:
+		if !exists {
+			return contentOperationResult{Err: ErrContentNotFound}
+		}
+		if err := r.persist(walRecord{Op: walDelete, ID: item.ID}); err != nil {
+			return contentOperationResult{Err: err}
+		}
+		delete(r.items, item.ID)
+		return contentOperationResult{}
+	}
+}
+
+func (r *inMemoryRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	item, exists := r.items[id]
@@ -64,17 +127,56 @@ func (r *inMemoryRepository) UpdateContent(_ context.Context, id string, name st
 		return nil, ErrContentNotFound
 	}
 	item.Name = name
+	if err := r.persist(walRecord{Op: walPut, Item: &item}); err != nil {
+		return nil, err
+	}
 	r.items[id] = item
+	r.compactIfDue()
 	copy := item
 	return &copy, nil
 }
 
-func (r *inMemoryRepository) DeleteContent(_ context.Context, id string) error {
+func (r *inMemoryRepository) DeleteContent(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, exists := r.items[id]; !exists {
 		return ErrContentNotFound
 	}
+	if err := r.persist(walRecord{Op: walDelete, ID: id}); err != nil {
+		return err
+	}
 	delete(r.items, id)
+	r.compactIfDue()
 	return nil
 }
+
+// persist appends a mutation to the write-ahead log before it is applied, so a
+// failed write leaves the in-memory state untouched. Callers hold r.mu.
+func (r *inMemoryRepository) persist(rec walRecord) error {
+	if r.wal == nil {
+		return nil
+	}
+	return r.wal.append(rec)
+}
+
+// compactIfDue snapshots the state once the applied mutation pushed the log
+// over its compaction threshold. Callers hold r.mu.
+func (r *inMemoryRepository) compactIfDue() {
+	if r.wal != nil {
+		r.wal.compactIfDue(r.snapshotLocked)
+	}
+}
+
+func (r *inMemoryRepository) snapshotLocked() allContent {
+	items := make(allContent, 0, len(r.items))
+	for _, item := range r.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
@@ -0,0 +1,385 @@
+package app
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	walFileName      = "content.wal"
+	snapshotFileName = "content.snapshot.json"
+	// walHeaderSize is the length prefix plus the CRC-32C of every record.
+	walHeaderSize = 8
+	// walMaxRecordSize bounds a single record so a corrupt length cannot make
+	// replay allocate arbitrary amounts of memory.
+	walMaxRecordSize = 1 << 20
+)
+
+var walChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+type walOp string
+
+const (
+	walPut    walOp = "put"
+	walDelete walOp = "delete"
+)
+
+// walRecord is one logged mutation. Puts carry the complete item, which makes
+// replaying a record more than once harmless.
+type walRecord struct {
+	Op   walOp  `json:"op"`
+	Item *api   `json:"item,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+// walFsyncPolicy controls when appended records are flushed to stable storage.
+type walFsyncPolicy string
+
+const (
+	// walFsyncAlways syncs before a write is acknowledged.
+	walFsyncAlways walFsyncPolicy = "always"
+	// walFsyncInterval syncs in the background, losing at most one interval on power loss.
+	walFsyncInterval walFsyncPolicy = "interval"
+	// walFsyncNever leaves flushing to the operating system.
+	walFsyncNever walFsyncPolicy = "never"
+)
+
+// memoryPersistenceSettings configures the optional write-ahead log of the in-memory repository.
+type memoryPersistenceSettings struct {
+	Dir           string
+	Fsync         walFsyncPolicy
+	FsyncInterval time.Duration
+	// SnapshotEvery compacts the log into a snapshot after this many records, 0 disables compaction.
+	SnapshotEvery int
+}
+
+func loadMemoryPersistenceSettings() memoryPersistenceSettings {
+	policy := walFsyncPolicy(strings.ToLower(strings.TrimSpace(os.Getenv("MEMORY_WAL_FSYNC"))))
+	switch policy {
+	case walFsyncAlways, walFsyncInterval, walFsyncNever:
+	case "":
+		policy = walFsyncAlways
+	default:
+		slog.Warn("invalid fsync policy, using default", "name", "MEMORY_WAL_FSYNC", "value", policy, "default", walFsyncAlways)
+		policy = walFsyncAlways
+	}
+	return memoryPersistenceSettings{
+		Dir:           strings.TrimSpace(os.Getenv("MEMORY_DATA_DIR")),
+		Fsync:         policy,
+		FsyncInterval: envDuration("MEMORY_WAL_FSYNC_INTERVAL", time.Second),
+		SnapshotEvery: envInt("MEMORY_SNAPSHOT_EVERY", 1000),
+	}
+}
+
+// contentWAL appends mutations to a log file and periodically compacts the
+// log into a snapshot of the full data set.
+type contentWAL struct {
+	settings memoryPersistenceSettings
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	records int
+	dirty   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newPersistentInMemoryRepository restores the repository from the snapshot
+// and write-ahead log in settings.Dir and logs every later mutation there.
+func newPersistentInMemoryRepository(settings memoryPersistenceSettings) (*inMemoryRepository, error) {
+	if settings.Dir == "" {
+		return nil, fmt.Errorf("MEMORY_DATA_DIR environment variable not set")
+	}
+	if err := os.MkdirAll(settings.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+	items, err := readSnapshot(filepath.Join(settings.Dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(settings.Dir, walFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open write-ahead log: %w", err)
+	}
+	replayed, size, err := replayWAL(file, items)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	wal := &contentWAL{settings: settings, file: file, size: size, records: replayed}
+	if settings.Fsync == walFsyncInterval && settings.FsyncInterval > 0 {
+		wal.stop, wal.done = make(chan struct{}), make(chan struct{})
+		go wal.syncLoop()
+	}
+	repo := &inMemoryRepository{items: items, wal: wal}
+	slog.Info("in-memory repository restored", "dir", settings.Dir, "items", len(items), "replayed", replayed)
+	return repo, nil
+}
+
+// Close compacts the log into a snapshot and releases the log file.
+func (r *inMemoryRepository) Close() error {
+	if r.wal == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.wal.close(r.snapshotLocked())
+}
+
+func readSnapshot(path string) (map[string]api, error) {
+	items := make(map[string]api)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	var snapshot allContent
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	for _, item := range snapshot {
+		items[item.ID] = item
+	}
+	return items, nil
+}
+
+// replayWAL applies all intact records to items and cuts off a torn last
+// record left behind by a crash, so new records follow valid data. A damaged
+// record followed by more data is not a crash artefact and fails the replay
+// rather than silently dropping the records behind it.
+func replayWAL(file *os.File, items map[string]api) (int, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("stat write-ahead log: %w", err)
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	replayed := 0
+	for {
+		rec, n, err := readWALRecord(reader)
+		if err == io.EOF {
+			return replayed, offset, nil
+		}
+		if err != nil {
+			if !errors.Is(err, io.ErrUnexpectedEOF) && offset+n < info.Size() {
+				return 0, 0, fmt.Errorf("write-ahead log corrupt at offset %d: %w", offset, err)
+			}
+			slog.Warn("discarding damaged write-ahead log tail", "offset", offset, "error", err)
+			if err := file.Truncate(offset); err != nil {
+				return 0, 0, fmt.Errorf("truncate write-ahead log: %w", err)
+			}
+			if err := file.Sync(); err != nil {
+				return 0, 0, fmt.Errorf("sync write-ahead log: %w", err)
+			}
+			return replayed, offset, nil
+		}
+		switch rec.Op {
+		case walPut:
+			items[rec.Item.ID] = *rec.Item
+		case walDelete:
+			delete(items, rec.ID)
+		}
+		offset += n
+		replayed++
+	}
+}
+
+// readWALRecord reads the next record and its size in bytes. On a damaged
+// record the size is the one its header claims.
+func readWALRecord(r io.Reader) (walRecord, int64, error) {
+	var rec walRecord
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return rec, 0, io.EOF
+		}
+		return rec, 0, fmt.Errorf("read record header: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	size := int64(walHeaderSize) + int64(length)
+	if length == 0 || length > walMaxRecordSize {
+		return rec, size, fmt.Errorf("invalid record length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, size, fmt.Errorf("read record payload: %w", err)
+	}
+	if crc32.Checksum(payload, walChecksumTable) != binary.BigEndian.Uint32(header[4:]) {
+		return rec, size, errors.New("record checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, size, fmt.Errorf("decode record: %w", err)
+	}
+	if (rec.Op == walPut && rec.Item == nil) || (rec.Op != walPut && rec.Op != walDelete) {
+		return rec, size, fmt.Errorf("invalid record operation %q", rec.Op)
+	}
+	return rec, size, nil
+}
+
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, walChecksumTable))
+	copy(buf[walHeaderSize:], payload)
+	return buf, nil
+}
+
+// append logs rec according to the fsync policy.
+func (w *contentWAL) append(rec walRecord) error {
+	buf, err := encodeWALRecord(rec)
+	if err != nil {
+		return fmt.Errorf("encode write-ahead log record: %w", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.file.Write(buf); err != nil {
+		w.rollback()
+		return fmt.Errorf("append write-ahead log: %w", err)
+	}
+	if w.settings.Fsync == walFsyncAlways {
+		if err := w.file.Sync(); err != nil {
+			w.rollback()
+			return fmt.Errorf("sync write-ahead log: %w", err)
+		}
+	} else {
+		w.dirty = true
+	}
+	w.size += int64(len(buf))
+	w.records++
+	return nil
+}
+
+// compactIfDue compacts the log once SnapshotEvery records have accumulated.
+// The records are already durable in the log, so a failed compaction is only
+// logged and retried on the next write.
+func (w *contentWAL) compactIfDue(snapshot func() allContent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.settings.SnapshotEvery <= 0 || w.records < w.settings.SnapshotEvery {
+		return
+	}
+	if err := w.compact(snapshot()); err != nil {
+		slog.Warn("write-ahead log compaction failed", "error", err)
+	}
+}
+
+// rollback cuts a partially written record off the log so later records stay readable.
+func (w *contentWAL) rollback() {
+	if err := w.file.Truncate(w.size); err != nil {
+		slog.Error("error truncating write-ahead log", "error", err)
+	}
+}
+
+// compact writes items to a new snapshot and empties the log. The snapshot is
+// renamed into place before the log is truncated; a crash in between only
+// replays records the snapshot already contains.
+func (w *contentWAL) compact(items allContent) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	path := filepath.Join(w.settings.Dir, snapshotFileName)
+	tmp, err := os.CreateTemp(w.settings.Dir, snapshotFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	if err := syncDir(w.settings.Dir); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate write-ahead log: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync write-ahead log: %w", err)
+	}
+	w.size, w.records, w.dirty = 0, 0, false
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open data directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync data directory: %w", err)
+	}
+	return nil
+}
+
+// syncLoop flushes the log in the background for the interval fsync policy.
+func (w *contentWAL) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.settings.FsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty {
+				if err := w.file.Sync(); err != nil {
+					slog.Error("error syncing write-ahead log", "error", err)
+				} else {
+					w.dirty = false
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *contentWAL) close(items allContent) error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.compact(items)
+	if syncErr := w.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
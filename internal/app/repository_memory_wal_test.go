@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestPersistentRepository(t *testing.T, settings memoryPersistenceSettings) *inMemoryRepository {
+	t.Helper()
+	repo, err := newPersistentInMemoryRepository(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// crashRepository drops the repository like a killed process would: the log
+// file is closed without the final compaction that Close performs.
+func crashRepository(t *testing.T, repo *inMemoryRepository) {
+	t.Helper()
+	if repo.wal.stop != nil {
+		close(repo.wal.stop)
+		<-repo.wal.done
+	}
+	if err := repo.wal.file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listIDs(t *testing.T, repo *inMemoryRepository) map[string]string {
+	t.Helper()
+	items, err := repo.ListContent(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]string, len(items))
+	for _, item := range items {
+		names[item.ID] = item.Name
+	}
+	return names
+}
+
+func Test_persistentInMemoryRepository(t *testing.T) {
+	ctx := context.Background()
+	for _, policy := range []walFsyncPolicy{walFsyncAlways, walFsyncInterval, walFsyncNever} {
+		t.Run(string(policy), func(t *testing.T) {
+			settings := memoryPersistenceSettings{Dir: t.TempDir(), Fsync: policy, FsyncInterval: 10 * time.Millisecond, SnapshotEvery: 4}
+			repo := newTestPersistentRepository(t, settings)
+			for _, id := range []string{"1", "2", "3", "4"} {
+				if _, err := repo.CreateContent(ctx, api{ID: id, Name: "Item " + id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Duplicate"}); !errors.Is(err, ErrContentAlreadyExists) {
+				t.Fatalf("expected ErrContentAlreadyExists, got %v", err)
+			}
+			if _, err := repo.UpdateContent(ctx, "2", "Renamed"); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.DeleteContent(ctx, "3"); err != nil {
+				t.Fatal(err)
+			}
+			// the four creates were compacted into the snapshot, update and delete are only in the log
+			if repo.wal.records != 2 {
+				t.Fatalf("expected 2 records after compaction, got %d", repo.wal.records)
+			}
+			want := listIDs(t, repo)
+			crashRepository(t, repo)
+
+			restored := newTestPersistentRepository(t, settings)
+			defer restored.Close()
+			if got := listIDs(t, restored); !reflect.DeepEqual(got, want) {
+				t.Fatalf("restored state mismatch: got %v want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_persistentInMemoryRepositoryClose(t *testing.T) {
+	ctx := context.Background()
+	settings := memoryPersistenceSettings{Dir: t.TempDir(), Fsync: walFsyncAlways}
+	repo := newTestPersistentRepository(t, settings)
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Kept"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(settings.Dir, walFileName))
+	if err != nil || info.Size() != 0 {
+		t.Fatalf("expected an empty log after Close, got %v, %v", info, err)
+	}
+	restored := newTestPersistentRepository(t, settings)
+	defer restored.Close()
+	if got := listIDs(t, restored); got["1"] != "Kept" {
+		t.Fatalf("snapshot not restored: %v", got)
+	}
+}
+
+func Test_persistentInMemoryRepositoryTornWrite(t *testing.T) {
+	ctx := context.Background()
+	// build a log with two complete records and measure where the second one starts
+	template := memoryPersistenceSettings{Dir: t.TempDir(), Fsync: walFsyncAlways}
+	repo := newTestPersistentRepository(t, template)
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Durable"}); err != nil {
+		t.Fatal(err)
+	}
+	boundary := repo.wal.size
+	if _, err := repo.CreateContent(ctx, api{ID: "2", Name: "Torn"}); err != nil {
+		t.Fatal(err)
+	}
+	crashRepository(t, repo)
+	log, err := os.ReadFile(filepath.Join(template.Dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type damage struct {
+		name string
+		data []byte
+	}
+	var damaged []damage
+	// cut the second record at every byte, header and payload alike
+	for cut := boundary + 1; cut < int64(len(log)); cut++ {
+		damaged = append(damaged, damage{fmt.Sprintf("truncated at %d", cut), log[:cut]})
+	}
+	corrupt := append([]byte(nil), log...)
+	corrupt[len(corrupt)-2] ^= 0xff
+	damaged = append(damaged, damage{"checksum mismatch", corrupt})
+
+	for _, d := range damaged {
+		name, data := d.name, d.data
+		settings := memoryPersistenceSettings{Dir: t.TempDir(), Fsync: walFsyncAlways}
+		if err := os.WriteFile(filepath.Join(settings.Dir, walFileName), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		restored := newTestPersistentRepository(t, settings)
+		if got := listIDs(t, restored); !reflect.DeepEqual(got, map[string]string{"1": "Durable"}) {
+			t.Fatalf("%s (%d bytes): unexpected state %v", name, len(data), got)
+		}
+		if restored.wal.size != boundary {
+			t.Fatalf("%s: damaged tail not truncated, log size %d want %d", name, restored.wal.size, boundary)
+		}
+		// new records must land behind the last intact record and survive the next restart
+		if _, err := restored.CreateContent(ctx, api{ID: "3", Name: "After recovery"}); err != nil {
+			t.Fatal(err)
+		}
+		crashRepository(t, restored)
+		again := newTestPersistentRepository(t, settings)
+		if got := listIDs(t, again); !reflect.DeepEqual(got, map[string]string{"1": "Durable", "3": "After recovery"}) {
+			t.Fatalf("%s: unexpected state after second restart %v", name, got)
+		}
+		again.Close()
+	}
+}
+
+func Test_persistentInMemoryRepositoryCorruptRecord(t *testing.T) {
+	ctx := context.Background()
+	settings := memoryPersistenceSettings{Dir: t.TempDir(), Fsync: walFsyncAlways}
+	repo := newTestPersistentRepository(t, settings)
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Corrupt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateContent(ctx, api{ID: "2", Name: "Intact"}); err != nil {
+		t.Fatal(err)
+	}
+	crashRepository(t, repo)
+	path := filepath.Join(settings.Dir, walFileName)
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// damage the first record, which a crash cannot tear as another follows it
+	log[walHeaderSize+2] ^= 0xff
+	if err := os.WriteFile(path, log, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newPersistentInMemoryRepository(settings); err == nil {
+		t.Fatal("expected a corrupt record in the middle of the log to fail the replay")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(log) {
+		t.Fatalf("log was truncated to %d bytes, want %d", len(after), len(log))
+	}
+}
+
+func Test_persistentInMemoryRepositoryReplayAfterSnapshot(t *testing.T) {
+	ctx := context.Background()
+	settings := memoryPersistenceSettings{Dir: t.TempDir(), Fsync: walFsyncAlways}
+	repo := newTestPersistentRepository(t, settings)
+	for _, id := range []string{"1", "2"} {
+		if _, err := repo.CreateContent(ctx, api{ID: id, Name: "Item " + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.DeleteContent(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(filepath.Join(settings.Dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// simulate a crash between installing the snapshot and truncating the log
+	if err := os.WriteFile(filepath.Join(settings.Dir, walFileName), log, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestPersistentRepository(t, settings)
+	defer restored.Close()
+	if got := listIDs(t, restored); !reflect.DeepEqual(got, map[string]string{"1": "Item 1"}) {
+		t.Fatalf("unexpected state %v", got)
+	}
+}
+
+func Test_loadMemoryPersistenceSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  walFsyncPolicy
+	}{
+		{"Default", "", walFsyncAlways},
+		{"Interval", "Interval", walFsyncInterval},
+		{"Never", "never", walFsyncNever},
+		{"Invalid falls back to always", "sometimes", walFsyncAlways},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MEMORY_WAL_FSYNC", tt.value)
+			if got := loadMemoryPersistenceSettings().Fsync; got != tt.want {
+				t.Fatalf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
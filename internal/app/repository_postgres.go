@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresUniqueViolation is the SQLSTATE of unique and primary key violations.
+const postgresUniqueViolation = "23505"
+
+func postgresDialect() sqlDialect {
+	migrations, err := fs.Sub(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		panic(err)
+	}
+	return sqlDialect{
+		name:        "postgresql",
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		isUniqueViolation: func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) && pgErr.Code == postgresUniqueViolation
+		},
+		// replicas starting at the same time migrate one after the other
+		migrationLock:       "SELECT pg_advisory_xact_lock(7353205)",
+		migrations:          migrations,
+		onConflictDoNothing: true,
+	}
+}
+
+// postgresPoolSettings configures the database/sql connection pool.
+type postgresPoolSettings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnectTimeout  time.Duration
+}
+
+func loadPostgresPoolSettings() postgresPoolSettings {
+	return postgresPoolSettings{
+		MaxOpenConns:    envInt("POSTGRES_MAX_OPEN_CONNS", 10),
+		MaxIdleConns:    envInt("POSTGRES_MAX_IDLE_CONNS", 5),
+		ConnMaxLifetime: envDuration("POSTGRES_CONN_MAX_LIFETIME", 30*time.Minute),
+		ConnMaxIdleTime: envDuration("POSTGRES_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		ConnectTimeout:  envDuration("POSTGRES_CONNECT_TIMEOUT", 5*time.Second),
+	}
+}
+
+// openPostgres opens a pgx backed connection pool for POSTGRES_DSN and checks
+// connectivity within the connect timeout.
+func openPostgres(dsn string, pool postgresPoolSettings) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("POSTGRES_DSN environment variable not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), pool.ConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	return db, nil
+}
+
+// newPostgresContentRepositoryFromEnv connects to POSTGRES_DSN, applies pending
+// migrations and prepares the repository statements.
+func newPostgresContentRepositoryFromEnv(ctx context.Context) (*sqlContentRepository, error) {
+	db, err := openPostgres(strings.TrimSpace(os.Getenv("POSTGRES_DSN")), loadPostgresPoolSettings())
+	if err != nil {
+		return nil, err
+	}
+	dialect := postgresDialect()
+	if _, err := migrateSQL(ctx, db, dialect); err != nil {
+		db.Close()
+		return nil, err
+	}
+	repo, err := newSQLContentRepository(ctx, db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
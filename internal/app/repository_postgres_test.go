@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// postgresBinary finds a Postgres server tool in PATH or the usual package locations.
+func postgresBinary(name string) (string, bool) {
+	if p, err := exec.LookPath(name); err == nil {
+		return p, true
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	if len(matches) > 0 {
+		return matches[len(matches)-1], true
+	}
+	return "", false
+}
+
+// startTestPostgres returns the DSN of POSTGRES_TEST_DSN or of an ephemeral
+// server started from the local Postgres binaries, skipping the test when
+// neither is available.
+func startTestPostgres(t *testing.T) string {
+	t.Helper()
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		return dsn
+	}
+	initdb, ok := postgresBinary("initdb")
+	pgctl, ok2 := postgresBinary("pg_ctl")
+	if !ok || !ok2 {
+		t.Skip("no local postgres binaries (initdb, pg_ctl) and POSTGRES_TEST_DSN not set")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("postgres refuses to run as root, set POSTGRES_TEST_DSN instead")
+	}
+
+	dir := t.TempDir()
+	data, socket := filepath.Join(dir, "data"), filepath.Join(dir, "socket")
+	if err := os.Mkdir(socket, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput(); err != nil {
+		t.Fatalf("initdb: %v\n%s", err, out)
+	}
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses='' -c fsync=off", port, socket)
+	if out, err := exec.Command(pgctl, "-D", data, "-o", opts, "-w", "start").CombinedOutput(); err != nil {
+		t.Fatalf("pg_ctl start: %v\n%s", err, out)
+	}
+	t.Cleanup(func() {
+		exec.Command(pgctl, "-D", data, "-m", "immediate", "stop").Run()
+	})
+	return fmt.Sprintf("host=%s port=%d user=postgres dbname=postgres sslmode=disable", socket, port)
+}
+
+func Test_postgresContentRepository(t *testing.T) {
+	t.Setenv("POSTGRES_DSN", startTestPostgres(t))
+	ctx := context.Background()
+
+	repo, err := newPostgresContentRepositoryFromEnv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, err := repo.db.ExecContext(ctx, "TRUNCATE content"); err != nil {
+		t.Fatal(err)
+	}
+	testSQLContentRepository(t, repo)
+
+	// a second replica starting up finds the schema already migrated
+	again, err := migrateSQL(ctx, repo.db, postgresDialect())
+	if err != nil || len(again) != 0 {
+		t.Fatalf("migrations not idempotent: applied %v, err %v", again, err)
+	}
+}
+
+func Test_postgresContentRepositoryConformance(t *testing.T) {
+	t.Setenv("POSTGRES_DSN", startTestPostgres(t))
+	repo, err := newPostgresContentRepositoryFromEnv(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		if _, err := repo.db.ExecContext(context.Background(), "TRUNCATE content"); err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
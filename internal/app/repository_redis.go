@@ -0,0 +1,355 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisKeyPrefix = "helloworld:content"
+	// redisListBatch bounds the ids fetched from the index and the hashes
+	// pipelined per round trip while listing.
+	redisListBatch = 500
+)
+
+// Every mutation runs as a script so the item hash and the index sorted set
+// change atomically and existence checks cannot race with other replicas.
+var (
+	// KEYS[1] item hash, KEYS[2] index; ARGV[1] id, ARGV[2] name.
+	redisCreateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'id', ARGV[1], 'name', ARGV[2])
+redis.call('ZADD', KEYS[2], 0, ARGV[1])
+return 1
+`)
+	// KEYS[1] item hash, KEYS[2] index; ARGV[1] id, ARGV[2] name.
+	redisUpsertScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], 'id', ARGV[1], 'name', ARGV[2])
+redis.call('ZADD', KEYS[2], 0, ARGV[1])
+return 1
+`)
+	// KEYS[1] item hash; ARGV[1] name.
+	redisUpdateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'name', ARGV[1])
+return 1
+`)
+	// KEYS[1] item hash, KEYS[2] index; ARGV[1] id.
+	redisDeleteScript = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+)
+
+// redisContentRepository stores every item in a hash and keeps the ids in a
+// sorted set with equal scores, which Redis orders lexicographically.
+type redisContentRepository struct {
+	client *redis.Client
+	prefix string
+}
+
+// newRedisClientFromEnv connects to REDIS_URL and verifies the connection.
+func newRedisClientFromEnv(ctx context.Context) (*redis.Client, error) {
+	raw := strings.TrimSpace(os.Getenv("REDIS_URL"))
+	if raw == "" {
+		return nil, fmt.Errorf("REDIS_URL environment variable not set")
+	}
+	opts, err := redis.ParseURL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(ctx, envDuration("REDIS_CONNECT_TIMEOUT", 5*time.Second))
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	return client, nil
+}
+
+func redisKeyPrefix() string {
+	if prefix := strings.TrimSpace(os.Getenv("REDIS_KEY_PREFIX")); prefix != "" {
+		return prefix
+	}
+	return defaultRedisKeyPrefix
+}
+
+func newRedisContentRepositoryFromEnv(ctx context.Context) (*redisContentRepository, error) {
+	client, err := newRedisClientFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newRedisContentRepository(client, redisKeyPrefix()), nil
+}
+
+func newRedisContentRepository(client *redis.Client, prefix string) *redisContentRepository {
+	return &redisContentRepository{client: client, prefix: prefix}
+}
+
+// Close releases the connection pool.
+func (r *redisContentRepository) Close() error {
+	return r.client.Close()
+}
+
+func (r *redisContentRepository) itemKey(id string) string {
+	return r.prefix + ":item:" + id
+}
+
+func (r *redisContentRepository) indexKey() string {
+	return r.prefix + ":index"
+}
+
+func (r *redisContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	result := make(allContent, 0)
+	for start := int64(0); ; start += redisListBatch {
+		ids, err := r.client.ZRange(ctx, r.indexKey(), start, start+redisListBatch-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("read redis index: %w", err)
+		}
+		if len(ids) == 0 {
+			return result, nil
+		}
+		pipe := r.client.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, len(ids))
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, r.itemKey(id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("read redis items: %w", err)
+		}
+		for _, cmd := range cmds {
+			// an item deleted between reading the index and the hashes is skipped
+			if fields := cmd.Val(); len(fields) > 0 {
+				result = append(result, api{ID: fields["id"], Name: fields["name"]})
+			}
+		}
+		if len(ids) < redisListBatch {
+			return result, nil
+		}
+	}
+}
+
+func (r *redisContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	items, err := r.ListContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filterByNamePrefix(items, prefix), nil
+}
+
+func (r *redisContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	fields, err := r.client.HGetAll(ctx, r.itemKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get item from redis: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrContentNotFound
+	}
+	return &api{ID: fields["id"], Name: fields["name"]}, nil
+}
+
+func (r *redisContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	created, err := redisCreateScript.Run(ctx, r.client, []string{r.itemKey(item.ID), r.indexKey()}, item.ID, item.Name).Int()
+	if err != nil {
+		return nil, fmt.Errorf("create item in redis: %w", err)
+	}
+	if created == 0 {
+		return nil, ErrContentAlreadyExists
+	}
+	copy := item
+	return &copy, nil
+}
+
+func (r *redisContentRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	updated, err := redisUpdateScript.Run(ctx, r.client, []string{r.itemKey(id)}, name).Int()
+	if err != nil {
+		return nil, fmt.Errorf("update item in redis: %w", err)
+	}
+	if updated == 0 {
+		return nil, ErrContentNotFound
+	}
+	return &api{ID: id, Name: name}, nil
+}
+
+func (r *redisContentRepository) DeleteContent(ctx context.Context, id string) error {
+	deleted, err := redisDeleteScript.Run(ctx, r.client, []string{r.itemKey(id), r.indexKey()}, id).Int()
+	if err != nil {
+		return fmt.Errorf("delete item from redis: %w", err)
+	}
+	if deleted == 0 {
+		return ErrContentNotFound
+	}
+	return nil
+}
+
+// BatchContent sends the scripts of all operations in one pipeline. Each
+// script is atomic on its own; a connection failure leaves the outcome of
+// the affected operations unknown and reports them as failed.
+func (r *redisContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	if err := validateContentBatch(ops); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.Cmd, len(ops))
+	for i, op := range ops {
+		keys := []string{r.itemKey(op.Item.ID), r.indexKey()}
+		// EVAL rather than EVALSHA, a NOSCRIPT reply cannot be retried inside a pipeline
+		switch op.Kind {
+		case contentOperationCreate:
+			cmds[i] = redisCreateScript.Eval(ctx, pipe, keys, op.Item.ID, op.Item.Name)
+		case contentOperationUpsert:
+			cmds[i] = redisUpsertScript.Eval(ctx, pipe, keys, op.Item.ID, op.Item.Name)
+		default:
+			cmds[i] = redisDeleteScript.Eval(ctx, pipe, keys, op.Item.ID)
+		}
+	}
+	// per-command errors are reported on the results below
+	pipe.Exec(ctx)
+
+	results := make([]contentOperationResult, len(ops))
+	for i, op := range ops {
+		applied, err := cmds[i].Int()
+		switch {
+		case err != nil:
+			results[i].Err = fmt.Errorf("%s item in redis: %w", op.Kind, err)
+		case applied == 0 && op.Kind == contentOperationCreate:
+			results[i].Err = ErrContentAlreadyExists
+		case applied == 0:
+			results[i].Err = ErrContentNotFound
+		case op.Kind != contentOperationDelete:
+			results[i] = writtenItem(op.Item)
+		}
+	}
+	return results, nil
+}
+
+// redisCachedContentRepository is a read-through cache for single items in
+// front of a slower repository. Redis failures are logged and the request
+// is served by the backing repository, so the cache never causes an outage.
+type redisCachedContentRepository struct {
+	next   ContentRepository
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisCachedContentRepository(next ContentRepository, client *redis.Client, prefix string, ttl time.Duration) *redisCachedContentRepository {
+	return &redisCachedContentRepository{next: next, client: client, prefix: prefix, ttl: ttl}
+}
+
+func (c *redisCachedContentRepository) unwrap() ContentRepository {
+	return c.next
+}
+
+// Close releases the cache connection pool.
+func (c *redisCachedContentRepository) Close() error {
+	return c.client.Close()
+}
+
+func (c *redisCachedContentRepository) cacheKey(id string) string {
+	return c.prefix + ":cache:" + id
+}
+
+func (c *redisCachedContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	return c.next.ListContent(ctx)
+}
+
+func (c *redisCachedContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	return c.next.ListContentByNamePrefix(ctx, prefix)
+}
+
+// BatchContent drops the cached entry of every operation in the batch.
+func (c *redisCachedContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	results, err := c.next.BatchContent(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = c.cacheKey(op.Item.ID)
+	}
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		slog.Warn("redis cache invalidation failed", "operations", len(ops), "error", err)
+	}
+	return results, nil
+}
+
+func (c *redisCachedContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := c.client.Get(ctx, c.cacheKey(id)).Bytes()
+	if err == nil {
+		var item api
+		if err := json.Unmarshal(data, &item); err == nil {
+			return &item, nil
+		}
+		slog.Warn("discarding undecodable cache entry", "id", id)
+	} else if !errors.Is(err, redis.Nil) {
+		slog.Warn("redis cache read failed", "id", id, "error", err)
+	}
+
+	item, err := c.next.GetContent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(item); err == nil {
+		if err := c.client.Set(ctx, c.cacheKey(id), data, c.ttl).Err(); err != nil {
+			slog.Warn("redis cache write failed", "id", id, "error", err)
+		}
+	}
+	return item, nil
+}
+
+func (c *redisCachedContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	created, err := c.next.CreateContent(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, item.ID)
+	return created, nil
+}
+
+func (c *redisCachedContentRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	updated, err := c.next.UpdateContent(ctx, id, name)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, id)
+	return updated, nil
+}
+
+func (c *redisCachedContentRepository) DeleteContent(ctx context.Context, id string) error {
+	if err := c.next.DeleteContent(ctx, id); err != nil {
+		return err
+	}
+	c.invalidate(ctx, id)
+	return nil
+}
+
+// invalidate drops the cached copy after a write so the next read fetches the
+// new value. A read racing with the write can cache the old value for at most the TTL.
+func (c *redisCachedContentRepository) invalidate(ctx context.Context, id string) {
+	if err := c.client.Del(ctx, c.cacheKey(id)).Err(); err != nil {
+		slog.Warn("redis cache invalidation failed", "id", id, "error", err)
+	}
+}
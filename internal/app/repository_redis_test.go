@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func Test_redisContentRepository(t *testing.T) {
+	server, client := newTestRedis(t)
+	repo := newRedisContentRepository(client, "test")
+	ctx := context.Background()
+
+	for _, id := range []string{"2", "10", "1"} {
+		if _, err := repo.CreateContent(ctx, api{ID: id, Name: "Item " + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Duplicate"}); !errors.Is(err, ErrContentAlreadyExists) {
+		t.Fatalf("expected ErrContentAlreadyExists, got %v", err)
+	}
+	if got := server.HGet("test:item:1", "name"); got != "Item 1" {
+		t.Fatalf("duplicate create overwrote the item: %q", got)
+	}
+
+	items, err := repo.ListContent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(items) != "[{1 Item 1} {10 Item 10} {2 Item 2}]" {
+		t.Fatalf("unexpected list order: %v", items)
+	}
+
+	if _, err := repo.UpdateContent(ctx, "2", "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := repo.GetContent(ctx, "2"); err != nil || item.Name != "Renamed" {
+		t.Fatalf("unexpected item after update: %v, %v", item, err)
+	}
+	if _, err := repo.UpdateContent(ctx, "missing", "x"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("expected ErrContentNotFound on update, got %v", err)
+	}
+	if server.Exists("test:item:missing") {
+		t.Fatal("update of a missing item created a hash")
+	}
+
+	if err := repo.DeleteContent(ctx, "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteContent(ctx, "10"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("expected ErrContentNotFound on second delete, got %v", err)
+	}
+	if _, err := repo.GetContent(ctx, "10"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("expected ErrContentNotFound after delete, got %v", err)
+	}
+	if members, _ := server.ZMembers("test:index"); fmt.Sprint(members) != "[1 2]" {
+		t.Fatalf("index not updated on delete: %v", members)
+	}
+}
+
+func Test_redisContentRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		_, client := newTestRedis(t)
+		return newRedisContentRepository(client, "test")
+	})
+}
+
+func Test_redisCachedContentRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		_, client := newTestRedis(t)
+		return newRedisCachedContentRepository(newInMemoryRepository(nil), client, "test", time.Minute)
+	})
+}
+
+func Test_redisContentRepositoryConcurrentCreate(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := newRedisContentRepository(client, "test")
+
+	var wg sync.WaitGroup
+	var created, conflicts atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.CreateContent(context.Background(), api{ID: "race", Name: fmt.Sprint("Writer ", i)})
+			switch {
+			case err == nil:
+				created.Add(1)
+			case errors.Is(err, ErrContentAlreadyExists):
+				conflicts.Add(1)
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created.Load() != 1 || conflicts.Load() != 19 {
+		t.Fatalf("expected exactly one winner, got %d created and %d conflicts", created.Load(), conflicts.Load())
+	}
+}
+
+// countingContentRepository counts reads that reach the backing repository.
+type countingContentRepository struct {
+	ContentRepository
+	gets atomic.Int32
+}
+
+func (c *countingContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	c.gets.Add(1)
+	return c.ContentRepository.GetContent(ctx, id)
+}
+
+func Test_redisCachedContentRepository(t *testing.T) {
+	server, client := newTestRedis(t)
+	backend := &countingContentRepository{ContentRepository: newInMemoryRepository(allContent{{ID: "1", Name: "Cached"}})}
+	repo := newRedisCachedContentRepository(backend, client, "test", time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if item, err := repo.GetContent(ctx, "1"); err != nil || item.Name != "Cached" {
+			t.Fatalf("unexpected item: %v, %v", item, err)
+		}
+	}
+	if got := backend.gets.Load(); got != 1 {
+		t.Fatalf("expected one backend read, got %d", got)
+	}
+	if ttl := server.TTL("test:cache:1"); ttl != time.Minute {
+		t.Fatalf("unexpected cache ttl %v", ttl)
+	}
+
+	if _, err := repo.UpdateContent(ctx, "1", "Updated"); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := repo.GetContent(ctx, "1"); err != nil || item.Name != "Updated" {
+		t.Fatalf("stale item after update: %v, %v", item, err)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if _, err := repo.GetContent(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := backend.gets.Load(); got != 3 {
+		t.Fatalf("expected a backend read after update and after expiry, got %d reads", got)
+	}
+
+	if err := repo.DeleteContent(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetContent(ctx, "1"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("expected ErrContentNotFound after delete, got %v", err)
+	}
+
+	// an unavailable cache degrades to direct backend reads
+	server.Close()
+	if _, err := repo.CreateContent(ctx, api{ID: "2", Name: "Uncached"}); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := repo.GetContent(ctx, "2"); err != nil || item.Name != "Uncached" {
+		t.Fatalf("expected backend read without redis: %v, %v", item, err)
+	}
+}
+
+func Test_redisContentRepositoryBackend(t *testing.T) {
+	_, client := newTestRedis(t)
+	if got := contentRepositoryBackend(newMetricsContentRepository(newRedisContentRepository(client, "test"))); got != "redis" {
+		t.Fatalf("unexpected backend label %q", got)
+	}
+	cached := newRedisCachedContentRepository(newInMemoryRepository(nil), client, "test", time.Minute)
+	if got := contentRepositoryBackend(cached); got != "memory" {
+		t.Fatalf("cache should report the backing repository, got %q", got)
+	}
+}
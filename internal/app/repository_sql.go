@@ -0,0 +1,417 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlDialect captures what differs between the database/sql backends.
+type sqlDialect struct {
+	name string
+	// placeholder returns the bind parameter for the n-th (1-based) argument
+	placeholder func(n int) string
+	// isUniqueViolation reports whether err is a primary key or unique constraint violation
+	isUniqueViolation func(err error) bool
+	// migrationLock is executed at the start of every migration transaction to
+	// serialise concurrent migrators, empty when the database locks on its own
+	migrationLock string
+	// migrations holds the NNNN_name.sql files applied in version order
+	migrations fs.FS
+	// onConflictDoNothing inserts with "ON CONFLICT (id) DO NOTHING" and detects
+	// duplicates from the affected row count instead of a constraint error
+	onConflictDoNothing bool
+}
+
+// defaultSQLPageSize is the number of rows ListContent fetches per keyset page.
+const defaultSQLPageSize = 500
+
+// migrationTarget is a database connection with the dialect used to migrate it.
+type migrationTarget struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// sqlContentRepository stores content in a "content" table through database/sql
+// using prepared statements. ListContent walks the table in keyset pages
+// ordered by id so no long-running cursor is held open.
+type sqlContentRepository struct {
+	db       *sql.DB
+	dialect  sqlDialect
+	pageSize int
+	list     *sql.Stmt
+	byPrefix *sql.Stmt
+	get      *sql.Stmt
+	insert   *sql.Stmt
+	upsert   *sql.Stmt
+	update   *sql.Stmt
+	remove   *sql.Stmt
+}
+
+func newSQLContentRepository(ctx context.Context, db *sql.DB, dialect sqlDialect) (*sqlContentRepository, error) {
+	p := dialect.placeholder
+	repo := &sqlContentRepository{db: db, dialect: dialect, pageSize: defaultSQLPageSize}
+	insert := "INSERT INTO content (id, name) VALUES (" + p(1) + ", " + p(2) + ")"
+	if dialect.onConflictDoNothing {
+		insert += " ON CONFLICT (id) DO NOTHING"
+	}
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&repo.list, "SELECT id, name FROM content WHERE id > " + p(1) + " ORDER BY id LIMIT " + p(2)},
+		{&repo.byPrefix, "SELECT id, name FROM content WHERE name LIKE " + p(1) + " ESCAPE '\\' ORDER BY id"},
+		{&repo.get, "SELECT id, name FROM content WHERE id = " + p(1)},
+		{&repo.insert, insert},
+		{&repo.upsert, "INSERT INTO content (id, name) VALUES (" + p(1) + ", " + p(2) + ") ON CONFLICT (id) DO UPDATE SET name = excluded.name"},
+		{&repo.update, "UPDATE content SET name = " + p(1) + " WHERE id = " + p(2)},
+		{&repo.remove, "DELETE FROM content WHERE id = " + p(1)},
+	}
+	for _, s := range statements {
+		stmt, err := db.PrepareContext(ctx, s.query)
+		if err != nil {
+			repo.closeStatements()
+			return nil, fmt.Errorf("prepare %q: %w", s.query, err)
+		}
+		*s.stmt = stmt
+	}
+	return repo, nil
+}
+
+func (r *sqlContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	items := allContent{}
+	after := ""
+	for {
+		page, err := r.listPage(ctx, after)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if len(page) < r.pageSize {
+			return items, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// listPage returns up to pageSize items with an id greater than after.
+func (r *sqlContentRepository) listPage(ctx context.Context, after string) (allContent, error) {
+	rows, err := r.list.QueryContext(ctx, after, r.pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("list content: %w", err)
+	}
+	defer rows.Close()
+	page := make(allContent, 0, r.pageSize)
+	for rows.Next() {
+		var item api
+		if err := rows.Scan(&item.ID, &item.Name); err != nil {
+			return nil, fmt.Errorf("scan content: %w", err)
+		}
+		page = append(page, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list content: %w", err)
+	}
+	return page, nil
+}
+
+// likePrefixEscaper escapes the LIKE wildcards in a literal prefix.
+var likePrefixEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *sqlContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	rows, err := r.byPrefix.QueryContext(ctx, likePrefixEscaper.Replace(prefix)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("list content by name prefix: %w", err)
+	}
+	defer rows.Close()
+	items := allContent{}
+	for rows.Next() {
+		var item api
+		if err := rows.Scan(&item.ID, &item.Name); err != nil {
+			return nil, fmt.Errorf("scan content: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list content by name prefix: %w", err)
+	}
+	// LIKE ignores case for ASCII in SQLite, the prefix match does not
+	return filterByNamePrefix(items, prefix), nil
+}
+
+func (r *sqlContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	var item api
+	err := r.get.QueryRowContext(ctx, id).Scan(&item.ID, &item.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrContentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get content: %w", err)
+	}
+	return &item, nil
+}
+
+func (r *sqlContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	res, err := r.insert.ExecContext(ctx, item.ID, item.Name)
+	if err != nil {
+		if r.dialect.isUniqueViolation(err) {
+			return nil, ErrContentAlreadyExists
+		}
+		return nil, fmt.Errorf("insert content: %w", err)
+	}
+	if r.dialect.onConflictDoNothing {
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("insert content: %w", err)
+		} else if n == 0 {
+			return nil, ErrContentAlreadyExists
+		}
+	}
+	return &item, nil
+}
+
+func (r *sqlContentRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	res, err := r.update.ExecContext(ctx, name, id)
+	if err != nil {
+		return nil, fmt.Errorf("update content: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("update content: %w", err)
+	} else if n == 0 {
+		return nil, ErrContentNotFound
+	}
+	return &api{ID: id, Name: name}, nil
+}
+
+func (r *sqlContentRepository) DeleteContent(ctx context.Context, id string) error {
+	res, err := r.remove.ExecContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("delete content: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("delete content: %w", err)
+	} else if n == 0 {
+		return ErrContentNotFound
+	}
+	return nil
+}
+
+// BatchContent applies the operations in one transaction. Conflicts and
+// missing ids only fail their own operation; any other error rolls the
+// whole batch back.
+func (r *sqlContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	if err := validateContentBatch(ops); err != nil {
+		return nil, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin content batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]contentOperationResult, len(ops))
+	for i, op := range ops {
+		results[i] = r.applyTx(ctx, tx, op)
+		if err := results[i].Err; err != nil && !errors.Is(err, ErrContentAlreadyExists) && !errors.Is(err, ErrContentNotFound) {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit content batch: %w", err)
+	}
+	return results, nil
+}
+
+func (r *sqlContentRepository) applyTx(ctx context.Context, tx *sql.Tx, op contentOperation) contentOperationResult {
+	item := op.Item
+	var stmt *sql.Stmt
+	var args []any
+	switch op.Kind {
+	case contentOperationCreate:
+		stmt, args = r.insert, []any{item.ID, item.Name}
+	case contentOperationUpsert:
+		stmt, args = r.upsert, []any{item.ID, item.Name}
+	default:
+		stmt, args = r.remove, []any{item.ID}
+	}
+	res, err := tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	if err != nil {
+		if op.Kind == contentOperationCreate && r.dialect.isUniqueViolation(err) {
+			return contentOperationResult{Err: ErrContentAlreadyExists}
+		}
+		return contentOperationResult{Err: fmt.Errorf("%s content: %w", op.Kind, err)}
+	}
+	if op.Kind == contentOperationUpsert || (op.Kind == contentOperationCreate && !r.dialect.onConflictDoNothing) {
+		return writtenItem(item)
+	}
+	n, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return contentOperationResult{Err: fmt.Errorf("%s content: %w", op.Kind, err)}
+	case op.Kind == contentOperationCreate && n == 0:
+		return contentOperationResult{Err: ErrContentAlreadyExists}
+	case op.Kind == contentOperationCreate:
+		return writtenItem(item)
+	case n == 0:
+		return contentOperationResult{Err: ErrContentNotFound}
+	}
+	return contentOperationResult{}
+}
+
+// Close releases the prepared statements and the connection pool.
+func (r *sqlContentRepository) Close() error {
+	r.closeStatements()
+	return r.db.Close()
+}
+
+func (r *sqlContentRepository) closeStatements() {
+	for _, stmt := range []*sql.Stmt{r.list, r.byPrefix, r.get, r.insert, r.upsert, r.update, r.remove} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// sqlMigration is one versioned schema change loaded from NNNN_name.sql.
+type sqlMigration struct {
+	Version   int
+	Name      string
+	SQL       string
+	AppliedAt time.Time
+}
+
+func loadSQLMigrations(fsys fs.FS) ([]sqlMigration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]sqlMigration, 0, len(files))
+	seen := make(map[int]string)
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+		rawVersion, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s is not named NNNN_name.sql", file)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+		}
+		seen[version] = file
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, sqlMigration{Version: version, Name: name, SQL: string(body)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`
+
+// appliedSQLMigrations returns the applied versions with their timestamps.
+func appliedSQLMigrations(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	if _, err := db.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("read schema_migrations: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// migrateSQL applies all pending migrations, each in its own transaction, and
+// returns the ones it applied.
+func migrateSQL(ctx context.Context, db *sql.DB, dialect sqlDialect) ([]sqlMigration, error) {
+	migrations, err := loadSQLMigrations(dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedSQLMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var done []sqlMigration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		ran, err := applySQLMigration(ctx, db, dialect, m)
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+func applySQLMigration(ctx context.Context, db *sql.DB, dialect sqlDialect, m sqlMigration) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if dialect.migrationLock != "" {
+		if _, err := tx.ExecContext(ctx, dialect.migrationLock); err != nil {
+			return false, fmt.Errorf("acquire migration lock: %w", err)
+		}
+	}
+	// another replica may have applied the migration while we waited for the lock
+	var exists int
+	err = tx.QueryRowContext(ctx, "SELECT 1 FROM schema_migrations WHERE version = "+dialect.placeholder(1), m.Version).Scan(&exists)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return false, err
+	}
+	p := dialect.placeholder
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ("+p(1)+", "+p(2)+", "+p(3)+")",
+		m.Version, m.Name, time.Now().UTC()); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// sqlMigrationStatus lists all known migrations with their applied time, zero when pending.
+func sqlMigrationStatus(ctx context.Context, db *sql.DB, dialect sqlDialect) ([]sqlMigration, error) {
+	migrations, err := loadSQLMigrations(dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedSQLMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range migrations {
+		migrations[i].AppliedAt = applied[migrations[i].Version]
+	}
+	return migrations, nil
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testSQLContentRepository exercises a freshly migrated SQL repository.
+func testSQLContentRepository(t *testing.T, repo *sqlContentRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "First"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateContent(ctx, api{ID: "1", Name: "Duplicate"}); !errors.Is(err, ErrContentAlreadyExists) {
+		t.Fatalf("duplicate insert: got %v want %v", err, ErrContentAlreadyExists)
+	}
+	if _, err := repo.CreateContent(ctx, api{ID: "2", Name: "Second"}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := repo.ListContent(ctx)
+	if err != nil || len(items) != 2 || items[0].ID != "1" {
+		t.Fatalf("unexpected list result: %v %v", items, err)
+	}
+	if updated, err := repo.UpdateContent(ctx, "2", "Renamed"); err != nil || updated.Name != "Renamed" {
+		t.Fatalf("unexpected update result: %v %v", updated, err)
+	}
+	if item, err := repo.GetContent(ctx, "2"); err != nil || item.Name != "Renamed" {
+		t.Fatalf("unexpected get result: %v %v", item, err)
+	}
+	if err := repo.DeleteContent(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetContent(ctx, "2"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("get deleted: got %v want %v", err, ErrContentNotFound)
+	}
+	if _, err := repo.UpdateContent(ctx, "2", "Missing"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("update missing: got %v want %v", err, ErrContentNotFound)
+	}
+	if err := repo.DeleteContent(ctx, "2"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("delete missing: got %v want %v", err, ErrContentNotFound)
+	}
+
+	// keyset pagination has to return every row exactly once across page boundaries
+	repo.pageSize = 2
+	for _, id := range []string{"3", "4", "5", "6"} {
+		if _, err := repo.CreateContent(ctx, api{ID: id, Name: "Paged"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err = repo.ListContent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	if got := strings.Join(ids, ","); got != "1,3,4,5,6" {
+		t.Fatalf("unexpected paged list: got %s want 1,3,4,5,6", got)
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+func sqliteDialect() sqlDialect {
+	migrations, err := fs.Sub(sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		panic(err)
+	}
+	return sqlDialect{
+		name:        "sqlite",
+		placeholder: func(int) string { return "?" },
+		isUniqueViolation: func(err error) bool {
+			var sqliteErr *sqlite.Error
+			if !errors.As(err, &sqliteErr) {
+				return false
+			}
+			code := sqliteErr.Code()
+			return code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+		},
+		migrations: migrations,
+	}
+}
+
+// openSQLite opens the database file in SQLITE_PATH with WAL journaling and a
+// busy timeout so concurrent requests wait for the single writer.
+func openSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLITE_PATH environment variable not set")
+	}
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open sqlite database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// newSQLiteContentRepositoryFromEnv opens SQLITE_PATH, applies pending
+// migrations and prepares the repository statements.
+func newSQLiteContentRepositoryFromEnv(ctx context.Context) (*sqlContentRepository, error) {
+	db, err := openSQLite(strings.TrimSpace(os.Getenv("SQLITE_PATH")))
+	if err != nil {
+		return nil, err
+	}
+	dialect := sqliteDialect()
+	if _, err := migrateSQL(ctx, db, dialect); err != nil {
+		db.Close()
+		return nil, err
+	}
+	repo, err := newSQLContentRepository(ctx, db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
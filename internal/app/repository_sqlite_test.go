@@ -0,0 +1,61 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestSQLiteRepository(t *testing.T) *sqlContentRepository {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "content.db"))
+	repo, err := newSQLiteContentRepositoryFromEnv(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func Test_sqliteContentRepository(t *testing.T) {
+	testSQLContentRepository(t, newTestSQLiteRepository(t))
+}
+
+func Test_sqliteContentRepositoryConformance(t *testing.T) {
+	RunContentRepositoryConformance(t, func(t *testing.T) ContentRepository {
+		return newTestSQLiteRepository(t)
+	})
+}
+
+func Test_Migrate(t *testing.T) {
+	t.Setenv("REPOSITORY_BACKEND", "")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "migrate.db"))
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"Status before migrating", []string{"status"}, "create_content  pending"},
+		{"Apply migrations", nil, "applied 0001_create_content"},
+		{"Idempotent", []string{"up"}, "schema is up to date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Migrate(tt.args, &out); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Fatalf("unexpected output %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := Migrate([]string{"down"}, &out); err == nil {
+		t.Fatal("expected an error for an unknown migrate command")
+	}
+}
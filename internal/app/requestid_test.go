@@ -0,0 +1,84 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_RequestIDHandler(t *testing.T) {
+	resetRepository()
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	api.HandleFunc("/v1/content/{id}", basicAuth(getSingleContent)).Methods("GET")
+	handler := RequestIDHandler(router)
+
+	t.Run("Generated for subrouter 404", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/unknown", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusNotFound)
+		}
+		if id := rr.Header().Get(requestIDHeader); len(id) != 36 {
+			t.Fatalf("expected generated request id, got %q", id)
+		}
+	})
+
+	t.Run("Incoming id is echoed in headers and error body", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/content/404", nil)
+		req.Header.Set(requestIDHeader, "abc-123")
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if got := rr.Header().Get(requestIDHeader); got != "abc-123" {
+			t.Fatalf("unexpected request id header: got %q want %q", got, "abc-123")
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["request_id"] != "abc-123" || body["error"] != "Invalid ID" {
+			t.Fatalf("unexpected error body: %v", body)
+		}
+	})
+
+	t.Run("Invalid incoming id is replaced", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/unknown", nil)
+		req.Header.Set(requestIDHeader, "bad id\twith spaces")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if got := rr.Header().Get(requestIDHeader); got == "bad id\twith spaces" || got == "" {
+			t.Fatalf("expected replaced request id, got %q", got)
+		}
+	})
+}
+
+func Test_RequestIDForwardedByProxy(t *testing.T) {
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(requestIDHeader)
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	router := mux.NewRouter()
+	router.Handle("/proxy/upstream", generateProxy(config{
+		Path:     "/upstream",
+		Host:     u.Host,
+		Override: override{Path: "/", Scheme: "http"},
+	}))
+	rr := httptest.NewRecorder()
+	RequestIDHandler(router).ServeHTTP(rr, httptest.NewRequest("GET", "/proxy/upstream", nil))
+
+	if forwarded == "" || forwarded != rr.Header().Get(requestIDHeader) {
+		t.Fatalf("request id not forwarded upstream: got %q want %q", forwarded, rr.Header().Get(requestIDHeader))
+	}
+}
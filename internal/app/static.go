@@ -0,0 +1,161 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/berndonline/go-helloworld/go-rest-api/web"
+)
+
+// precompressed variants checked in order of preference
+var staticEncodings = []struct {
+	name      string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticFileServer serves files from an fs.FS with ETag and Cache-Control
+// headers, precompressed .br/.gz variants and without directory listings.
+// With spaFallback, unknown extension-less paths are answered with the root
+// index.html so client-side routes work on reload.
+type staticFileServer struct {
+	fsys        fs.FS
+	spaFallback bool
+	etags       sync.Map
+}
+
+func newStaticFileServer(fsys fs.FS, spaFallback bool) *staticFileServer {
+	return &staticFileServer{fsys: fsys, spaFallback: spaFallback}
+}
+
+// staticAssets returns the embedded web/static files or, for development, the
+// directory given in STATIC_DIR.
+func staticAssets() fs.FS {
+	if dir := strings.TrimSpace(os.Getenv("STATIC_DIR")); dir != "" {
+		slog.Info("serving static files from directory", "dir", dir)
+		return os.DirFS(dir)
+	}
+	assets, err := fs.Sub(web.Static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return assets
+}
+
+func (s *staticFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	name, ok := s.resolve(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	variant, encoding := name, ""
+	for _, enc := range staticEncodings {
+		if acceptsEncoding(r, enc.name) && s.isFile(name+enc.extension) {
+			variant, encoding = name+enc.extension, enc.name
+			break
+		}
+	}
+	content, modTime, err := s.read(variant)
+	if err != nil {
+		requestLogger(r).Error("failed to read static file", "file", variant, "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("ETag", s.etag(variant, modTime, content))
+	w.Header().Set("Cache-Control", staticCacheControl(name))
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(content))
+}
+
+// resolve maps a cleaned request path to a file: directories serve their
+// index.html, everything else that is missing falls back to the root
+// index.html when enabled. Directory listings are never produced.
+func (s *staticFileServer) resolve(name string) (string, bool) {
+	if name == "" {
+		name = "."
+	}
+	if info, err := fs.Stat(s.fsys, name); err == nil {
+		if !info.IsDir() {
+			return name, true
+		}
+		if index := path.Join(name, "index.html"); s.isFile(index) {
+			return index, true
+		}
+	}
+	if s.spaFallback && path.Ext(name) == "" && s.isFile("index.html") {
+		return "index.html", true
+	}
+	return "", false
+}
+
+func (s *staticFileServer) isFile(name string) bool {
+	info, err := fs.Stat(s.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+func (s *staticFileServer) read(name string) ([]byte, time.Time, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	content, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return content, info.ModTime(), nil
+}
+
+// etag hashes the file content once per name and modification time.
+func (s *staticFileServer) etag(name string, modTime time.Time, content []byte) string {
+	key := name + "@" + modTime.String()
+	if tag, ok := s.etags.Load(key); ok {
+		return tag.(string)
+	}
+	sum := sha256.Sum256(content)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	s.etags.Store(key, tag)
+	return tag
+}
+
+// html must be revalidated so new deployments are picked up, other assets may be cached for a day.
+func staticCacheControl(name string) string {
+	if path.Ext(name) == ".html" {
+		return "no-cache"
+	}
+	return "public, max-age=86400"
+}
+
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		value, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(value), encoding) {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
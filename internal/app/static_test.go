@@ -0,0 +1,89 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_staticFileServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>index</h1>")},
+		"app.js":            {Data: []byte("console.log('plain')")},
+		"app.js.gz":         {Data: []byte("gzip-bytes")},
+		"app.js.br":         {Data: []byte("brotli-bytes")},
+		"assets/logo.svg":   {Data: []byte("<svg/>")},
+		"nested/index.html": {Data: []byte("<h1>nested</h1>")},
+	}
+	server := newStaticFileServer(fsys, true)
+
+	tests := []struct {
+		name         string
+		path         string
+		encoding     string
+		want         int
+		body         string
+		wantEncoding string
+		cache        string
+	}{
+		{"Root index", "/", "", http.StatusOK, "<h1>index</h1>", "", "no-cache"},
+		{"Plain asset", "/app.js", "", http.StatusOK, "console.log('plain')", "", "public, max-age=86400"},
+		{"Brotli preferred", "/app.js", "gzip, br", http.StatusOK, "brotli-bytes", "br", "public, max-age=86400"},
+		{"Gzip variant", "/app.js", "gzip", http.StatusOK, "gzip-bytes", "gzip", "public, max-age=86400"},
+		{"Refused brotli", "/app.js", "br;q=0", http.StatusOK, "console.log('plain')", "", "public, max-age=86400"},
+		{"Directory index", "/nested/", "", http.StatusOK, "<h1>nested</h1>", "", "no-cache"},
+		{"No directory listing", "/assets/", "", http.StatusOK, "<h1>index</h1>", "", "no-cache"},
+		{"SPA fallback", "/some/client/route", "", http.StatusOK, "<h1>index</h1>", "", "no-cache"},
+		{"Missing asset", "/missing.css", "", http.StatusNotFound, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.encoding != "" {
+				req.Header.Set("Accept-Encoding", tt.encoding)
+			}
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status code: got %d want %d", rr.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if rr.Body.String() != tt.body {
+				t.Errorf("unexpected body: got %q want %q", rr.Body.String(), tt.body)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("unexpected content encoding: got %q want %q", got, tt.wantEncoding)
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.cache {
+				t.Errorf("unexpected cache control: got %q want %q", got, tt.cache)
+			}
+		})
+	}
+
+	t.Run("ETag revalidation", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest("GET", "/app.js", nil))
+		etag := rr.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("no ETag header")
+		}
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotModified {
+			t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusNotModified)
+		}
+	})
+
+	t.Run("Embedded site", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		newStaticFileServer(staticAssets(), true).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Fatalf("embedded index not served: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsSettings describes how a listener terminates TLS.
+type tlsSettings struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+	Reload       time.Duration
+}
+
+func (s tlsSettings) enabled() bool {
+	return s.CertFile != "" && s.KeyFile != ""
+}
+
+// loadTLSSettings reads the listener TLS configuration from the environment. The
+// metrics listener reuses the public certificate when METRICS_TLS is set and has
+// its own client authentication policy.
+func loadTLSSettings(metrics bool) (tlsSettings, error) {
+	settings := tlsSettings{
+		CertFile:     strings.TrimSpace(os.Getenv("TLS_CERT_FILE")),
+		KeyFile:      strings.TrimSpace(os.Getenv("TLS_KEY_FILE")),
+		ClientCAFile: strings.TrimSpace(os.Getenv("TLS_CLIENT_CA_FILE")),
+		Reload:       30 * time.Second,
+	}
+	if metrics && !envBool("METRICS_TLS") {
+		return tlsSettings{}, nil
+	}
+	if (settings.CertFile == "") != (settings.KeyFile == "") {
+		return tlsSettings{}, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if raw := strings.TrimSpace(os.Getenv("TLS_RELOAD_INTERVAL")); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil {
+			return tlsSettings{}, fmt.Errorf("invalid TLS_RELOAD_INTERVAL: %w", err)
+		}
+		settings.Reload = interval
+	}
+	authVar := "TLS_CLIENT_AUTH"
+	if metrics {
+		authVar = "METRICS_TLS_CLIENT_AUTH"
+	}
+	clientAuth, err := parseClientAuth(os.Getenv(authVar))
+	if err != nil {
+		return tlsSettings{}, fmt.Errorf("invalid %s: %w", authVar, err)
+	}
+	if clientAuth == tls.NoClientCert && settings.ClientCAFile != "" {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	if clientAuth >= tls.VerifyClientCertIfGiven && settings.ClientCAFile == "" {
+		return tlsSettings{}, fmt.Errorf("%s requires TLS_CLIENT_CA_FILE", authVar)
+	}
+	settings.ClientAuth = clientAuth
+	return settings, nil
+}
+
+func parseClientAuth(raw string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "verify-if-given", "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require", "require-and-verify":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", raw)
+}
+
+// certReloader keeps the serving certificate and client CA pool in sync with the
+// files on disk so rotated certificates (e.g. from cert-manager) are picked up
+// without a restart.
+type certReloader struct {
+	settings tlsSettings
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(settings tlsSettings) (*certReloader, error) {
+	reloader := &certReloader{settings: settings, modTimes: map[string]time.Time{}}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (c *certReloader) files() []string {
+	files := []string{c.settings.CertFile, c.settings.KeyFile}
+	if c.settings.ClientCAFile != "" {
+		files = append(files, c.settings.ClientCAFile)
+	}
+	return files
+}
+
+// changed reports whether any watched file has a different modification time
+// than at the last successful load.
+func (c *certReloader) changed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(c.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *certReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(c.settings.CertFile, c.settings.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+	var pool *x509.CertPool
+	if c.settings.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.settings.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA bundle %s contains no certificates", c.settings.ClientCAFile)
+		}
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.clientCA = pool
+	c.modTimes = modTimes
+	c.mu.Unlock()
+	return nil
+}
+
+// watch polls the certificate files until the context is cancelled and reloads
+// them when they change. Failed reloads keep serving the previous material.
+func (c *certReloader) watch(ctx context.Context) {
+	if c.settings.Reload <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.settings.Reload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+			if err := c.reload(); err != nil {
+				slog.Error("failed to reload TLS certificates", "error", err)
+				continue
+			}
+			slog.Info("reloaded TLS certificate", "cert_file", c.settings.CertFile)
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// tlsConfig returns a server configuration that resolves the certificate and
+// client CA pool per handshake.
+func (c *certReloader) tlsConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientAuth:     c.settings.ClientAuth,
+		GetCertificate: c.getCertificate,
+	}
+	base.GetConfigForClient = func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = c.clientCA
+		return cfg, nil
+	}
+	return base
+}
+
+// serveHTTP starts the server with or without TLS depending on the settings.
+func serveHTTP(ctx context.Context, server *http.Server, settings tlsSettings) error {
+	if !settings.enabled() {
+		return server.ListenAndServe()
+	}
+	reloader, err := newCertReloader(settings)
+	if err != nil {
+		return err
+	}
+	go reloader.watch(ctx)
+	server.TLSConfig = reloader.tlsConfig()
+	return server.ListenAndServeTLS("", "")
+}
+
+// clientPrincipals maps certificate subjects to principals. Keys are either a
+// full distinguished name (as rendered by pkix.Name.String) or a common name.
+var clientPrincipals = parseClientPrincipals(os.Getenv("TLS_CLIENT_PRINCIPALS"))
+
+// parseClientPrincipals reads "subject:principal" entries separated by ";".
+func parseClientPrincipals(raw string) map[string]string {
+	principals := make(map[string]string)
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		idx := strings.LastIndex(entry, ":")
+		if idx <= 0 || idx == len(entry)-1 {
+			continue
+		}
+		principals[strings.TrimSpace(entry[:idx])] = strings.TrimSpace(entry[idx+1:])
+	}
+	return principals
+}
+
+// clientCertPrincipal returns the principal mapped to the verified client
+// certificate presented on the request, if any.
+func clientCertPrincipal(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if principal, ok := clientPrincipals[subject.String()]; ok {
+		return principal, true
+	}
+	if principal, ok := clientPrincipals[subject.CommonName]; ok && subject.CommonName != "" {
+		return principal, true
+	}
+	return "", false
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"helloworld"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_certReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true)
+	first := newTestCert(t, "server-1", ca, false)
+	second := newTestCert(t, "server-2", ca, false)
+
+	settings := tlsSettings{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	past := time.Now().Add(-time.Minute)
+	writeTestFile(t, settings.CertFile, first.certPEM, past)
+	writeTestFile(t, settings.KeyFile, first.keyPEM, past)
+	writeTestFile(t, settings.ClientCAFile, ca.certPEM, past)
+
+	reloader, err := newCertReloader(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloader.changed() {
+		t.Fatal("expected no change right after loading")
+	}
+
+	writeTestFile(t, settings.CertFile, second.certPEM, time.Now())
+	writeTestFile(t, settings.KeyFile, second.keyPEM, time.Now())
+	if !reloader.changed() {
+		t.Fatal("expected rotated certificate to be detected")
+	}
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := reloader.getCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "server-2" {
+		t.Fatalf("unexpected certificate after reload: %s", leaf.Subject.CommonName)
+	}
+}
+
+func Test_clientCertPrincipal(t *testing.T) {
+	resetRepository()
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true)
+	server := newTestCert(t, "localhost", ca, false)
+	client := newTestCert(t, "svc-reporter", ca, false)
+
+	settings := tlsSettings{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	writeTestFile(t, settings.CertFile, server.certPEM, time.Now())
+	writeTestFile(t, settings.KeyFile, server.keyPEM, time.Now())
+	writeTestFile(t, settings.ClientCAFile, ca.certPEM, time.Now())
+	reloader, err := newCertReloader(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := clientPrincipals
+	clientPrincipals = parseClientPrincipals("svc-reporter:user1")
+	defer func() { clientPrincipals = previous }()
+
+	var principal string
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/content", basicAuth(func(w http.ResponseWriter, r *http.Request) {
+		principal = principalFromContext(r.Context())
+		getIndexContent(w, r)
+	})).Methods("GET")
+	r.HandleFunc("/api/v2/content", jwtAuth(createContent)).Methods("POST")
+	ts := httptest.NewUnstartedServer(r)
+	ts.TLS = reloader.tlsConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clientPair, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Mapped client certificate", func(t *testing.T) {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{clientPair},
+		}}}
+		resp, err := httpClient.Get(ts.URL + "/api/v1/content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code: got %d want %d", resp.StatusCode, http.StatusOK)
+		}
+		if principal != "user1" {
+			t.Fatalf("unexpected principal: got %q want %q", principal, "user1")
+		}
+	})
+
+	t.Run("Unsafe requests with a client certificate need a trusted origin", func(t *testing.T) {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{clientPair},
+		}}}
+		tests := []struct {
+			name   string
+			origin string
+			id     string
+			want   int
+		}{
+			{"Cross-origin", "https://evil.example", "cert-1", http.StatusForbidden},
+			{"Same origin", ts.URL, "cert-2", http.StatusCreated},
+		}
+		for _, tt := range tests {
+			req, err := http.NewRequest("POST", ts.URL+"/api/v2/content", strings.NewReader(`{"id":"`+tt.id+`","name":"Forged"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Origin", tt.origin)
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("%s: unexpected status code: got %d want %d", tt.name, resp.StatusCode, tt.want)
+			}
+		}
+		if _, err := getContentRepository().GetContent(context.Background(), "cert-1"); !errors.Is(err, ErrContentNotFound) {
+			t.Fatalf("cross-origin request created content: %v", err)
+		}
+	})
+
+	t.Run("No client certificate", func(t *testing.T) {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+		resp, err := httpClient.Get(ts.URL + "/api/v1/content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("unexpected status code: got %d want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	})
+}
@@ -1,106 +1,178 @@
 package app
 
 import (
-    "github.com/gorilla/mux"
-    opentracing "github.com/opentracing/opentracing-go"
-    "github.com/opentracing/opentracing-go/ext"
-    "github.com/uber/jaeger-client-go"
-    jaegercfg "github.com/uber/jaeger-client-go/config"
-    // jaegerlog "github.com/uber/jaeger-client-go/log"
-    "github.com/uber/jaeger-client-go/zipkin"
-    // "github.com/uber/jaeger-lib/metrics"
-    "io"
-    "log"
+    "context"
+    "log/slog"
     "net/http"
     "os"
+    "strconv"
     "strings"
+
+    "github.com/gorilla/mux"
+    "go.opentelemetry.io/contrib/propagators/b3"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+    "go.opentelemetry.io/otel/trace"
 )
 
-// opentracing service configuration
-func initTracer(service string) (opentracing.Tracer, io.Closer) {
-    cfg := jaegercfg.Configuration{
-        ServiceName: service,
-        Sampler: &jaegercfg.SamplerConfig{
-            Type:  jaeger.SamplerTypeConst,
-            Param: 1,
-        },
-        Reporter: &jaegercfg.ReporterConfig{
-            LogSpans: true,
-        },
-    }
-    // jLogger := jaegerlog.StdLogger
-    // jMetricsFactory := metrics.NullFactory
-    
-    // https://github.com/jaegertracing/jaeger-client-go/blob/master/zipkin/README.md
-    zipkinPropagator := zipkin.NewZipkinB3HTTPHeaderPropagator()
+// instrumentation scope used for all spans created by the service
+const instrumentationName = "github.com/berndonline/go-helloworld/go-rest-api/internal/app"
 
-    tracer, closer, err := cfg.NewTracer(
-        // jaegercfg.Logger(jLogger),
-        // jaegercfg.Metrics(jMetricsFactory),
+// function to get the tracer from the global tracer provider
+func tracer() trace.Tracer {
+    return otel.Tracer(instrumentationName)
+}
 
-        // https://github.com/jaegertracing/jaeger-client-go/blob/master/zipkin/README.md
-        jaegercfg.Injector(opentracing.HTTPHeaders, zipkinPropagator),
-        jaegercfg.Extractor(opentracing.HTTPHeaders, zipkinPropagator),
-        jaegercfg.ZipkinSharedRPCSpan(true),
+// opentelemetry tracer provider configuration, returns the provider shutdown function
+func initTracer(ctx context.Context, service string) (func(context.Context) error, error) {
+    res, err := resource.New(ctx,
+        resource.WithFromEnv(),
+        resource.WithTelemetrySDK(),
+        resource.WithAttributes(
+            semconv.ServiceName(service),
+            semconv.ServiceVersion(serviceVersion()),
+            semconv.HostName(hostname()),
+        ),
     )
     if err != nil {
-        log.Fatal(service+": cannot initialize Jaeger Tracer", err)
+        return nil, err
+    }
+    opts := []sdktrace.TracerProviderOption{
+        sdktrace.WithResource(res),
+        sdktrace.WithSampler(traceSampler()),
+    }
+    exporter, err := newSpanExporter(ctx)
+    if err != nil {
+        return nil, err
     }
+    if exporter != nil {
+        opts = append(opts, sdktrace.WithBatcher(exporter))
+    }
+    provider := sdktrace.NewTracerProvider(opts...)
+    otel.SetTracerProvider(provider)
+    otel.SetTextMapPropagator(newPropagator())
+    return provider.Shutdown, nil
+}
 
-    return tracer, closer
+// function to create the otlp exporter, the exporters read the standard OTEL_EXPORTER_OTLP_* variables
+func newSpanExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+    if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+        slog.Info("tracing exporter disabled (missing OTEL_EXPORTER_OTLP_ENDPOINT)")
+        return nil, nil
+    }
+    protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+    if protocol == "" {
+        protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+    }
+    switch strings.ToLower(strings.TrimSpace(protocol)) {
+    case "", "grpc":
+        slog.Info("tracing exporter enabled", "protocol", "grpc")
+        return otlptracegrpc.New(ctx)
+    case "http/protobuf", "http":
+        slog.Info("tracing exporter enabled", "protocol", "http/protobuf")
+        return otlptracehttp.New(ctx)
+    }
+    slog.Warn("unsupported OTLP protocol, tracing exporter disabled", "protocol", protocol)
+    return nil, nil
 }
 
-// tracing handler to start root span
-func tracingHandler(handler http.HandlerFunc) http.HandlerFunc {
-    incomingHeaders := []string{
-        "x-request-id",
-        "x-b3-traceid",
-        "x-b3-spanid",
-        "x-b3-parentspanid",
-        "x-b3-sampled",
-        "x-b3-flags",
-        "x-ot-span-context",
+// function to select the sampler from OTEL_TRACES_SAMPLER (defaults to parentbased_traceidratio)
+func traceSampler() sdktrace.Sampler {
+    raw := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER")))
+    switch raw {
+    case "always_on":
+        return sdktrace.AlwaysSample()
+    case "always_off":
+        return sdktrace.NeverSample()
+    case "traceidratio":
+        return sdktrace.TraceIDRatioBased(traceSampleRatio())
+    case "parentbased_always_on":
+        return sdktrace.ParentBased(sdktrace.AlwaysSample())
+    case "parentbased_always_off":
+        return sdktrace.ParentBased(sdktrace.NeverSample())
+    case "", "parentbased_traceidratio":
+    default:
+        slog.Warn("unsupported OTEL_TRACES_SAMPLER, using parentbased_traceidratio", "value", raw)
     }
-    return func(w http.ResponseWriter, r *http.Request) {
-        route := mux.CurrentRoute(r)
-        path, _ := route.GetPathTemplate()
-        method := strings.ToLower(r.Method)
+    return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(traceSampleRatio()))
+}
 
-        tracer := opentracing.GlobalTracer()
-        span := StartSpanFromRequest(path, tracer, r)
+// function to read the sampling ratio from OTEL_TRACES_SAMPLER_ARG (defaults to 1)
+func traceSampleRatio() float64 {
+    raw := strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER_ARG"))
+    if raw == "" {
+        return 1
+    }
+    ratio, err := strconv.ParseFloat(raw, 64)
+    if err != nil || ratio < 0 || ratio > 1 {
+        slog.Warn("invalid OTEL_TRACES_SAMPLER_ARG, sampling everything", "value", raw)
+        return 1
+    }
+    return ratio
+}
 
-        defer span.Finish()
-        ext.HTTPMethod.Set(span, method)
-        ext.PeerHostIPv4.SetString(span, getIPAddress(r))
-        span.SetTag("hostname", os.Getenv("HOSTNAME"))
+// w3c trace context and baggage plus b3 multi header propagation for zipkin compatible peers
+func newPropagator() propagation.TextMapPropagator {
+    return propagation.NewCompositeTextMapPropagator(
+        propagation.TraceContext{},
+        propagation.Baggage{},
+        b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+    )
+}
 
-        for _, th := range incomingHeaders {
-            span.SetTag(th, r.Header.Get(th))
-            w.Header().Set(th, r.Header.Get(th))
+// tracing handler to start the server span for a route and pass it on in the request context
+func tracingHandler(handler http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        path := r.URL.Path
+        if route := mux.CurrentRoute(r); route != nil {
+            path, _ = route.GetPathTemplate()
         }
 
-        traceID, _ := span.Context().(jaeger.SpanContext)
-        log.Print("rootSpan:", traceID)
-        Inject(span, r)
-        handler(w, r)
-    }
-}
+        ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+        ctx, span := tracer().Start(ctx, r.Method+" "+path,
+            trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(
+                semconv.HTTPRequestMethodKey.String(r.Method),
+                semconv.HTTPRoute(path),
+                semconv.URLPath(r.URL.Path),
+                semconv.ClientAddress(getIPAddress(r)),
+                semconv.UserAgentOriginal(r.UserAgent()),
+                attribute.String("http.request.header.x-request-id", requestIDFromContext(r.Context())),
+            ),
+        )
+        defer span.End()
 
-func StartSpanFromRequest(spanName string, tracer opentracing.Tracer, r *http.Request) opentracing.Span {
-    spanCtx, _ := Extract(tracer, r)
-    return tracer.StartSpan(spanName, opentracing.ChildOf(spanCtx))
-}
+        if sc := span.SpanContext(); sc.HasTraceID() {
+            if info := requestInfoFromContext(r.Context()); info != nil {
+                info.traceID = sc.TraceID().String()
+                info.traceSampled = sc.IsSampled()
+            }
+        }
 
-func Extract(tracer opentracing.Tracer, r *http.Request) (opentracing.SpanContext, error) {
-    return tracer.Extract(
-        opentracing.HTTPHeaders,
-        opentracing.HTTPHeadersCarrier(r.Header))
-}
+        delegate := &responseWriterDelegator{ResponseWriter: w}
+        handler(delegate, r.WithContext(ctx))
 
-func Inject(span opentracing.Span, r *http.Request) error {
-    return span.Tracer().Inject(
-        span.Context(),
-        opentracing.HTTPHeaders,
-        opentracing.HTTPHeadersCarrier(r.Header))
+        status := delegate.status
+        if status == 0 {
+            status = http.StatusOK
+        }
+        span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+        if status >= http.StatusInternalServerError {
+            span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+            span.SetStatus(codes.Error, http.StatusText(status))
+        }
+    }
 }
 
+// function to start a child span of the span in the request context and return the request carrying it
+func startRequestSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+    ctx, span := tracer().Start(r.Context(), name)
+    return r.WithContext(ctx), span
+}
@@ -0,0 +1,224 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingContentRepository records a client span with database semantic
+// attributes for every repository call.
+type tracingContentRepository struct {
+	next       ContentRepository
+	attrs      []attribute.KeyValue
+	operations map[string]string
+}
+
+// dynamoOperations maps repository methods to the DynamoDB API call they issue.
+var dynamoOperations = map[string]string{
+	"ListContent":             "Scan",
+	"ListContentByNamePrefix": "Query",
+	"GetContent":              "GetItem",
+	"CreateContent":           "PutItem",
+	"UpdateContent":           "UpdateItem",
+	"DeleteContent":           "DeleteItem",
+}
+
+func newTracingContentRepository(next ContentRepository) ContentRepository {
+	t := &tracingContentRepository{next: next}
+	switch repo := baseContentRepository(next).(type) {
+	case *dynamoContentRepository:
+		t.attrs = []attribute.KeyValue{semconv.DBSystemNameAWSDynamoDB, semconv.DBCollectionName(repo.table)}
+		t.operations = dynamoOperations
+	case *sqlContentRepository:
+		t.attrs = []attribute.KeyValue{semconv.DBSystemNameKey.String(repo.dialect.name), semconv.DBCollectionName("content")}
+	case *redisContentRepository:
+		t.attrs = []attribute.KeyValue{semconv.DBSystemNameRedis, semconv.DBNamespace(repo.prefix)}
+	case *inMemoryRepository:
+		t.attrs = []attribute.KeyValue{semconv.DBSystemNameKey.String("memory")}
+	}
+	return t
+}
+
+func (t *tracingContentRepository) unwrap() ContentRepository {
+	return t.next
+}
+
+// start begins the span for a repository method with the backend attributes.
+func (t *tracingContentRepository) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	operation := method
+	if op, ok := t.operations[method]; ok {
+		operation = op
+	}
+	attrs = append(attrs, t.attrs...)
+	attrs = append(attrs, semconv.DBOperationName(operation))
+	return tracer().Start(ctx, "ContentRepository."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (t *tracingContentRepository) ListContent(ctx context.Context) (allContent, error) {
+	ctx, span := t.start(ctx, "ListContent")
+	defer span.End()
+	items, err := t.next.ListContent(ctx)
+	endSpan(span, err)
+	return items, err
+}
+
+func (t *tracingContentRepository) ListContentByNamePrefix(ctx context.Context, prefix string) (allContent, error) {
+	ctx, span := t.start(ctx, "ListContentByNamePrefix", attribute.String("content.name_prefix", prefix))
+	defer span.End()
+	items, err := t.next.ListContentByNamePrefix(ctx, prefix)
+	endSpan(span, err)
+	return items, err
+}
+
+func (t *tracingContentRepository) GetContent(ctx context.Context, id string) (*api, error) {
+	ctx, span := t.start(ctx, "GetContent", attribute.String("content.id", id))
+	defer span.End()
+	item, err := t.next.GetContent(ctx, id)
+	endSpan(span, err)
+	return item, err
+}
+
+func (t *tracingContentRepository) CreateContent(ctx context.Context, item api) (*api, error) {
+	ctx, span := t.start(ctx, "CreateContent", attribute.String("content.id", item.ID))
+	defer span.End()
+	created, err := t.next.CreateContent(ctx, item)
+	endSpan(span, err)
+	return created, err
+}
+
+func (t *tracingContentRepository) UpdateContent(ctx context.Context, id string, name string) (*api, error) {
+	ctx, span := t.start(ctx, "UpdateContent", attribute.String("content.id", id))
+	defer span.End()
+	updated, err := t.next.UpdateContent(ctx, id, name)
+	endSpan(span, err)
+	return updated, err
+}
+
+func (t *tracingContentRepository) DeleteContent(ctx context.Context, id string) error {
+	ctx, span := t.start(ctx, "DeleteContent", attribute.String("content.id", id))
+	defer span.End()
+	err := t.next.DeleteContent(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingContentRepository) BatchContent(ctx context.Context, ops []contentOperation) ([]contentOperationResult, error) {
+	ctx, span := t.start(ctx, "BatchContent", semconv.DBOperationBatchSize(len(ops)))
+	defer span.End()
+	results, err := t.next.BatchContent(ctx, ops)
+	endSpan(span, err)
+	return results, err
+}
+
+// tracingContentPublisher records a producer span with messaging semantic
+// attributes for every published event. The Kafka publisher injects the span
+// context into the message headers.
+type tracingContentPublisher struct {
+	next  ContentPublisher
+	attrs []attribute.KeyValue
+}
+
+func newTracingContentPublisher(next ContentPublisher) ContentPublisher {
+	t := &tracingContentPublisher{next: next}
+	if p, ok := baseContentPublisher(next).(*kafkaPublisher); ok {
+		t.attrs = []attribute.KeyValue{
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(p.writer.Topic),
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingOperationName("send"),
+		}
+	}
+	return t
+}
+
+func (t *tracingContentPublisher) unwrap() ContentPublisher {
+	return t.next
+}
+
+func (t *tracingContentPublisher) Publish(ctx context.Context, item api) error {
+	attrs := append([]attribute.KeyValue{
+		attribute.String("content.id", item.ID),
+		semconv.MessagingKafkaMessageKey(item.ID),
+	}, t.attrs...)
+	ctx, span := tracer().Start(ctx, "ContentPublisher.Publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	err := t.next.Publish(ctx, item)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingContentPublisher) PublishBatch(ctx context.Context, items []api) error {
+	attrs := append([]attribute.KeyValue{semconv.MessagingBatchMessageCount(len(items))}, t.attrs...)
+	ctx, span := tracer().Start(ctx, "ContentPublisher.PublishBatch",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	err := t.next.PublishBatch(ctx, items)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingContentPublisher) Close() error {
+	return t.next.Close()
+}
+
+// endSpan marks the span as failed for unexpected errors; missing or duplicate
+// content is a regular outcome answered with 404/409 and not a span error.
+func endSpan(span trace.Span, err error) {
+	if err == nil || errors.Is(err, ErrContentNotFound) || errors.Is(err, ErrContentAlreadyExists) {
+		return
+	}
+	span.RecordError(err)
+	span.SetAttributes(semconv.ErrorTypeKey.String(errorClass(err)))
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// kafkaHeaderCarrier adapts Kafka message headers to the OpenTelemetry
+// propagators; keys are matched case-insensitively like HTTP headers.
+type kafkaHeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c kafkaHeaderCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c kafkaHeaderCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if strings.EqualFold(h.Key, key) {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// injectKafkaTraceContext writes the span context of ctx into the message headers.
+func injectKafkaTraceContext(ctx context.Context, msg *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{headers: &msg.Headers})
+}
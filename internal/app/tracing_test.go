@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func Test_traceSampler(t *testing.T) {
+	tests := []struct {
+		sampler string
+		arg     string
+		want    sdktrace.Sampler
+	}{
+		{"", "", sdktrace.ParentBased(sdktrace.TraceIDRatioBased(1))},
+		{"parentbased_traceidratio", "0.25", sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.25))},
+		{"traceidratio", "0.5", sdktrace.TraceIDRatioBased(0.5)},
+		{"always_on", "", sdktrace.AlwaysSample()},
+		{"always_off", "", sdktrace.NeverSample()},
+		{"parentbased_always_on", "", sdktrace.ParentBased(sdktrace.AlwaysSample())},
+		{"parentbased_always_off", "", sdktrace.ParentBased(sdktrace.NeverSample())},
+		{"jaeger_remote", "0.5", sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.5))},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTEL_TRACES_SAMPLER", tt.sampler)
+		t.Setenv("OTEL_TRACES_SAMPLER_ARG", tt.arg)
+		if got, want := traceSampler().Description(), tt.want.Description(); got != want {
+			t.Errorf("OTEL_TRACES_SAMPLER=%q: got %s, want %s", tt.sampler, got, want)
+		}
+	}
+}
+
+func Test_tracingHandler(t *testing.T) {
+	recorder := newTestTracer(t)
+	setContentRepository(newTracingContentRepository(newInMemoryRepository(allContent{{ID: "1", Name: "Traced"}})))
+	defer resetRepository()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v1/content/{id}", tracingHandler(basicAuth(getSingleContent))).Methods("GET")
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		trace  string
+	}{
+		{"W3C trace context", "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"B3 single header", "b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1", "80f198ee56343ba864fe8b2a57d3eff7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			req, err := http.NewRequest("GET", "/api/v1/content/1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.SetBasicAuth(username, password)
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: got %d want %d", rr.Code, http.StatusOK)
+			}
+
+			spans := map[string]sdktrace.ReadOnlySpan{}
+			for _, span := range recorder.Ended() {
+				spans[span.Name()] = span
+			}
+			server, ok := spans["GET /api/v1/content/{id}"]
+			if !ok {
+				t.Fatalf("server span missing, got %v", spans)
+			}
+			if server.SpanKind() != trace.SpanKindServer {
+				t.Errorf("unexpected server span kind: %v", server.SpanKind())
+			}
+			if got := server.SpanContext().TraceID().String(); got != tt.trace {
+				t.Errorf("incoming trace context not continued: got %s want %s", got, tt.trace)
+			}
+			parents := map[string]string{
+				"basicAuth":                    "GET /api/v1/content/{id}",
+				"getSingleContent":             "basicAuth",
+				"ContentRepository.GetContent": "getSingleContent",
+			}
+			for child, parent := range parents {
+				span, ok := spans[child]
+				if !ok {
+					t.Fatalf("span %s missing", child)
+				}
+				if span.Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+					t.Errorf("span %s is not a child of %s", child, parent)
+				}
+			}
+		})
+	}
+}
+
+type failingRepository struct {
+	ContentRepository
+	err error
+}
+
+func (f *failingRepository) GetContent(_ context.Context, _ string) (*api, error) {
+	return nil, f.err
+}
+
+func Test_tracingContentRepository(t *testing.T) {
+	recorder := newTestTracer(t)
+
+	tests := []struct {
+		name      string
+		err       error
+		status    codes.Code
+		errorType string
+	}{
+		{"Found", nil, codes.Unset, ""},
+		{"Not found is no span error", ErrContentNotFound, codes.Unset, ""},
+		{"Backend error", fmt.Errorf("get item: %w", errors.New("connection reset")), codes.Error, errorClassOther},
+		{"Throttled backend", fmt.Errorf("get item: %w", &smithy.GenericAPIError{Code: "ProvisionedThroughputExceededException"}), codes.Error, errorClassThrottled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			var next ContentRepository = newInMemoryRepository(allContent{{ID: "1", Name: "Traced"}})
+			if tt.err != nil {
+				next = &failingRepository{ContentRepository: next, err: tt.err}
+			}
+			repo := newTracingContentRepository(next)
+			repo.GetContent(context.Background(), "1")
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("unexpected number of spans: got %d want 1", len(spans))
+			}
+			if got := spans[0].Status().Code; got != tt.status {
+				t.Errorf("unexpected span status: got %v want %v", got, tt.status)
+			}
+			if tt.status == codes.Error && len(spans[0].Events()) == 0 {
+				t.Error("error was not recorded on the span")
+			}
+			var errorType string
+			for _, attr := range spans[0].Attributes() {
+				if attr.Key == semconv.ErrorTypeKey {
+					errorType = attr.Value.AsString()
+				}
+			}
+			if errorType != tt.errorType {
+				t.Errorf("unexpected error.type: got %q want %q", errorType, tt.errorType)
+			}
+		})
+	}
+}
+
+func Test_injectKafkaTraceContext(t *testing.T) {
+	newTestTracer(t)
+	ctx, span := tracer().Start(context.Background(), "publish")
+	defer span.End()
+
+	msg := kafka.Message{Headers: []kafka.Header{{Key: "x-request-id", Value: []byte("abc")}}}
+	injectKafkaTraceContext(ctx, &msg)
+
+	extracted := otel.GetTextMapPropagator().Extract(context.Background(), kafkaHeaderCarrier{headers: &msg.Headers})
+	got := trace.SpanContextFromContext(extracted)
+	if got.TraceID() != span.SpanContext().TraceID() || got.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("span context not propagated through kafka headers: got %v", got)
+	}
+	if carrier := (kafkaHeaderCarrier{headers: &msg.Headers}); carrier.Get("traceparent") == "" || carrier.Get("X-B3-TraceId") == "" {
+		t.Fatalf("expected traceparent and b3 headers, got %v", carrier.Keys())
+	}
+}
@@ -0,0 +1,219 @@
+// Minimal API explorer rendering the service's own OpenAPI document.
+(function () {
+  "use strict";
+
+  var SPEC_URL = "/api/openapi.json";
+  var csrfToken = "";
+  var spec;
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      if (key === "text") {
+        node.textContent = attrs[key];
+      } else {
+        node.setAttribute(key, attrs[key]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      node.appendChild(child);
+    });
+    return node;
+  }
+
+  function resolve(node) {
+    while (node && node.$ref) {
+      node = node.$ref.replace(/^#\//, "").split("/").reduce(function (acc, part) {
+        return acc && acc[part];
+      }, spec);
+    }
+    return node || {};
+  }
+
+  // example builds a sample value from a schema to prefill request bodies.
+  function example(schema) {
+    schema = resolve(schema);
+    switch (schema.type) {
+      case "object":
+        var obj = {};
+        Object.keys(schema.properties || {}).forEach(function (name) {
+          obj[name] = example(schema.properties[name]);
+        });
+        return obj;
+      case "array":
+        return [example(schema.items)];
+      case "integer":
+      case "number":
+        return 0;
+      case "boolean":
+        return false;
+    }
+    return "string";
+  }
+
+  function credentials() {
+    return {
+      username: document.getElementById("username").value,
+      password: document.getElementById("password").value
+    };
+  }
+
+  function setSession(text) {
+    document.getElementById("session").textContent = text;
+  }
+
+  function format(res, body) {
+    var lines = ["HTTP " + res.status + " " + res.statusText];
+    res.headers.forEach(function (value, name) {
+      lines.push(name + ": " + value);
+    });
+    lines.push("");
+    try {
+      lines.push(JSON.stringify(JSON.parse(body), null, 2));
+    } catch (e) {
+      lines.push(body);
+    }
+    return lines.join("\n");
+  }
+
+  function send(method, path, body) {
+    var headers = {};
+    var unsafe = ["GET", "HEAD", "OPTIONS"].indexOf(method) === -1;
+    if (path.indexOf("/api/v1/") === 0) {
+      var c = credentials();
+      headers.Authorization = "Basic " + btoa(c.username + ":" + c.password);
+    } else if (unsafe && csrfToken) {
+      headers["X-CSRF-Token"] = csrfToken;
+    }
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    return fetch(path, {
+      method: method,
+      headers: headers,
+      body: body,
+      credentials: "same-origin"
+    }).then(function (res) {
+      var token = res.headers.get("X-CSRF-Token");
+      if (token) {
+        csrfToken = token;
+        setSession("session active");
+      }
+      return res.text().then(function (text) {
+        return { res: res, body: text };
+      });
+    });
+  }
+
+  function renderOperation(path, method, op, pathParams) {
+    var params = (pathParams || []).concat(op.parameters || []).map(resolve)
+      .filter(function (p) { return p.in === "path"; });
+    var inputs = {};
+    var form = el("div");
+
+    if (op.description) {
+      form.appendChild(el("p", { text: op.description }));
+    }
+    params.forEach(function (p) {
+      inputs[p.name] = el("input", { placeholder: p.name });
+      form.appendChild(el("label", { text: p.name + " " }, [inputs[p.name]]));
+    });
+
+    var bodyInput;
+    if (op.requestBody) {
+      var media = resolve(op.requestBody).content["application/json"];
+      bodyInput = el("textarea");
+      bodyInput.value = JSON.stringify(example(media.schema), null, 2);
+      form.appendChild(bodyInput);
+    }
+
+    var rows = Object.keys(op.responses).map(function (code) {
+      return el("tr", {}, [
+        el("td", {}, [el("code", { text: code })]),
+        el("td", { text: resolve(op.responses[code]).description || "" })
+      ]);
+    });
+    form.appendChild(el("table", { class: "responses" }, rows));
+
+    var output = el("pre", { class: "response", hidden: "" });
+    var button = el("button", { type: "button", text: "Send request" });
+    button.addEventListener("click", function () {
+      var url = path.replace(/\{(\w+)\}/g, function (_, name) {
+        return encodeURIComponent(inputs[name].value);
+      });
+      output.hidden = false;
+      output.textContent = "…";
+      send(method.toUpperCase(), url, bodyInput ? bodyInput.value : undefined).then(function (r) {
+        output.textContent = format(r.res, r.body);
+      }, function (err) {
+        output.textContent = String(err);
+      });
+    });
+    form.appendChild(el("p", {}, [button]));
+    form.appendChild(output);
+
+    return el("details", { class: "operation" }, [
+      el("summary", {}, [
+        el("span", { class: "method " + method, text: method.toUpperCase() }),
+        el("code", { text: path }),
+        el("span", { class: "status", text: op.summary || "" })
+      ]),
+      form
+    ]);
+  }
+
+  function render() {
+    document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+    document.getElementById("description").textContent = spec.info.description || "";
+    var main = document.getElementById("operations");
+    main.textContent = "";
+    var groups = {};
+    Object.keys(spec.paths).forEach(function (path) {
+      var item = spec.paths[path];
+      ["get", "post", "put", "delete"].forEach(function (method) {
+        var op = item[method];
+        if (!op) {
+          return;
+        }
+        var tag = (op.tags || ["default"])[0];
+        if (!groups[tag]) {
+          groups[tag] = el("section", {}, [el("h2", { text: tag })]);
+          main.appendChild(groups[tag]);
+        }
+        groups[tag].appendChild(renderOperation(path, method, op, item.parameters));
+      });
+    });
+  }
+
+  document.getElementById("login").addEventListener("click", function () {
+    send("POST", "/api/v2/login", JSON.stringify(credentials())).then(function (r) {
+      if (r.res.status !== 200) {
+        setSession("login failed: HTTP " + r.res.status);
+      }
+    });
+  });
+
+  document.getElementById("logout").addEventListener("click", function () {
+    send("POST", "/api/v2/logout").then(function () {
+      csrfToken = "";
+      setSession("no session");
+    });
+  });
+
+  // pick up the CSRF token of an existing session from its readable cookie
+  document.cookie.split("; ").forEach(function (cookie) {
+    if (cookie.indexOf("csrf_token=") === 0) {
+      csrfToken = decodeURIComponent(cookie.slice("csrf_token=".length));
+      setSession("session active");
+    }
+  });
+
+  fetch(SPEC_URL).then(function (res) {
+    return res.json();
+  }).then(function (doc) {
+    spec = doc;
+    render();
+  }, function (err) {
+    document.getElementById("operations").textContent = "Failed to load " + SPEC_URL + ": " + err;
+  });
+})();
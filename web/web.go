@@ -0,0 +1,14 @@
+// Package web bundles the browser assets served by the helloworld service.
+package web
+
+import "embed"
+
+// Docs holds the API explorer page served under /docs/.
+//
+//go:embed docs
+var Docs embed.FS
+
+// Static holds the site served under /static/.
+//
+//go:embed static
+var Static embed.FS